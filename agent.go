@@ -0,0 +1,528 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"reflect"
+	"slices"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/yseto/switch-traffic-to-mackerel/config"
+	"github.com/yseto/switch-traffic-to-mackerel/logging"
+	"github.com/yseto/switch-traffic-to-mackerel/mackerel"
+	"github.com/yseto/switch-traffic-to-mackerel/metric"
+	"github.com/yseto/switch-traffic-to-mackerel/prometheus"
+	"github.com/yseto/switch-traffic-to-mackerel/queue"
+	"github.com/yseto/switch-traffic-to-mackerel/status"
+)
+
+// agent runs targets and queues of the config, and applies a reloaded config in place.
+type agent struct {
+	// ctx is for collections and refreshing hosts.
+	ctx context.Context
+	wg  *sync.WaitGroup
+	// senders outlive ctx, so that they keep sending until collection stops.
+	sendWg *sync.WaitGroup
+
+	// nil when not configured.
+	exporter *prometheus.Exporter
+	status   *status.Status
+
+	// collectMu is held during a collection cycle, not to enqueue to removed queues.
+	collectMu sync.Mutex
+
+	mu      sync.RWMutex
+	config  *config.Config
+	targets []*target
+	service *serviceOutput
+	sinks   []*sinkOutput
+	// dryRunQueue is used when there are no outputs.
+	dryRunQueue *queue.Queue
+	queues      queue.Group
+	cancels     map[*queue.Queue]context.CancelFunc
+
+	// they call Mackerel and devices, replaced in tests.
+	initMackerel       func(ctx context.Context, t *config.Target, logger *slog.Logger) (*mackerel.Mackerel, error)
+	createGraphDefs    func(m *mackerel.Mackerel, t *config.Target) error
+	resourceAttributes func(ctx context.Context, t *config.Target) map[string]string
+}
+
+// target holds the state of a target across collection cycles and reloads.
+type target struct {
+	config    *config.Target
+	logger    *slog.Logger
+	converter *metric.Converter
+	custom    *metric.Custom
+	self      *metric.SelfConverter
+	queues    queue.Group
+	// resource is attributes for otlp, nil until an otlp sink is configured.
+	resource map[string]string
+
+	// nil without mackerel.
+	mackerel  *mackerel.Mackerel
+	hostQueue *queue.Queue
+	// cancel stops refreshHost, and done is closed when it returned.
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func newAgent(ctx context.Context) *agent {
+	return &agent{
+		ctx:     ctx,
+		wg:      &sync.WaitGroup{},
+		sendWg:  &sync.WaitGroup{},
+		cancels: make(map[*queue.Queue]context.CancelFunc),
+
+		initMackerel: initMackerel,
+		createGraphDefs: func(m *mackerel.Mackerel, t *config.Target) error {
+			return m.CreateGraphDefs(t.CustomMIBsGraphDefs)
+		},
+		resourceAttributes: resourceAttributes,
+	}
+}
+
+// Stats returns stats of running queues, for status.
+func (a *agent) Stats() []queue.Stats {
+	a.mu.RLock()
+	queues := a.queues
+	a.mu.RUnlock()
+	return queues.Stats()
+}
+
+// apply starts the config. on reload, states of kept targets and queues are kept.
+// the config is validated and its queues are created first, then hosts are registered on Mackerel.
+// the current config is kept when it returns an error.
+func (a *agent) apply(c *config.Config) error {
+	a.mu.RLock()
+	old := a.config
+	prev := make(map[string]*target, len(a.targets))
+	for _, r := range a.targets {
+		prev[r.config.Target] = r
+	}
+	service, prevSinks, dryRunQueue := a.service, a.sinks, a.dryRunQueue
+	a.mu.RUnlock()
+
+	if old != nil {
+		if c.DryRun != old.DryRun || !reflect.DeepEqual(c.Prometheus, old.Prometheus) || !reflect.DeepEqual(c.Status, old.Status) {
+			slog.Warn("dry-run, prometheus and status are applied on restart", "phase", "reload")
+		}
+		c.DryRun, c.Prometheus, c.Status = old.DryRun, old.Prometheus, old.Status
+	}
+	logger := logging.New(os.Stderr, c.Log, c.Debug)
+
+	// queues to start. shared queues are created again only when their own config changed.
+	var started queue.Group
+	var shared queue.Group
+	if c.MackerelService == nil {
+		service = nil
+	} else if service == nil || !reflect.DeepEqual(service.config, c.MackerelService) {
+		service = newServiceOutput(c.MackerelService, c.DryRun, logger)
+		started = append(started, service.queue)
+	}
+	if service != nil {
+		shared = append(shared, service.queue)
+	}
+	var sinks []*sinkOutput
+	prevSinks = slices.Clone(prevSinks)
+	for _, s := range c.Sinks {
+		if i := slices.IndexFunc(prevSinks, func(o *sinkOutput) bool { return reflect.DeepEqual(o.config, s) }); i >= 0 {
+			sinks = append(sinks, prevSinks[i])
+			prevSinks = slices.Delete(prevSinks, i, i+1)
+			continue
+		}
+		o, err := newSinkOutput(s, c.DryRun, logger)
+		if err != nil {
+			return err
+		}
+		sinks = append(sinks, o)
+		started = append(started, o.queue)
+	}
+	for _, o := range sinks {
+		shared = append(shared, o.queue)
+	}
+
+	var targets []*target
+	// targets to register hosts, and kept hosts with changed custom MIBs.
+	var register, graphDefs []*target
+	for _, t := range c.Targets {
+		r := &target{
+			config:    t,
+			logger:    logger.With("target", t.Target),
+			converter: metric.NewConverter(collectInterval),
+			custom:    metric.NewCustom(t.CustomMIBmetricNameMappedMIBs),
+			self:      metric.NewSelfConverter(),
+			queues:    shared,
+		}
+		p, kept := prev[t.Target]
+		if kept {
+			r.converter, r.self, r.resource = p.converter, p.self, p.resource
+		}
+
+		if t.Mackerel != nil {
+			if kept && sameHost(p, t) {
+				r.mackerel, r.hostQueue = p.mackerel, p.hostQueue
+				if sameRefresh(p, t) {
+					r.cancel, r.done = p.cancel, p.done
+				}
+				if len(t.CustomMIBsGraphDefs) > 0 && !reflect.DeepEqual(p.config.CustomMIBsGraphDefs, t.CustomMIBsGraphDefs) {
+					graphDefs = append(graphDefs, r)
+				}
+			} else {
+				register = append(register, r)
+			}
+		}
+		targets = append(targets, r)
+	}
+
+	// the config is valid, Mackerel is changed from here.
+	// hosts registered before an error are kept, their host ids are saved for the next reload.
+	for _, r := range register {
+		t := r.config
+		mClient, err := a.initMackerel(a.ctx, t, r.logger)
+		if err != nil {
+			return fmt.Errorf("%s: %w", t.Target, err)
+		}
+		r.mackerel = mClient
+		r.hostQueue = queue.New(queue.Arg{
+			Name:           "mackerel:" + t.Name(),
+			SendFunc:       mClient,
+			Logger:         r.logger,
+			DryRun:         c.DryRun,
+			DeadLetterFile: t.Mackerel.DeadLetterFile,
+		})
+		started = append(started, r.hostQueue)
+	}
+	for _, r := range graphDefs {
+		if err := a.createGraphDefs(r.mackerel, r.config); err != nil {
+			return fmt.Errorf("%s: %w", r.config.Target, err)
+		}
+	}
+
+	used := slices.Clone(shared)
+	// targets without outputs, their values are logged by the dry-run queue.
+	var noOutput []*target
+	for _, r := range targets {
+		switch {
+		case r.hostQueue != nil:
+			r.queues = append(queue.Group{r.hostQueue}, shared...)
+			used = append(used, r.hostQueue)
+		case len(shared) == 0:
+			noOutput = append(noOutput, r)
+		}
+	}
+	if len(noOutput) > 0 || len(used) == 0 {
+		if dryRunQueue == nil {
+			dryRunQueue = queue.New(queue.Arg{
+				Name:   "dry-run",
+				Logger: logger,
+				DryRun: true,
+			})
+			started = append(started, dryRunQueue)
+		}
+		if len(used) > 0 {
+			for _, r := range noOutput {
+				r.logger.Warn("no output, values are not sent", "phase", "reload")
+			}
+		}
+		used = append(used, dryRunQueue)
+		for _, r := range noOutput {
+			r.queues = queue.Group{dryRunQueue}
+		}
+	}
+
+	// resources of otlp, kept targets have them already.
+	var resources map[string]map[string]string
+	if slices.ContainsFunc(sinks, func(o *sinkOutput) bool { return o.otlp != nil }) {
+		resources = make(map[string]map[string]string, len(targets))
+		for _, r := range targets {
+			if r.resource == nil {
+				r.resource = a.resourceAttributes(a.ctx, r.config)
+			}
+			resources[r.config.Target] = r.resource
+		}
+	}
+
+	// refreshers of removed or changed hosts are stopped before new ones start,
+	// not to update a host at the same time.
+	for _, p := range prev {
+		if p.cancel != nil && !slices.ContainsFunc(targets, func(r *target) bool { return r.done == p.done }) {
+			p.cancel()
+			<-p.done
+		}
+	}
+
+	a.collectMu.Lock()
+	a.mu.Lock()
+	// kept queues and hosts log with the new config too.
+	slog.SetDefault(logger)
+	for _, q := range shared {
+		q.SetLogger(logger)
+	}
+	if dryRunQueue != nil {
+		dryRunQueue.SetLogger(logger)
+	}
+	for _, r := range targets {
+		if r.mackerel != nil {
+			r.mackerel.SetLogger(r.logger)
+			r.hostQueue.SetLogger(r.logger)
+		}
+	}
+	if service != nil {
+		service.service.SetTargets(targetNames(c))
+	}
+	for _, o := range sinks {
+		if o.otlp != nil {
+			o.otlp.SetResources(resources)
+		}
+	}
+
+	var retired queue.Group
+	for _, q := range a.queues {
+		if !slices.Contains(used, q) {
+			retired = append(retired, q)
+		}
+	}
+	if !slices.Contains(used, dryRunQueue) {
+		dryRunQueue = nil
+	}
+	for _, q := range started {
+		a.run(q)
+	}
+	for _, r := range targets {
+		if r.mackerel != nil && r.cancel == nil {
+			a.refresh(r)
+		}
+	}
+	for _, q := range retired {
+		a.retire(q, c.ShutdownGracePeriod)
+	}
+	a.config = c
+	a.targets = targets
+	a.service = service
+	a.sinks = sinks
+	a.dryRunQueue = dryRunQueue
+	a.queues = used
+	a.mu.Unlock()
+	a.collectMu.Unlock()
+
+	if a.exporter != nil {
+		a.exporter.Reload(c)
+	}
+	var names []string
+	for _, t := range c.Targets {
+		names = append(names, t.Target)
+	}
+	a.status.SetTargets(names)
+	return nil
+}
+
+// sameHost reports whether the host of the kept target is used as is.
+func sameHost(p *target, t *config.Target) bool {
+	if p.mackerel == nil || p.config.Host != t.Host {
+		return false
+	}
+	om, nm := *p.config.Mackerel, *t.Mackerel
+	// the host id saved on creation.
+	if nm.HostID == p.mackerel.HostID() {
+		om.HostID = nm.HostID
+	}
+	return reflect.DeepEqual(om, nm)
+}
+
+// sameRefresh reports whether refreshHost of the kept target is kept running,
+// its tickers are not restarted on every reload.
+func sameRefresh(p *target, t *config.Target) bool {
+	c, m := *p.config, *p.config.Mackerel
+	// the host id saved on creation.
+	m.HostID = t.Mackerel.HostID
+	c.Mackerel = &m
+	return reflect.DeepEqual(&c, t)
+}
+
+// refresh starts refreshHost of the target.
+func (a *agent) refresh(r *target) {
+	ctx, cancel := context.WithCancel(a.ctx)
+	done := make(chan struct{})
+	r.cancel, r.done = cancel, done
+	a.wg.Add(1)
+	go func() {
+		defer close(done)
+		refreshHost(ctx, a.wg, r.config, r.mackerel)
+	}()
+}
+
+// run starts sending of the queue. a.mu is held.
+func (a *agent) run(q *queue.Queue) {
+	ctx, cancel := context.WithCancel(context.Background())
+	a.cancels[q] = cancel
+	a.sendWg.Add(1)
+	go func() {
+		defer a.sendWg.Done()
+		q.Run(ctx)
+	}()
+}
+
+// retire stops the queue removed by reload, after sending pending values. a.mu is held.
+func (a *agent) retire(q *queue.Queue, grace time.Duration) {
+	a.cancels[q]()
+	delete(a.cancels, q)
+	a.sendWg.Add(1)
+	go func() {
+		defer a.sendWg.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), grace)
+		defer cancel()
+		flushed, abandoned := q.Flush(ctx)
+		slog.Info("removed queue", "phase", "reload", "queue", q.Stats().Name, "flushed", flushed, "abandoned", abandoned)
+	}()
+}
+
+// reload applies the config, or keeps the current one when it is not valid.
+func (a *agent) reload(load func() (*config.Config, error)) {
+	c, err := load()
+	if err == nil {
+		err = a.apply(c)
+	}
+	if err != nil {
+		slog.Error("reload rejected, the current config is kept", "phase", "reload", "error", err)
+		return
+	}
+	slog.Info("config reloaded", "phase", "reload", "targets", len(c.Targets))
+}
+
+// shutdown waits senders, and flushes pending values.
+func (a *agent) shutdown() {
+	a.mu.Lock()
+	for _, cancel := range a.cancels {
+		cancel()
+	}
+	queues := a.queues
+	grace := a.config.ShutdownGracePeriod
+	a.mu.Unlock()
+	a.sendWg.Wait()
+
+	slog.Info("flushing queue", "phase", "flush", "grace_period", grace)
+	ctx, cancel := context.WithTimeout(context.Background(), grace)
+	defer cancel()
+	flushed, abandoned := queues.Flush(ctx)
+	slog.Info("flushed queue", "phase", "flush", "flushed", flushed, "abandoned", abandoned)
+}
+
+func (a *agent) collectTicker(ctx context.Context, wg *sync.WaitGroup) {
+	t := time.NewTicker(collectInterval)
+	defer func() {
+		t.Stop()
+		wg.Done()
+	}()
+
+	for {
+		select {
+		case <-t.C:
+			a.collectAll(ctx)
+
+		case <-ctx.Done():
+			slog.Info("cancellation from context", "error", ctx.Err())
+			// refreshHost stops by ctx.
+			a.wg.Wait()
+			return
+		}
+	}
+}
+
+// collectAll collects all targets in parallel, and aggregates them.
+func (a *agent) collectAll(ctx context.Context) {
+	a.collectMu.Lock()
+	defer a.collectMu.Unlock()
+
+	a.mu.RLock()
+	targets, service, aggregates := a.targets, a.service, a.config.Aggregates
+	a.mu.RUnlock()
+
+	results := make([][]*metric.Metric, len(targets))
+	errs := make([]error, len(targets))
+	collectWg := &sync.WaitGroup{}
+	for i := range targets {
+		collectWg.Add(1)
+		go func() {
+			defer collectWg.Done()
+			results[i], errs[i] = collect(ctx, targets[i], a.exporter, a.status)
+		}()
+	}
+	collectWg.Wait()
+
+	if service == nil {
+		return
+	}
+	// a sum without some targets looks like a drop of traffic, so it is not posted.
+	var failed []string
+	for i := range targets {
+		if results[i] == nil && errs[i] != nil {
+			failed = append(failed, targets[i].config.Target)
+		}
+	}
+	if len(failed) > 0 {
+		if len(aggregates) > 0 {
+			slog.Warn("aggregates skipped", "phase", "aggregate", "failed", failed)
+		}
+		return
+	}
+	// targets without the previous values yet, on the first collection.
+	if slices.ContainsFunc(results, func(m []*metric.Metric) bool { return m == nil }) {
+		return
+	}
+	all := slices.Concat(results...)
+	for _, r := range aggregates {
+		service.queue.Enqueue(metric.Aggregate(all, r.MetricName, r.InterfaceRegexp))
+	}
+}
+
+// watchInterval is the interval to check changes of the config file.
+const watchInterval = 5 * time.Second
+
+// reloadLoop reloads the config on SIGHUP, and on changes of the file when watch is set.
+func reloadLoop(ctx context.Context, wg *sync.WaitGroup, a *agent, filename string, watch bool, load func() (*config.Config, error)) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer func() {
+		signal.Stop(hup)
+		wg.Done()
+	}()
+
+	// nil channel never receives.
+	var watchC <-chan time.Time
+	var last os.FileInfo
+	if watch {
+		t := time.NewTicker(watchInterval)
+		defer t.Stop()
+		watchC = t.C
+		last, _ = os.Stat(filename)
+	}
+
+	for {
+		select {
+		case <-hup:
+			slog.Info("SIGHUP received", "phase", "reload")
+			a.reload(load)
+
+		case <-watchC:
+			fi, err := os.Stat(filename)
+			if err != nil {
+				slog.Warn("watch failed", "phase", "reload", "error", err)
+				continue
+			}
+			if last != nil && fi.ModTime().Equal(last.ModTime()) && fi.Size() == last.Size() {
+				continue
+			}
+			last = fi
+			slog.Info("config changed", "phase", "reload", "config", filename)
+			a.reload(load)
+
+		case <-ctx.Done():
+			return
+		}
+	}
+}
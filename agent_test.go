@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/yseto/switch-traffic-to-mackerel/config"
+	"github.com/yseto/switch-traffic-to-mackerel/mackerel"
+	"github.com/yseto/switch-traffic-to-mackerel/queue"
+)
+
+// testAgent returns the agent with fake Mackerel and devices, and targets registered by it.
+func testAgent(t *testing.T) (*agent, *[]string) {
+	ctx, cancel := context.WithCancel(context.Background())
+	a := newAgent(ctx)
+	t.Cleanup(func() {
+		cancel()
+		if a.config != nil {
+			a.shutdown()
+		}
+	})
+
+	var registered []string
+	a.initMackerel = func(_ context.Context, t *config.Target, logger *slog.Logger) (*mackerel.Mackerel, error) {
+		registered = append(registered, t.Target)
+		if t.Target == "192.0.2.99" {
+			return nil, errors.New("unreachable")
+		}
+		return mackerel.New(&mackerel.Arg{TargetAddr: t.Host, HostID: t.Mackerel.HostID, Name: t.Name(), Logger: logger}), nil
+	}
+	a.createGraphDefs = func(*mackerel.Mackerel, *config.Target) error {
+		return nil
+	}
+	a.resourceAttributes = func(_ context.Context, t *config.Target) map[string]string {
+		return map[string]string{"host.name": t.Target}
+	}
+	return a, &registered
+}
+
+// testConfig loads the config written in the file of dir, the same file as on reload.
+func testConfig(t *testing.T, dir, source string) *config.Config {
+	t.Helper()
+	filename := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(filename, []byte(source), 0600); err != nil {
+		t.Fatal(err)
+	}
+	c, err := loadConfig(filename, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+const testOutputs = `
+community: public
+mackerel-service:
+  name: network
+  x-api-key: dummy
+sinks:
+  - type: json
+    path: /dev/null
+`
+
+func TestApply(t *testing.T) {
+	a, registered := testAgent(t)
+	dir := t.TempDir()
+	c1 := testConfig(t, dir, testOutputs+`
+targets:
+  - target: 192.0.2.1
+    mackerel: {host-id: host1, x-api-key: dummy}
+  - target: 192.0.2.2
+    mackerel: {host-id: host2, x-api-key: dummy}
+`)
+	if err := a.apply(c1); err != nil {
+		t.Fatal(err)
+	}
+	kept := a.targets[0]
+	removed, removedDone := a.targets[1].hostQueue, a.targets[1].done
+	sinkQueue, serviceQueue := a.sinks[0].queue, a.service.queue
+
+	t.Run("kept target and shared queues", func(t *testing.T) {
+		c2 := testConfig(t, dir, testOutputs+`
+log:
+  level: debug
+targets:
+  - target: 192.0.2.1
+    mackerel: {host-id: host1, x-api-key: dummy}
+  - target: 192.0.2.3
+    mackerel: {host-id: host3, x-api-key: dummy}
+`)
+		if err := a.apply(c2); err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(*registered, []string{"192.0.2.1", "192.0.2.2", "192.0.2.3"}); diff != "" {
+			t.Errorf("value is mismatch (-actual +expected):%s", diff)
+		}
+		r := a.targets[0]
+		if r.converter != kept.converter || r.self != kept.self || r.mackerel != kept.mackerel || r.hostQueue != kept.hostQueue {
+			t.Error("state of the kept target is not kept")
+		}
+		if r.done != kept.done {
+			t.Error("refresher of the kept target is restarted")
+		}
+		select {
+		case <-removedDone:
+		default:
+			t.Error("refresher of the removed target is not stopped")
+		}
+		// adding a target does not create shared queues again.
+		if a.sinks[0].queue != sinkQueue || a.service.queue != serviceQueue {
+			t.Error("shared queues are created again")
+		}
+		if slices.Contains(a.queues, removed) {
+			t.Error("queue of the removed target is used")
+		}
+		if _, ok := a.cancels[removed]; ok {
+			t.Error("queue of the removed target is not retired")
+		}
+		if !r.logger.Enabled(context.Background(), slog.LevelDebug) || !slog.Default().Enabled(context.Background(), slog.LevelDebug) {
+			t.Error("log config is not applied")
+		}
+	})
+
+	t.Run("invalid config", func(t *testing.T) {
+		c3 := testConfig(t, dir, testOutputs+`
+targets:
+  - target: 192.0.2.1
+    mackerel: {host-id: host1, x-api-key: dummy}
+  - target: 192.0.2.4
+    mackerel: {host-id: host4, x-api-key: dummy}
+`)
+		// a sink which cannot be created.
+		c3.Sinks = append(c3.Sinks, &config.Sink{Type: "unknown"})
+		c4 := testConfig(t, dir, testOutputs+`
+targets:
+  - target: 192.0.2.1
+    mackerel: {host-id: host1, x-api-key: dummy}
+  - target: 192.0.2.99
+    mackerel: {host-id: host99, x-api-key: dummy}
+`)
+
+		current, targets, queues := a.config, a.targets, slices.Clone(a.queues)
+		for _, c := range []*config.Config{c3, c4} {
+			if err := a.apply(c); err == nil {
+				t.Error("invalid config is applied")
+			}
+			if a.config != current || !slices.Equal(a.targets, targets) || !slices.Equal(a.queues, queues) {
+				t.Error("current config is not kept")
+			}
+		}
+		// hosts are not registered before the config is validated.
+		if slices.Contains(*registered, "192.0.2.4") {
+			t.Error("host of an invalid config is registered")
+		}
+	})
+}
+
+func TestApply_dryRun(t *testing.T) {
+	a, _ := testAgent(t)
+	dir := t.TempDir()
+	if err := a.apply(testConfig(t, dir, "community: public\ntarget: 192.0.2.1\n")); err != nil {
+		t.Fatal(err)
+	}
+	dryRunQueue := a.dryRunQueue
+	if dryRunQueue == nil || !slices.Equal(a.queues, queue.Group{dryRunQueue}) || !slices.Equal(a.targets[0].queues, a.queues) {
+		t.Fatalf("dry-run queue is not used %v", a.queues)
+	}
+
+	// outputs replace the dry-run queue.
+	if err := a.apply(testConfig(t, dir, "community: public\ntarget: 192.0.2.1\nmackerel: {host-id: host1, x-api-key: dummy}\n")); err != nil {
+		t.Fatal(err)
+	}
+	if a.dryRunQueue != nil || slices.Contains(a.queues, dryRunQueue) {
+		t.Error("dry-run queue is used")
+	}
+	if _, ok := a.cancels[dryRunQueue]; ok {
+		t.Error("dry-run queue is not retired")
+	}
+	if !slices.Equal(a.queues, queue.Group{a.targets[0].hostQueue}) {
+		t.Errorf("invalid result %v", a.queues)
+	}
+}
+
+func TestApply_noOutput(t *testing.T) {
+	a, _ := testAgent(t)
+	dir := t.TempDir()
+	err := a.apply(testConfig(t, dir, `
+community: public
+targets:
+  - target: 192.0.2.1
+    mackerel: {host-id: host1, x-api-key: dummy}
+  - target: 192.0.2.2
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the target without mackerel is logged by the dry-run queue, not dropped.
+	if a.dryRunQueue == nil || !slices.Equal(a.targets[1].queues, queue.Group{a.dryRunQueue}) {
+		t.Errorf("invalid result %v", a.targets[1].queues)
+	}
+	if !slices.Equal(a.queues, queue.Group{a.targets[0].hostQueue, a.dryRunQueue}) {
+		t.Errorf("invalid result %v", a.queues)
+	}
+}
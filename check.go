@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/yseto/switch-traffic-to-mackerel/collector"
+	"github.com/yseto/switch-traffic-to-mackerel/config"
+	"github.com/yseto/switch-traffic-to-mackerel/mackerel"
+)
+
+var errNotSupported = errors.New("not supported by the device")
+
+// report prints results of checks as a table.
+type report struct {
+	w      *tabwriter.Writer
+	failed int
+}
+
+func newReport(w io.Writer) *report {
+	r := &report{w: tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)}
+	fmt.Fprintln(r.w, "RESULT\tTARGET\tCHECK\tDETAIL") // nolint
+	return r
+}
+
+func (r *report) add(target, check string, err error, detail string) {
+	result := "OK"
+	if err != nil {
+		result = "NG"
+		// yaml errors are multiline.
+		detail = strings.Join(strings.Fields(err.Error()), " ")
+		r.failed++
+	}
+	fmt.Fprintf(r.w, "%s\t%s\t%s\t%s\n", result, target, check, detail) // nolint
+}
+
+func (r *report) flush() error {
+	if err := r.w.Flush(); err != nil {
+		return err
+	}
+	if r.failed > 0 {
+		return fmt.Errorf("%d checks failed", r.failed)
+	}
+	return nil
+}
+
+// checkCommand validates the config, and asks devices and Mackerel whether it works.
+func checkCommand(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("check", flag.ExitOnError)
+	var filename string
+	fs.StringVar(&filename, "config", "config.yaml", "config `filename`")
+	fs.Parse(args) // nolint
+
+	r := newReport(os.Stdout)
+	c, err := config.Check(filename)
+	if err != nil {
+		r.add("-", "config", err, "")
+		return r.flush()
+	}
+	r.add("-", "config", nil, fmt.Sprintf("%s, %d targets", filename, len(c.Targets)))
+
+	for _, t := range c.Targets {
+		checkTarget(ctx, r, t)
+	}
+	if c.MackerelService != nil {
+		detail, err := mackerel.Check(c.MackerelService.ApiKey, "")
+		r.add("-", "mackerel-service", err, detail)
+	}
+	return r.flush()
+}
+
+func checkTarget(ctx context.Context, r *report, t *config.Target) {
+	p, err := collector.DoProbe(ctx, t)
+	if err != nil {
+		r.add(t.Target, "snmp", err, "")
+	} else {
+		// sysDescr is multiline on some devices.
+		descr, _, _ := strings.Cut(p.SysDescr, "\n")
+		r.add(t.Target, "snmp", nil, fmt.Sprintf("sysDescr %q, ifNumber %d", strings.TrimSpace(descr), p.IfNumber))
+
+		for _, m := range p.MIBs {
+			check := "mib " + m.Name
+			if m.Custom {
+				check = "custom-mib " + m.Name
+			}
+			var err error
+			if !m.Supported {
+				err = fmt.Errorf("%s is %w", m.OID, errNotSupported)
+			}
+			r.add(t.Target, check, err, m.OID)
+		}
+	}
+
+	if t.Mackerel != nil {
+		detail, err := mackerel.Check(t.Mackerel.ApiKey, t.Mackerel.HostID)
+		if err == nil && t.Mackerel.HostID == "" {
+			detail += ", host is created on start"
+		}
+		r.add(t.Target, "mackerel", err, detail)
+	}
+}
@@ -2,6 +2,11 @@ package collector
 
 import (
 	"context"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/yseto/switch-traffic-to-mackerel/config"
 	"github.com/yseto/switch-traffic-to-mackerel/mib"
@@ -10,17 +15,32 @@ import (
 
 type snmpClientImpl interface {
 	BulkWalk(oid string, length uint64) (map[uint64]uint64, error)
+	BulkWalkColumns(oids []string, length uint64) (map[string]map[uint64]uint64, error)
+	GetColumns(instances map[string][]uint64) (map[string]map[uint64]uint64, error)
 	BulkWalkGetInterfaceName(length uint64) (map[uint64]string, error)
+	BulkWalkGetInterfaceAlias(length uint64) (map[uint64]string, error)
 	BulkWalkGetInterfaceState(length uint64) (map[uint64]bool, error)
 	BulkWalkGetInterfaceIPAddress() (map[uint64][]string, error)
 	BulkWalkGetInterfacePhysAddress(length uint64) (map[uint64]string, error)
 	Close() error
 	GetInterfaceNumber() (uint64, error)
 	GetValues(mibs []string) ([]float64, error)
+	GetStrings(mibs []string) ([]string, error)
+	BulkWalkGetStrings(oid string) (map[uint64]string, error)
+	Exists(oids []string) ([]bool, error)
 }
 
-func Do(ctx context.Context, c *config.Config) ([]MetricsDutum, error) {
-	snmpClient, err := snmp.Init(ctx, c.Target, c.Community)
+func newClient(ctx context.Context, c *config.Target) (*snmp.SNMP, error) {
+	return snmp.Init(ctx, &snmp.Arg{
+		Host:      c.Host,
+		Port:      c.Port,
+		Transport: c.Transport,
+		Community: c.Community,
+	})
+}
+
+func Do(ctx context.Context, c *config.Target) ([]MetricsDutum, error) {
+	snmpClient, err := newClient(ctx, c)
 	if err != nil {
 		return nil, err
 	}
@@ -28,7 +48,7 @@ func Do(ctx context.Context, c *config.Config) ([]MetricsDutum, error) {
 	return do(ctx, snmpClient, c)
 }
 
-func do(ctx context.Context, snmpClient snmpClientImpl, c *config.Config) ([]MetricsDutum, error) {
+func do(ctx context.Context, snmpClient snmpClientImpl, c *config.Target) ([]MetricsDutum, error) {
 	ifNumber, err := snmpClient.GetInterfaceNumber()
 	if err != nil {
 		return nil, err
@@ -37,46 +57,90 @@ func do(ctx context.Context, snmpClient snmpClientImpl, c *config.Config) ([]Met
 	if err != nil {
 		return nil, err
 	}
+	ifAlias, err := snmpClient.BulkWalkGetInterfaceAlias(ifNumber)
+	if err != nil {
+		return nil, err
+	}
 
-	var ifOperStatus map[uint64]bool
-	if c.SkipDownLinkState {
-		ifOperStatus, err = snmpClient.BulkWalkGetInterfaceState(ifNumber)
-		if err != nil {
-			return nil, err
+	table := newIfTable(snmpClient, ifNumber)
+	entries, err := table.entries(ifDescr, ifAlias, c.SkipDownLinkState, filters(c)...)
+	if err != nil {
+		return nil, err
+	}
+
+	// ifIndexes by mib, columns which no interface needs are not fetched.
+	wanted := make(map[string]map[uint64]bool)
+	instances := make(map[string][]uint64)
+	var selectedNum int
+	for ifIndex, e := range entries {
+		if !selected(&c.Interface, c.SkipDownLinkState, e) {
+			continue
+		}
+		selectedNum++
+		for _, mibName := range interfaceMIBs(c, e) {
+			if wanted[mibName] == nil {
+				wanted[mibName] = make(map[uint64]bool)
+			}
+			wanted[mibName][ifIndex] = true
+			oid := mib.Oidmapping()[mibName]
+			instances[oid] = append(instances[oid], ifIndex)
 		}
 	}
+	if err := table.fetch(instances, selectedNum, len(entries)); err != nil {
+		return nil, err
+	}
 
 	metrics := make([]MetricsDutum, 0)
 
-	for _, mibName := range c.MIBs {
-		values, err := snmpClient.BulkWalk(mib.Oidmapping()[mibName], ifNumber)
+	for _, mibName := range c.AllMIBs() {
+		if len(wanted[mibName]) == 0 {
+			continue
+		}
+		values, err := table.column(mib.Oidmapping()[mibName])
 		if err != nil {
 			return nil, err
 		}
 
 		for ifIndex, value := range values {
-			ifName := ifDescr[ifIndex]
-			if c.IncludeRegexp != nil && !c.IncludeRegexp.MatchString(ifName) {
+			if !wanted[mibName][ifIndex] {
 				continue
 			}
+			e := entries[ifIndex]
+			metrics = append(metrics, MetricsDutum{IfIndex: ifIndex, Mib: mibName, IfName: e.ifDescr, IfAlias: e.ifAlias, Value: value})
+		}
+	}
+	return metrics, nil
+}
 
-			if c.ExcludeRegexp != nil && c.ExcludeRegexp.MatchString(ifName) {
-				continue
-			}
+// filters returns the filter of the target and ones of interface groups.
+func filters(c *config.Target) []*config.InterfaceFilter {
+	filters := []*config.InterfaceFilter{&c.Interface}
+	for _, g := range c.InterfaceGroups {
+		filters = append(filters, &g.Interface)
+	}
+	return filters
+}
 
-			// skip when down(2)
-			if c.SkipDownLinkState && !ifOperStatus[ifIndex] {
-				continue
-			}
+// interfaceMIBs returns mibs of the interface group of the interface, or mibs of the target.
+func interfaceMIBs(c *config.Target, e *ifEntry) []string {
+	if g := interfaceGroup(c, e); g != nil {
+		return g.MIBs
+	}
+	return c.MIBs
+}
 
-			metrics = append(metrics, MetricsDutum{IfIndex: ifIndex, Mib: mibName, IfName: ifName, Value: value})
+// interfaceGroup returns the first interface group matching the interface, nil when none matches.
+func interfaceGroup(c *config.Target, e *ifEntry) *config.InterfaceGroupFilter {
+	for _, g := range c.InterfaceGroups {
+		if selected(&g.Interface, false, e) {
+			return g
 		}
 	}
-	return metrics, nil
+	return nil
 }
 
-func DoInterfaceIPAddress(ctx context.Context, c *config.Config) ([]Interface, error) {
-	snmpClient, err := snmp.Init(ctx, c.Target, c.Community)
+func DoInterfaceIPAddress(ctx context.Context, c *config.Target) ([]Interface, error) {
+	snmpClient, err := newClient(ctx, c)
 	if err != nil {
 		return nil, err
 	}
@@ -84,7 +148,7 @@ func DoInterfaceIPAddress(ctx context.Context, c *config.Config) ([]Interface, e
 	return doInterfaceIPAddress(ctx, snmpClient, c)
 }
 
-func doInterfaceIPAddress(ctx context.Context, snmpClient snmpClientImpl, c *config.Config) ([]Interface, error) {
+func doInterfaceIPAddress(ctx context.Context, snmpClient snmpClientImpl, c *config.Target) ([]Interface, error) {
 	ifNumber, err := snmpClient.GetInterfaceNumber()
 	if err != nil {
 		return nil, err
@@ -105,13 +169,22 @@ func doInterfaceIPAddress(ctx context.Context, snmpClient snmpClientImpl, c *con
 	}
 
 	var interfaces []Interface
-	for ifIndex, ip := range ifIndexIP {
+	for ifIndex, addresses := range ifIndexIP {
 		if name, ok := ifDescr[ifIndex]; ok {
+			var ipv4, ipv6 []string
+			for _, address := range addresses {
+				if strings.Contains(address, ":") {
+					ipv6 = append(ipv6, address)
+				} else {
+					ipv4 = append(ipv4, address)
+				}
+			}
 			phy := ifPhysAddress[ifIndex]
 			interfaces = append(interfaces, Interface{
-				IfName:     name,
-				IpAddress:  ip,
-				MacAddress: phy,
+				IfName:      name,
+				IpAddress:   ipv4,
+				IPv6Address: ipv6,
+				MacAddress:  phy,
 			})
 		}
 	}
@@ -120,8 +193,8 @@ func doInterfaceIPAddress(ctx context.Context, snmpClient snmpClientImpl, c *con
 }
 
 // mib:value
-func DoCustomMIBs(ctx context.Context, c *config.Config) (map[string]float64, error) {
-	snmpClient, err := snmp.Init(ctx, c.Target, c.Community)
+func DoCustomMIBs(ctx context.Context, c *config.Target) (map[string]float64, error) {
+	snmpClient, err := newClient(ctx, c)
 	if err != nil {
 		return nil, err
 	}
@@ -130,7 +203,7 @@ func DoCustomMIBs(ctx context.Context, c *config.Config) (map[string]float64, er
 }
 
 // mib:value
-func doCustomMIBs(ctx context.Context, snmpClient snmpClientImpl, c *config.Config) (map[string]float64, error) {
+func doCustomMIBs(ctx context.Context, snmpClient snmpClientImpl, c *config.Target) (map[string]float64, error) {
 	values, err := snmpClient.GetValues(c.CustomMIBs)
 	if err != nil {
 		return nil, err
@@ -141,3 +214,93 @@ func doCustomMIBs(ctx context.Context, snmpClient snmpClientImpl, c *config.Conf
 	}
 	return result, nil
 }
+
+func DoSystemInfo(ctx context.Context, c *config.Target) (*SystemInfo, error) {
+	snmpClient, err := newClient(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	defer snmpClient.Close()
+	return doSystemInfo(ctx, snmpClient, c)
+}
+
+func doSystemInfo(ctx context.Context, snmpClient snmpClientImpl, c *config.Target) (*SystemInfo, error) {
+	values, err := snmpClient.GetStrings([]string{
+		snmp.MIBsysName,
+		snmp.MIBsysObjectID,
+		snmp.MIBsysDescr,
+		snmp.MIBsysLocation,
+		snmp.MIBsysContact,
+		snmp.MIBsysUpTime,
+	})
+	if err != nil {
+		return nil, err
+	}
+	// fields which the agent does not answer are empty.
+	if len(values) < 6 {
+		values = append(values, make([]string, 6-len(values))...)
+	}
+	// TimeTicks, hundredths of a second.
+	upTime, _ := strconv.ParseUint(values[5], 10, 64)
+
+	info := &SystemInfo{
+		SysName:     values[0],
+		SysObjectID: values[1],
+		SysDescr:    values[2],
+		SysLocation: values[3],
+		SysContact:  values[4],
+		SysUpTime:   time.Duration(upTime) * 10 * time.Millisecond,
+	}
+
+	// many devices do not support ENTITY-MIB, the system group is kept.
+	entity, err := doEntity(snmpClient)
+	if err != nil {
+		slog.Warn("entity failed", "phase", "inventory", "target", c.Target, "error", err)
+		return info, nil
+	}
+	info.Entity = entity
+	return info, nil
+}
+
+// chassisClass is entPhysicalClass chassis(3).
+const chassisClass = 3
+
+// doEntity returns the chassis of ENTITY-MIB, nil when the device does not support it.
+func doEntity(snmpClient snmpClientImpl) (*Entity, error) {
+	class, err := snmpClient.BulkWalk(snmp.MIBentPhysicalClass, 0)
+	if err != nil {
+		return nil, err
+	}
+	var indexes []uint64
+	for index, v := range class {
+		if v == chassisClass {
+			indexes = append(indexes, index)
+		}
+	}
+	if len(indexes) == 0 {
+		return nil, nil
+	}
+	// the first chassis is the stack master on most devices.
+	index := slices.Min(indexes)
+
+	columns := []string{
+		snmp.MIBentPhysicalSerialNum,
+		snmp.MIBentPhysicalModelName,
+		snmp.MIBentPhysicalFirmwareRev,
+		snmp.MIBentPhysicalSoftwareRev,
+	}
+	values := make([]string, len(columns))
+	for i := range columns {
+		kv, err := snmpClient.BulkWalkGetStrings(columns[i])
+		if err != nil {
+			return nil, err
+		}
+		values[i] = kv[index]
+	}
+	return &Entity{
+		SerialNum:   values[0],
+		ModelName:   values[1],
+		FirmwareRev: values[2],
+		SoftwareRev: values[3],
+	}, nil
+}
@@ -7,6 +7,7 @@ import (
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
@@ -15,6 +16,14 @@ import (
 )
 
 type mockSnmpClient struct {
+	// unused are ifIndexes which have not carried traffic.
+	unused []uint64
+	// gets are instances requested by GetColumns, walks are columns walked by BulkWalkColumns.
+	gets  map[string][]uint64
+	walks []string
+	// noEntity fails walks of ENTITY-MIB, and sysValues limits the number of values of GetStrings.
+	noEntity  bool
+	sysValues int
 }
 
 var errInvalid = errors.New("invalid error")
@@ -22,23 +31,116 @@ var errInvalid = errors.New("invalid error")
 func (m *mockSnmpClient) BulkWalk(oid string, length uint64) (map[uint64]uint64, error) {
 	switch oid {
 	case "1.3.6.1.2.1.31.1.1.1.6":
-		return map[uint64]uint64{
+		return m.octets(map[uint64]uint64{
 			1: 60,
 			2: 60,
 			3: 60,
 			4: 60,
-		}, nil
+		}), nil
 	case "1.3.6.1.2.1.31.1.1.1.10":
-		return map[uint64]uint64{
+		return m.octets(map[uint64]uint64{
 			1: 120,
 			2: 120,
 			3: 120,
 			4: 120,
+		}), nil
+	case "1.3.6.1.2.1.2.2.1.3":
+		return map[uint64]uint64{
+			1: 24,
+			2: 6,
+			3: 161,
+			4: 6,
+		}, nil
+	case "1.3.6.1.2.1.47.1.1.1.1.5":
+		if m.noEntity {
+			return nil, errInvalid
+		}
+		return map[uint64]uint64{
+			1:    3,
+			1001: 10,
+		}, nil
+	case "1.3.6.1.2.1.31.1.1.1.15":
+		return map[uint64]uint64{
+			1: 0,
+			2: 1000,
+			3: 10000,
+			4: 1000,
+		}, nil
+	case "1.3.6.1.2.1.2.2.1.8":
+		return map[uint64]uint64{
+			1: 1,
+			2: 2,
+			3: 1,
+			4: 7,
+		}, nil
+	case "1.3.6.1.2.1.2.2.1.7":
+		return map[uint64]uint64{
+			1: 1,
+			2: 2,
+			3: 1,
+			4: 1,
 		}, nil
 	default:
 		return nil, errInvalid
 	}
 }
+func (m *mockSnmpClient) BulkWalkColumns(oids []string, length uint64) (map[string]map[uint64]uint64, error) {
+	columns := make(map[string]map[uint64]uint64, len(oids))
+	for _, oid := range oids {
+		values, err := m.BulkWalk(oid, length)
+		if err != nil {
+			return nil, err
+		}
+		columns[oid] = values
+		m.walks = append(m.walks, oid)
+	}
+	return columns, nil
+}
+
+func (m *mockSnmpClient) GetColumns(instances map[string][]uint64) (map[string]map[uint64]uint64, error) {
+	columns := make(map[string]map[uint64]uint64, len(instances))
+	for oid, ifIndexes := range instances {
+		values, err := m.BulkWalk(oid, 0)
+		if err != nil {
+			return nil, err
+		}
+		columns[oid] = make(map[uint64]uint64)
+		for _, ifIndex := range ifIndexes {
+			if v, ok := values[ifIndex]; ok {
+				columns[oid][ifIndex] = v
+			}
+		}
+		if m.gets == nil {
+			m.gets = make(map[string][]uint64)
+		}
+		m.gets[oid] = append(m.gets[oid], ifIndexes...)
+	}
+	return columns, nil
+}
+
+func (m *mockSnmpClient) octets(values map[uint64]uint64) map[uint64]uint64 {
+	for _, ifIndex := range m.unused {
+		values[ifIndex] = 0
+	}
+	return values
+}
+
+func (m *mockSnmpClient) BulkWalkGetStrings(oid string) (map[uint64]string, error) {
+	switch oid {
+	case "1.3.6.1.2.1.31.1.1.1.1":
+		return map[uint64]string{1: "lo0", 2: "Gi0/1", 3: "Gi0/2", 4: "Gi0/3"}, nil
+	case "1.3.6.1.2.1.47.1.1.1.1.11":
+		return map[uint64]string{1: "FOC1234X0AB", 1001: "ABC0001"}, nil
+	case "1.3.6.1.2.1.47.1.1.1.1.13":
+		return map[uint64]string{1: "WS-C2960X-24TS-L", 1001: "GLC-T"}, nil
+	case "1.3.6.1.2.1.47.1.1.1.1.9":
+		return map[uint64]string{1: "12.2(55r)SE", 1001: ""}, nil
+	case "1.3.6.1.2.1.47.1.1.1.1.10":
+		return map[uint64]string{1: "15.2(7)E4", 1001: ""}, nil
+	default:
+		return nil, errInvalid
+	}
+}
 func (m *mockSnmpClient) BulkWalkGetInterfaceName(length uint64) (map[uint64]string, error) {
 	return map[uint64]string{
 		1: "lo0",
@@ -47,6 +149,11 @@ func (m *mockSnmpClient) BulkWalkGetInterfaceName(length uint64) (map[uint64]str
 		4: "eth2",
 	}, nil
 }
+func (m *mockSnmpClient) BulkWalkGetInterfaceAlias(length uint64) (map[uint64]string, error) {
+	return map[uint64]string{
+		3: "uplink",
+	}, nil
+}
 func (m *mockSnmpClient) BulkWalkGetInterfaceState(length uint64) (map[uint64]bool, error) {
 	return map[uint64]bool{
 		1: true,
@@ -66,7 +173,7 @@ func (m *mockSnmpClient) BulkWalkGetInterfaceIPAddress() (map[uint64][]string, e
 	return map[uint64][]string{
 		1: {"127.0.0.1"},
 		2: {"192.0.2.1"},
-		3: {"192.0.2.2", "192.0.2.3"},
+		3: {"192.0.2.2", "192.0.2.3", "2001:db8::1"},
 		4: {"198.51.100.1"},
 		5: {"198.51.100.2"},
 	}, nil
@@ -89,11 +196,38 @@ func (m *mockSnmpClient) GetValues(mibs []string) ([]float64, error) {
 	return values, nil
 }
 
+func (m *mockSnmpClient) GetStrings(mibs []string) ([]string, error) {
+	values := map[string]string{
+		"1.3.6.1.2.1.1.2.0": "1.3.6.1.4.1.9.1.1",
+		"1.3.6.1.2.1.1.5.0": "sw1",
+		"1.3.6.1.2.1.1.1.0": "Cisco IOS Software",
+		"1.3.6.1.2.1.1.6.0": "rack 1",
+		"1.3.6.1.2.1.1.4.0": "noc@example.com",
+		"1.3.6.1.2.1.1.3.0": "12345",
+	}
+	var result []string
+	for _, mib := range mibs {
+		result = append(result, values[mib])
+	}
+	if m.sysValues > 0 {
+		result = result[:m.sysValues]
+	}
+	return result, nil
+}
+
+func (m *mockSnmpClient) Exists(oids []string) ([]bool, error) {
+	var exists []bool
+	for _, oid := range oids {
+		exists = append(exists, !strings.HasPrefix(oid, "1.2.3.4.9."))
+	}
+	return exists, nil
+}
+
 func TestDo(t *testing.T) {
 	ctx := context.Background()
 
 	t.Run("non skip", func(t *testing.T) {
-		c := &config.Config{
+		c := &config.Target{
 			MIBs: []string{"ifHCInOctets", "ifHCOutOctets"},
 		}
 		actual, err := do(ctx, &mockSnmpClient{}, c)
@@ -103,11 +237,11 @@ func TestDo(t *testing.T) {
 		expected := []MetricsDutum{
 			{IfIndex: 1, Mib: "ifHCInOctets", IfName: "lo0", Value: 60},
 			{IfIndex: 2, Mib: "ifHCInOctets", IfName: "eth0", Value: 60},
-			{IfIndex: 3, Mib: "ifHCInOctets", IfName: "eth1", Value: 60},
+			{IfIndex: 3, Mib: "ifHCInOctets", IfName: "eth1", IfAlias: "uplink", Value: 60},
 			{IfIndex: 4, Mib: "ifHCInOctets", IfName: "eth2", Value: 60},
 			{IfIndex: 1, Mib: "ifHCOutOctets", IfName: "lo0", Value: 120},
 			{IfIndex: 2, Mib: "ifHCOutOctets", IfName: "eth0", Value: 120},
-			{IfIndex: 3, Mib: "ifHCOutOctets", IfName: "eth1", Value: 120},
+			{IfIndex: 3, Mib: "ifHCOutOctets", IfName: "eth1", IfAlias: "uplink", Value: 120},
 			{IfIndex: 4, Mib: "ifHCOutOctets", IfName: "eth2", Value: 120},
 		}
 		if d := cmp.Diff(
@@ -120,9 +254,9 @@ func TestDo(t *testing.T) {
 	})
 
 	t.Run("skip include", func(t *testing.T) {
-		c := &config.Config{
-			MIBs:          []string{"ifHCInOctets", "ifHCOutOctets"},
-			IncludeRegexp: regexp.MustCompile("lo?"),
+		c := &config.Target{
+			MIBs:      []string{"ifHCInOctets", "ifHCOutOctets"},
+			Interface: config.InterfaceFilter{Include: []*regexp.Regexp{regexp.MustCompile("lo?")}},
 		}
 		actual, err := do(ctx, &mockSnmpClient{}, c)
 		if err != nil {
@@ -141,18 +275,18 @@ func TestDo(t *testing.T) {
 		}
 	})
 	t.Run("skip exclude", func(t *testing.T) {
-		c := &config.Config{
-			MIBs:          []string{"ifHCInOctets", "ifHCOutOctets"},
-			ExcludeRegexp: regexp.MustCompile("0$"),
+		c := &config.Target{
+			MIBs:      []string{"ifHCInOctets", "ifHCOutOctets"},
+			Interface: config.InterfaceFilter{Exclude: []*regexp.Regexp{regexp.MustCompile("0$")}},
 		}
 		actual, err := do(ctx, &mockSnmpClient{}, c)
 		if err != nil {
 			t.Error("invalid raised error")
 		}
 		expected := []MetricsDutum{
-			{IfIndex: 3, Mib: "ifHCInOctets", IfName: "eth1", Value: 60},
+			{IfIndex: 3, Mib: "ifHCInOctets", IfName: "eth1", IfAlias: "uplink", Value: 60},
 			{IfIndex: 4, Mib: "ifHCInOctets", IfName: "eth2", Value: 60},
-			{IfIndex: 3, Mib: "ifHCOutOctets", IfName: "eth1", Value: 120},
+			{IfIndex: 3, Mib: "ifHCOutOctets", IfName: "eth1", IfAlias: "uplink", Value: 120},
 			{IfIndex: 4, Mib: "ifHCOutOctets", IfName: "eth2", Value: 120},
 		}
 		if d := cmp.Diff(
@@ -165,7 +299,7 @@ func TestDo(t *testing.T) {
 	})
 
 	t.Run("skip down-linkstate", func(t *testing.T) {
-		c := &config.Config{
+		c := &config.Target{
 			MIBs:              []string{"ifHCInOctets", "ifHCOutOctets"},
 			SkipDownLinkState: true,
 		}
@@ -175,10 +309,10 @@ func TestDo(t *testing.T) {
 		}
 		expected := []MetricsDutum{
 			{IfIndex: 1, Mib: "ifHCInOctets", IfName: "lo0", Value: 60},
-			{IfIndex: 3, Mib: "ifHCInOctets", IfName: "eth1", Value: 60},
+			{IfIndex: 3, Mib: "ifHCInOctets", IfName: "eth1", IfAlias: "uplink", Value: 60},
 			{IfIndex: 4, Mib: "ifHCInOctets", IfName: "eth2", Value: 60},
 			{IfIndex: 1, Mib: "ifHCOutOctets", IfName: "lo0", Value: 120},
-			{IfIndex: 3, Mib: "ifHCOutOctets", IfName: "eth1", Value: 120},
+			{IfIndex: 3, Mib: "ifHCOutOctets", IfName: "eth1", IfAlias: "uplink", Value: 120},
 			{IfIndex: 4, Mib: "ifHCOutOctets", IfName: "eth2", Value: 120},
 		}
 		if d := cmp.Diff(
@@ -190,11 +324,210 @@ func TestDo(t *testing.T) {
 		}
 	})
 
+	filters := []struct {
+		name     string
+		filter   config.InterfaceFilter
+		unused   []uint64
+		expected []uint64
+	}{
+		{
+			name: "include and exclude",
+			filter: config.InterfaceFilter{
+				Include: []*regexp.Regexp{regexp.MustCompile("^eth"), regexp.MustCompile("^lo")},
+				Exclude: []*regexp.Regexp{regexp.MustCompile("^eth0$")},
+			},
+			expected: []uint64{1, 3, 4},
+		},
+		{
+			name: "alias",
+			filter: config.InterfaceFilter{
+				IncludeAlias: []*regexp.Regexp{regexp.MustCompile("^up")},
+			},
+			expected: []uint64{3},
+		},
+		{
+			name: "exclude alias",
+			filter: config.InterfaceFilter{
+				ExcludeAlias: []*regexp.Regexp{regexp.MustCompile("link")},
+			},
+			expected: []uint64{1, 2, 4},
+		},
+		{
+			name: "ifIndex",
+			filter: config.InterfaceFilter{
+				IfIndex: []config.IndexRange{{From: 2, To: 3}, {From: 10, To: 10}},
+			},
+			expected: []uint64{2, 3},
+		},
+		{
+			name: "ifType",
+			filter: config.InterfaceFilter{
+				IfType: []uint64{6, 161},
+			},
+			expected: []uint64{2, 3, 4},
+		},
+		{
+			name: "speed",
+			filter: config.InterfaceFilter{
+				MinSpeed: 1000,
+				MaxSpeed: 1000,
+			},
+			expected: []uint64{2, 4},
+		},
+		{
+			name: "skip unused",
+			filter: config.InterfaceFilter{
+				SkipUnused: true,
+			},
+			unused:   []uint64{2, 4},
+			expected: []uint64{1, 3},
+		},
+	}
+	for _, tc := range filters {
+		t.Run(tc.name, func(t *testing.T) {
+			c := &config.Target{
+				MIBs:      []string{"ifHCInOctets"},
+				Interface: tc.filter,
+			}
+			actual, err := do(ctx, &mockSnmpClient{unused: tc.unused}, c)
+			if err != nil {
+				t.Error(err)
+			}
+			var ifIndexes []uint64
+			for _, m := range actual {
+				ifIndexes = append(ifIndexes, m.IfIndex)
+			}
+			if d := cmp.Diff(
+				ifIndexes,
+				tc.expected,
+				cmpopts.SortSlices(func(i, j uint64) bool { return i < j }),
+			); d != "" {
+				t.Errorf("invalid result %s", d)
+			}
+		})
+	}
+}
+
+func TestDo_interfaceGroups(t *testing.T) {
+	ctx := context.Background()
+	c := &config.Target{
+		// the mock does not have ifInErrors, it is not walked as no interface needs it.
+		MIBs: []string{"ifInErrors"},
+		InterfaceGroups: []*config.InterfaceGroupFilter{
+			{
+				Name:      "uplinks",
+				Interface: config.InterfaceFilter{IncludeAlias: []*regexp.Regexp{regexp.MustCompile("uplink")}},
+				MIBs:      []string{"ifHCInOctets", "ifHCOutOctets"},
+			},
+			{
+				Name:      "access",
+				Interface: config.InterfaceFilter{IfType: []uint64{6, 24}},
+				MIBs:      []string{"ifHCInOctets"},
+			},
+		},
+		Interface: config.InterfaceFilter{Exclude: []*regexp.Regexp{regexp.MustCompile("^lo")}},
+	}
+	actual, err := do(ctx, &mockSnmpClient{}, c)
+	if err != nil {
+		t.Error(err)
+	}
+	expected := []MetricsDutum{
+		{IfIndex: 2, Mib: "ifHCInOctets", IfName: "eth0", Value: 60},
+		{IfIndex: 3, Mib: "ifHCInOctets", IfName: "eth1", IfAlias: "uplink", Value: 60},
+		{IfIndex: 4, Mib: "ifHCInOctets", IfName: "eth2", Value: 60},
+		{IfIndex: 3, Mib: "ifHCOutOctets", IfName: "eth1", IfAlias: "uplink", Value: 120},
+	}
+	if d := cmp.Diff(
+		actual,
+		expected,
+		cmpopts.SortSlices(func(i, j MetricsDutum) bool { return i.String() < j.String() }),
+	); d != "" {
+		t.Errorf("invalid result %s", d)
+	}
+
+	// interfaces matching no group are collected with mibs of the target.
+	c.InterfaceGroups = c.InterfaceGroups[:1]
+	if _, err = do(ctx, &mockSnmpClient{}, c); !errors.Is(err, errInvalid) {
+		t.Errorf("ifInErrors is not walked %v", err)
+	}
+}
+
+func TestDo_fetch(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name     string
+		filter   config.InterfaceFilter
+		gets     map[string][]uint64
+		walks    []string
+		expected []MetricsDutum
+	}{
+		{
+			name:   "few interfaces by GET",
+			filter: config.InterfaceFilter{IncludeAlias: []*regexp.Regexp{regexp.MustCompile("uplink")}},
+			gets: map[string][]uint64{
+				"1.3.6.1.2.1.31.1.1.1.6":  {3},
+				"1.3.6.1.2.1.31.1.1.1.10": {3},
+			},
+			expected: []MetricsDutum{
+				{IfIndex: 3, Mib: "ifHCInOctets", IfName: "eth1", IfAlias: "uplink", Value: 60},
+				{IfIndex: 3, Mib: "ifHCOutOctets", IfName: "eth1", IfAlias: "uplink", Value: 120},
+			},
+		},
+		{
+			name:   "many interfaces by walking",
+			filter: config.InterfaceFilter{IfIndex: []config.IndexRange{{From: 3, To: 4}}},
+			walks:  []string{"1.3.6.1.2.1.31.1.1.1.10", "1.3.6.1.2.1.31.1.1.1.6"},
+			expected: []MetricsDutum{
+				{IfIndex: 3, Mib: "ifHCInOctets", IfName: "eth1", IfAlias: "uplink", Value: 60},
+				{IfIndex: 4, Mib: "ifHCInOctets", IfName: "eth2", Value: 60},
+				{IfIndex: 3, Mib: "ifHCOutOctets", IfName: "eth1", IfAlias: "uplink", Value: 120},
+				{IfIndex: 4, Mib: "ifHCOutOctets", IfName: "eth2", Value: 120},
+			},
+		},
+		{
+			name: "columns walked to choose interfaces are not fetched again",
+			filter: config.InterfaceFilter{
+				IncludeAlias: []*regexp.Regexp{regexp.MustCompile("uplink")},
+				SkipUnused:   true,
+			},
+			walks: []string{"1.3.6.1.2.1.31.1.1.1.10", "1.3.6.1.2.1.31.1.1.1.6"},
+			expected: []MetricsDutum{
+				{IfIndex: 3, Mib: "ifHCInOctets", IfName: "eth1", IfAlias: "uplink", Value: 60},
+				{IfIndex: 3, Mib: "ifHCOutOctets", IfName: "eth1", IfAlias: "uplink", Value: 120},
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			c := &config.Target{
+				MIBs:      []string{"ifHCInOctets", "ifHCOutOctets"},
+				Interface: tc.filter,
+			}
+			m := &mockSnmpClient{}
+			actual, err := do(ctx, m, c)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if d := cmp.Diff(
+				actual,
+				tc.expected,
+				cmpopts.SortSlices(func(i, j MetricsDutum) bool { return i.String() < j.String() }),
+			); d != "" {
+				t.Errorf("invalid result %s", d)
+			}
+			if d := cmp.Diff(m.gets, tc.gets); d != "" {
+				t.Errorf("invalid result %s", d)
+			}
+			if d := cmp.Diff(m.walks, tc.walks, cmpopts.SortSlices(func(i, j string) bool { return i < j })); d != "" {
+				t.Errorf("invalid result %s", d)
+			}
+		})
+	}
 }
 
 func TestDoInterfaceIPAddress(t *testing.T) {
 	ctx := context.Background()
-	c := &config.Config{}
+	c := &config.Target{}
 	actual, err := doInterfaceIPAddress(ctx, &mockSnmpClient{}, c)
 	if err != nil {
 		t.Error("invalid raised error")
@@ -206,9 +539,10 @@ func TestDoInterfaceIPAddress(t *testing.T) {
 			MacAddress: "00:00:87:12:34:56",
 		},
 		{
-			IfName:     "eth1",
-			IpAddress:  []string{"192.0.2.2", "192.0.2.3"},
-			MacAddress: "00:00:4C:23:45:67",
+			IfName:      "eth1",
+			IpAddress:   []string{"192.0.2.2", "192.0.2.3"},
+			IPv6Address: []string{"2001:db8::1"},
+			MacAddress:  "00:00:4C:23:45:67",
 		},
 		{
 			IfName:     "eth2",
@@ -231,7 +565,7 @@ func TestDoInterfaceIPAddress(t *testing.T) {
 
 func TestDoCustomMIBs(t *testing.T) {
 	ctx := context.Background()
-	c := &config.Config{
+	c := &config.Target{
 		CustomMIBs: []string{"1.2.3.4.5.678901", "1.2.3.4.6.789012"},
 	}
 	actual, err := doCustomMIBs(ctx, &mockSnmpClient{}, c)
@@ -249,3 +583,43 @@ func TestDoCustomMIBs(t *testing.T) {
 		t.Errorf("invalid result %s", d)
 	}
 }
+
+func TestDoSystemInfo(t *testing.T) {
+	ctx := context.Background()
+	c := &config.Target{}
+	actual, err := doSystemInfo(ctx, &mockSnmpClient{}, c)
+	if err != nil {
+		t.Error("invalid raised error")
+	}
+	expected := &SystemInfo{
+		SysName:     "sw1",
+		SysObjectID: "1.3.6.1.4.1.9.1.1",
+		SysDescr:    "Cisco IOS Software",
+		SysLocation: "rack 1",
+		SysContact:  "noc@example.com",
+		SysUpTime:   123450 * time.Millisecond,
+		Entity: &Entity{
+			SerialNum:   "FOC1234X0AB",
+			ModelName:   "WS-C2960X-24TS-L",
+			FirmwareRev: "12.2(55r)SE",
+			SoftwareRev: "15.2(7)E4",
+		},
+	}
+	if d := cmp.Diff(actual, expected); d != "" {
+		t.Errorf("invalid result %s", d)
+	}
+
+	t.Run("partial system group, without ENTITY-MIB", func(t *testing.T) {
+		actual, err := doSystemInfo(ctx, &mockSnmpClient{noEntity: true, sysValues: 2}, c)
+		if err != nil {
+			t.Error("invalid raised error")
+		}
+		expected := &SystemInfo{
+			SysName:     "sw1",
+			SysObjectID: "1.3.6.1.4.1.9.1.1",
+		}
+		if d := cmp.Diff(actual, expected); d != "" {
+			t.Errorf("invalid result %s", d)
+		}
+	})
+}
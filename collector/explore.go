@@ -0,0 +1,169 @@
+package collector
+
+import (
+	"cmp"
+	"context"
+	"slices"
+
+	"github.com/yseto/switch-traffic-to-mackerel/config"
+	"github.com/yseto/switch-traffic-to-mackerel/mib"
+	"github.com/yseto/switch-traffic-to-mackerel/snmp"
+)
+
+// Walk calls walkFn for each value in the subtree of oid on the target.
+func Walk(ctx context.Context, c *config.Target, oid string, walkFn func(snmp.Variable) error) error {
+	snmpClient, err := newClient(ctx, c)
+	if err != nil {
+		return err
+	}
+	defer snmpClient.Close()
+	return snmpClient.Walk(oid, walkFn)
+}
+
+// DoInterfaces returns all interfaces of the target, and whether each is collected.
+func DoInterfaces(ctx context.Context, c *config.Target) ([]InterfaceStatus, error) {
+	snmpClient, err := newClient(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	defer snmpClient.Close()
+	return doInterfaces(ctx, snmpClient, c)
+}
+
+func doInterfaces(ctx context.Context, snmpClient snmpClientImpl, c *config.Target) ([]InterfaceStatus, error) {
+	ifNumber, err := snmpClient.GetInterfaceNumber()
+	if err != nil {
+		return nil, err
+	}
+	ifDescr, err := snmpClient.BulkWalkGetInterfaceName(ifNumber)
+	if err != nil {
+		return nil, err
+	}
+	ifAlias, err := snmpClient.BulkWalkGetInterfaceAlias(ifNumber)
+	if err != nil {
+		return nil, err
+	}
+	// IF-MIB ifXTable is optional, such as ifName.
+	ifName, _ := snmpClient.BulkWalkGetStrings(snmp.MIBifName)
+	ifHighSpeed, _ := snmpClient.BulkWalk(snmp.MIBifHighSpeed, ifNumber)
+	ifType, _ := snmpClient.BulkWalk(snmp.MIBifType, ifNumber)
+
+	table := newIfTable(snmpClient, ifNumber)
+	if err := table.prefetch(snmp.MIBifOperStatus, snmp.MIBifAdminStatus); err != nil {
+		return nil, err
+	}
+	ifOperStatus, err := table.column(snmp.MIBifOperStatus)
+	if err != nil {
+		return nil, err
+	}
+	ifAdminStatus, err := table.column(snmp.MIBifAdminStatus)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := table.entries(ifDescr, ifAlias, c.SkipDownLinkState, filters(c)...)
+	if err != nil {
+		return nil, err
+	}
+
+	interfaces := make([]InterfaceStatus, 0, len(ifDescr))
+	for ifIndex, descr := range ifDescr {
+		var group string
+		if g := interfaceGroup(c, entries[ifIndex]); g != nil {
+			group = g.Name
+		}
+		interfaces = append(interfaces, InterfaceStatus{
+			IfIndex:     ifIndex,
+			IfDescr:     descr,
+			IfName:      ifName[ifIndex],
+			IfAlias:     ifAlias[ifIndex],
+			IfType:      mib.IfTypeName(ifType[ifIndex]),
+			Speed:       ifHighSpeed[ifIndex],
+			OperStatus:  ifStatus(ifOperStatus[ifIndex]),
+			AdminStatus: ifStatus(ifAdminStatus[ifIndex]),
+			Selected:    selected(&c.Interface, c.SkipDownLinkState, entries[ifIndex]),
+			Group:       group,
+		})
+	}
+	slices.SortFunc(interfaces, func(a, b InterfaceStatus) int {
+		return cmp.Compare(a.IfIndex, b.IfIndex)
+	})
+	return interfaces, nil
+}
+
+var ifStatusNames = map[uint64]string{
+	1: "up",
+	2: "down",
+	3: "testing",
+	4: "unknown",
+	5: "dormant",
+	6: "notPresent",
+	7: "lowerLayerDown",
+}
+
+func ifStatus(v uint64) string {
+	if name, ok := ifStatusNames[v]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+// Probe is the result of asking the device for the config.
+type Probe struct {
+	SysDescr string
+	IfNumber uint64
+	MIBs     []MIBSupport
+}
+
+// MIBSupport is whether the device has values of the mib.
+// custom mibs are named by metric names.
+type MIBSupport struct {
+	Name      string
+	OID       string
+	Custom    bool
+	Supported bool
+}
+
+// DoProbe gets sysDescr and ifNumber, and checks the mibs of the target are supported.
+func DoProbe(ctx context.Context, c *config.Target) (*Probe, error) {
+	snmpClient, err := newClient(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	defer snmpClient.Close()
+	return doProbe(ctx, snmpClient, c)
+}
+
+func doProbe(ctx context.Context, snmpClient snmpClientImpl, c *config.Target) (*Probe, error) {
+	values, err := snmpClient.GetStrings([]string{snmp.MIBsysDescr})
+	if err != nil {
+		return nil, err
+	}
+	ifNumber, err := snmpClient.GetInterfaceNumber()
+	if err != nil {
+		return nil, err
+	}
+	p := &Probe{SysDescr: values[0], IfNumber: ifNumber}
+
+	for _, name := range c.AllMIBs() {
+		oid := mib.Oidmapping()[name]
+		// a column without values, or with values not counters, is not supported.
+		kv, err := snmpClient.BulkWalk(oid, ifNumber)
+		p.MIBs = append(p.MIBs, MIBSupport{Name: name, OID: oid, Supported: err == nil && len(kv) > 0})
+	}
+
+	if len(c.CustomMIBs) == 0 {
+		return p, nil
+	}
+	names := make(map[string]string, len(c.CustomMIBmetricNameMappedMIBs))
+	for name, oid := range c.CustomMIBmetricNameMappedMIBs {
+		names[oid] = name
+	}
+	exists, err := snmpClient.Exists(c.CustomMIBs)
+	if err != nil {
+		return nil, err
+	}
+	for i, oid := range c.CustomMIBs {
+		p.MIBs = append(p.MIBs, MIBSupport{Name: names[oid], OID: oid, Custom: true, Supported: exists[i]})
+	}
+	return p, nil
+}
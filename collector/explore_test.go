@@ -0,0 +1,61 @@
+package collector
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/yseto/switch-traffic-to-mackerel/config"
+)
+
+func TestDoInterfaces(t *testing.T) {
+	ctx := context.Background()
+	c := &config.Target{
+		Interface:         config.InterfaceFilter{Exclude: []*regexp.Regexp{regexp.MustCompile("^lo")}},
+		SkipDownLinkState: true,
+	}
+	actual, err := doInterfaces(ctx, &mockSnmpClient{}, c)
+	if err != nil {
+		t.Error("invalid raised error")
+	}
+	expected := []InterfaceStatus{
+		{IfIndex: 1, IfDescr: "lo0", IfName: "lo0", IfType: "softwareLoopback", OperStatus: "up", AdminStatus: "up"},
+		{IfIndex: 2, IfDescr: "eth0", IfName: "Gi0/1", IfType: "ethernetCsmacd", Speed: 1000, OperStatus: "down", AdminStatus: "down"},
+		{IfIndex: 3, IfDescr: "eth1", IfName: "Gi0/2", IfAlias: "uplink", IfType: "ieee8023adLag", Speed: 10000, OperStatus: "up", AdminStatus: "up", Selected: true},
+		{IfIndex: 4, IfDescr: "eth2", IfName: "Gi0/3", IfType: "ethernetCsmacd", Speed: 1000, OperStatus: "lowerLayerDown", AdminStatus: "up", Selected: true},
+	}
+	if d := cmp.Diff(actual, expected); d != "" {
+		t.Errorf("invalid result %s", d)
+	}
+}
+
+func TestDoProbe(t *testing.T) {
+	ctx := context.Background()
+	c := &config.Target{
+		MIBs:       []string{"ifHCInOctets", "ifInErrors"},
+		CustomMIBs: []string{"1.2.3.4.5.678901", "1.2.3.4.9.1"},
+		CustomMIBmetricNameMappedMIBs: map[string]string{
+			"temperature": "1.2.3.4.5.678901",
+			"fan":         "1.2.3.4.9.1",
+		},
+	}
+	actual, err := doProbe(ctx, &mockSnmpClient{}, c)
+	if err != nil {
+		t.Error("invalid raised error")
+	}
+	expected := &Probe{
+		SysDescr: "Cisco IOS Software",
+		IfNumber: 4,
+		MIBs: []MIBSupport{
+			{Name: "ifHCInOctets", OID: "1.3.6.1.2.1.31.1.1.1.6", Supported: true},
+			{Name: "ifInErrors", OID: "1.3.6.1.2.1.2.2.1.14"},
+			{Name: "temperature", OID: "1.2.3.4.5.678901", Custom: true, Supported: true},
+			{Name: "fan", OID: "1.2.3.4.9.1", Custom: true},
+		},
+	}
+	if d := cmp.Diff(actual, expected); d != "" {
+		t.Errorf("invalid result %s", d)
+	}
+}
@@ -0,0 +1,236 @@
+package collector
+
+import (
+	"regexp"
+	"slices"
+
+	"golang.org/x/exp/maps"
+
+	"github.com/yseto/switch-traffic-to-mackerel/config"
+	"github.com/yseto/switch-traffic-to-mackerel/mib"
+	"github.com/yseto/switch-traffic-to-mackerel/snmp"
+)
+
+// ifTable walks columns of interfaces, each column once in a collection cycle.
+type ifTable struct {
+	client  snmpClientImpl
+	length  uint64
+	columns map[string]map[uint64]uint64
+}
+
+func newIfTable(client snmpClientImpl, length uint64) *ifTable {
+	return &ifTable{
+		client:  client,
+		length:  length,
+		columns: make(map[string]map[uint64]uint64),
+	}
+}
+
+func (t *ifTable) column(oid string) (map[uint64]uint64, error) {
+	if values, ok := t.columns[oid]; ok {
+		return values, nil
+	}
+	values, err := t.client.BulkWalk(oid, t.length)
+	if err != nil {
+		return nil, err
+	}
+	t.columns[oid] = values
+	return values, nil
+}
+
+// prefetch walks columns which are not walked yet, together.
+func (t *ifTable) prefetch(oids ...string) error {
+	var walk []string
+	for _, oid := range oids {
+		if _, ok := t.columns[oid]; !ok && !slices.Contains(walk, oid) {
+			walk = append(walk, oid)
+		}
+	}
+	if len(walk) == 0 {
+		return nil
+	}
+	columns, err := t.client.BulkWalkColumns(walk, t.length)
+	if err != nil {
+		return err
+	}
+	for _, oid := range walk {
+		t.columns[oid] = columns[oid]
+	}
+	return nil
+}
+
+// getRatio is the ratio of selected interfaces to all, at most which instances are fetched by GET instead of walking.
+const getRatio = 0.25
+
+// fetch gets instances, ifIndexes by column, by GET when few interfaces are selected, otherwise walks the columns.
+// columns fetched by GET have the instances only.
+func (t *ifTable) fetch(instances map[string][]uint64, selected, total int) error {
+	if float64(selected) > float64(total)*getRatio {
+		return t.prefetch(maps.Keys(instances)...)
+	}
+	get := make(map[string][]uint64)
+	for oid, ifIndexes := range instances {
+		if _, ok := t.columns[oid]; !ok {
+			get[oid] = ifIndexes
+		}
+	}
+	if len(get) == 0 {
+		return nil
+	}
+	columns, err := t.client.GetColumns(get)
+	if err != nil {
+		return err
+	}
+	for oid := range get {
+		t.columns[oid] = columns[oid]
+	}
+	return nil
+}
+
+// ifEntry is an interface, with values to choose it.
+type ifEntry struct {
+	ifIndex uint64
+	ifDescr string
+	ifAlias string
+	ifType  uint64
+	// speed is ifHighSpeed, Mbps.
+	speed uint64
+	up    bool
+	used  bool
+}
+
+// entries returns interfaces, filled with values used by the filters and skip-linkdown.
+func (t *ifTable) entries(ifDescr, ifAlias map[uint64]string, skipLinkdown bool, filters ...*config.InterfaceFilter) (map[uint64]*ifEntry, error) {
+	entries := make(map[uint64]*ifEntry, len(ifDescr))
+	for ifIndex, descr := range ifDescr {
+		entries[ifIndex] = &ifEntry{ifIndex: ifIndex, ifDescr: descr, ifAlias: ifAlias[ifIndex]}
+	}
+
+	var needType, needSpeed, needUsed bool
+	for _, f := range filters {
+		needType = needType || len(f.IfType) > 0
+		needSpeed = needSpeed || f.MinSpeed > 0 || f.MaxSpeed > 0
+		needUsed = needUsed || f.SkipUnused
+	}
+	// columns to choose interfaces are walked together.
+	var oids []string
+	if skipLinkdown {
+		oids = append(oids, snmp.MIBifOperStatus)
+	}
+	if needType {
+		oids = append(oids, snmp.MIBifType)
+	}
+	if needSpeed {
+		oids = append(oids, snmp.MIBifHighSpeed)
+	}
+	if needUsed {
+		oids = append(oids, mib.Oidmapping()["ifHCInOctets"], mib.Oidmapping()["ifHCOutOctets"])
+	}
+	if err := t.prefetch(oids...); err != nil {
+		return nil, err
+	}
+
+	if skipLinkdown {
+		status, err := t.column(snmp.MIBifOperStatus)
+		if err != nil {
+			return nil, err
+		}
+		for ifIndex, e := range entries {
+			// same as BulkWalkGetInterfaceState, not down(2) is up.
+			e.up = status[ifIndex] != 2
+		}
+	}
+	if needType {
+		ifType, err := t.column(snmp.MIBifType)
+		if err != nil {
+			return nil, err
+		}
+		for ifIndex, e := range entries {
+			e.ifType = ifType[ifIndex]
+		}
+	}
+	if needSpeed {
+		speed, err := t.column(snmp.MIBifHighSpeed)
+		if err != nil {
+			return nil, err
+		}
+		for ifIndex, e := range entries {
+			e.speed = speed[ifIndex]
+		}
+	}
+	if needUsed {
+		if err := t.fillUsed(entries); err != nil {
+			return nil, err
+		}
+	}
+	return entries, nil
+}
+
+// fillUsed sets whether interfaces have carried traffic since the device started,
+// by 64 bit octets, or 32 bit ones when the device does not support them.
+func (t *ifTable) fillUsed(entries map[uint64]*ifEntry) error {
+	for _, names := range [][]string{{"ifHCInOctets", "ifHCOutOctets"}, {"ifInOctets", "ifOutOctets"}} {
+		var found bool
+		if err := t.prefetch(mib.Oidmapping()[names[0]], mib.Oidmapping()[names[1]]); err != nil {
+			return err
+		}
+		for _, name := range names {
+			octets, err := t.column(mib.Oidmapping()[name])
+			if err != nil {
+				return err
+			}
+			for ifIndex, v := range octets {
+				found = true
+				if e, ok := entries[ifIndex]; ok && v > 0 {
+					e.used = true
+				}
+			}
+		}
+		if found {
+			return nil
+		}
+	}
+	return nil
+}
+
+// selected reports whether the interface is collected.
+func selected(f *config.InterfaceFilter, skipLinkdown bool, e *ifEntry) bool {
+	if len(f.Include) > 0 && !matchAny(f.Include, e.ifDescr) {
+		return false
+	}
+	if len(f.IncludeAlias) > 0 && !matchAny(f.IncludeAlias, e.ifAlias) {
+		return false
+	}
+	if len(f.IfIndex) > 0 && !slices.ContainsFunc(f.IfIndex, func(r config.IndexRange) bool {
+		return r.From <= e.ifIndex && e.ifIndex <= r.To
+	}) {
+		return false
+	}
+	if len(f.IfType) > 0 && !slices.Contains(f.IfType, e.ifType) {
+		return false
+	}
+	if f.MinSpeed > 0 && e.speed < f.MinSpeed {
+		return false
+	}
+	if f.MaxSpeed > 0 && e.speed > f.MaxSpeed {
+		return false
+	}
+
+	if matchAny(f.Exclude, e.ifDescr) || matchAny(f.ExcludeAlias, e.ifAlias) {
+		return false
+	}
+	if f.SkipUnused && !e.used {
+		return false
+	}
+	// skip when down(2)
+	if skipLinkdown && !e.up {
+		return false
+	}
+	return true
+}
+
+func matchAny(patterns []*regexp.Regexp, s string) bool {
+	return slices.ContainsFunc(patterns, func(re *regexp.Regexp) bool {
+		return re.MatchString(s)
+	})
+}
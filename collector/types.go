@@ -1,11 +1,15 @@
 package collector
 
-import "fmt"
+import (
+	"fmt"
+	"time"
+)
 
 type MetricsDutum struct {
 	IfIndex uint64 `json:"ifIndex"`
 	Mib     string `json:"mib"`
 	IfName  string `json:"ifName"`
+	IfAlias string `json:"ifAlias,omitempty"`
 	Value   uint64 `json:"value"`
 }
 
@@ -14,7 +18,45 @@ func (m *MetricsDutum) String() string {
 }
 
 type Interface struct {
-	IfName     string
-	IpAddress  []string
-	MacAddress string
+	IfName      string
+	IpAddress   []string
+	IPv6Address []string
+	MacAddress  string
+}
+
+// InterfaceStatus is an interface of the device, to choose interfaces to collect.
+type InterfaceStatus struct {
+	IfIndex uint64
+	IfDescr string
+	IfName  string
+	IfAlias string
+	// IfType is the name of IANAifType, or the number.
+	IfType string
+	// Speed is ifHighSpeed, Mbps.
+	Speed       uint64
+	OperStatus  string
+	AdminStatus string
+	// Selected is whether the interface is collected by the config.
+	Selected bool
+	// Group is the name of the interface group, empty when none matches.
+	Group string
+}
+
+type SystemInfo struct {
+	SysName     string
+	SysObjectID string
+	SysDescr    string
+	SysLocation string
+	SysContact  string
+	SysUpTime   time.Duration
+	// nil when ENTITY-MIB is not supported.
+	Entity *Entity
+}
+
+// Entity is the chassis in ENTITY-MIB.
+type Entity struct {
+	SerialNum   string
+	ModelName   string
+	FirmwareRev string
+	SoftwareRev string
 }
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"text/tabwriter"
+
+	"github.com/yseto/switch-traffic-to-mackerel/collector"
+	"github.com/yseto/switch-traffic-to-mackerel/config"
+	"github.com/yseto/switch-traffic-to-mackerel/mib"
+	"github.com/yseto/switch-traffic-to-mackerel/snmp"
+)
+
+// commands are subcommands, the agent runs without them.
+var commands = map[string]func(ctx context.Context, args []string) error{
+	"walk":       walkCommand,
+	"interfaces": interfacesCommand,
+	"check":      checkCommand,
+	"once":       onceCommand,
+	"plugin":     pluginCommand,
+	"config":     configCommand,
+}
+
+func runCommand(name string, args []string) int {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := commands[name](ctx, args); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+		return 1
+	}
+	return 0
+}
+
+// targetFlags are flags to choose a target in the config.
+type targetFlags struct {
+	filename string
+	target   string
+}
+
+func (f *targetFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.filename, "config", "config.yaml", "config `filename`")
+	fs.StringVar(&f.target, "target", "", "`target` or name on Mackerel, the first target when empty")
+}
+
+func (f *targetFlags) load() (*config.Target, error) {
+	c, err := config.Init(f.filename)
+	if err != nil {
+		return nil, err
+	}
+	if f.target == "" {
+		return c.Targets[0], nil
+	}
+	return f.find(c)
+}
+
+func (f *targetFlags) find(c *config.Config) (*config.Target, error) {
+	for _, t := range c.Targets {
+		if t.Target == f.target || t.Name() == f.target {
+			return t, nil
+		}
+	}
+	return nil, fmt.Errorf("target %s is not found", f.target)
+}
+
+// walkCommand prints values in the subtree, mib-2 when oid is not given.
+func walkCommand(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("walk", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s walk [flags] [oid]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	var tf targetFlags
+	tf.register(fs)
+	fs.Parse(args) // nolint
+
+	t, err := tf.load()
+	if err != nil {
+		return err
+	}
+
+	oid := "1.3.6.1.2.1"
+	if fs.NArg() > 0 {
+		oid = fs.Arg(0)
+	}
+	// names of mibs in the config are accepted.
+	if v, ok := mib.Oidmapping()[oid]; ok {
+		oid = v
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	err = collector.Walk(ctx, t, oid, func(v snmp.Variable) error {
+		_, err := fmt.Fprintf(w, "%s\t%s\t%s\n", v.OID, v.Type, v.Value)
+		return err
+	})
+	if ferr := w.Flush(); err == nil {
+		err = ferr
+	}
+	return err
+}
+
+// interfacesCommand prints interfaces, and whether include, exclude and skip-linkdown select them.
+func interfacesCommand(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("interfaces", flag.ExitOnError)
+	var tf targetFlags
+	tf.register(fs)
+	fs.Parse(args) // nolint
+
+	t, err := tf.load()
+	if err != nil {
+		return err
+	}
+
+	interfaces, err := collector.DoInterfaces(ctx, t)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "IFINDEX\tIFDESCR\tIFNAME\tIFALIAS\tIFTYPE\tSPEED(Mbps)\tOPER\tADMIN\tSELECTED\tGROUP") // nolint
+	for _, i := range interfaces {
+		selected := "-"
+		if i.Selected {
+			selected = "yes"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%d\t%s\t%s\t%s\t%s\n", // nolint
+			i.IfIndex, i.IfDescr, i.IfName, i.IfAlias, i.IfType, i.Speed, i.OperStatus, i.AdminStatus, selected, i.Group)
+	}
+	return w.Flush()
+}
@@ -4,39 +4,138 @@ import (
 	"cmp"
 	"crypto/md5"
 	"fmt"
-	"os"
+	"log/slog"
+	"path/filepath"
 	"regexp"
-
-	"gopkg.in/yaml.v3"
+	"time"
 
 	"github.com/mackerelio/mackerel-client-go"
 	"github.com/yseto/switch-traffic-to-mackerel/mib"
 )
 
-var loadedFilename string
+const (
+	defaultShutdownGracePeriod = 10 * time.Second
+	defaultInventoryInterval   = time.Hour
+	defaultInterfaceInterval   = time.Hour
+	defaultUnhealthyIntervals  = 3
+	defaultRateLimitInterval   = time.Minute
+	defaultRateLimitBurst      = 5
+)
 
 type YAMLConfig struct {
-	Community    string       `yaml:"community"`
-	Target       string       `yaml:"target"`
-	Interface    *Interface   `yaml:"interface,omitempty"`
-	Mibs         []string     `yaml:"mibs,omitempty"`
-	SkipLinkdown bool         `yaml:"skip-linkdown,omitempty"`
-	Mackerel     *Mackerel    `yaml:"mackerel,omitempty"`
-	Debug        bool         `yaml:"debug,omitempty"`
-	DryRun       bool         `yaml:"dry-run,omitempty"`
-	CustomMibs   []*CustomMIB `yaml:"custom-mibs,omitempty"`
+	// a target can be written at the top level, as before targets.
+	YAMLTarget `yaml:",inline"`
+
+	Targets    []*YAMLTarget `yaml:"targets,omitempty"`
+	Debug      bool          `yaml:"debug,omitempty"`
+	DryRun     bool          `yaml:"dry-run,omitempty"`
+	Prometheus *Prometheus   `yaml:"prometheus,omitempty"`
+	Status     *Status       `yaml:"status,omitempty"`
+	Sinks      []*Sink       `yaml:"sinks,omitempty"`
+	Log        *Log          `yaml:"log,omitempty"`
+
+	MackerelService *MackerelService `yaml:"mackerel-service,omitempty"`
+	// HostIDFile stores host ids created on Mackerel, instead of writing them to the config file.
+	HostIDFile string `yaml:"host-id-file,omitempty"`
+
+	ShutdownGracePeriod time.Duration `yaml:"shutdown-grace-period,omitempty"`
 }
 
-type Interface struct {
-	Include *string `yaml:"include,omitempty"`
-	Exclude *string `yaml:"exclude,omitempty"`
+type YAMLTarget struct {
+	Community     string     `yaml:"community"`
+	CommunityFile string     `yaml:"community-file,omitempty"`
+	Target        string     `yaml:"target"`
+	Transport     string     `yaml:"transport,omitempty"`
+	Interface     *Interface `yaml:"interface,omitempty"`
+	Mibs          []string   `yaml:"mibs,omitempty"`
+	// InterfaceGroups choose mibs by interfaces.
+	InterfaceGroups []*InterfaceGroup `yaml:"interface-groups,omitempty"`
+	SkipLinkdown    bool              `yaml:"skip-linkdown,omitempty"`
+	Mackerel        *Mackerel         `yaml:"mackerel,omitempty"`
+	CustomMibs      []*CustomMIB      `yaml:"custom-mibs,omitempty"`
 }
 
 type Mackerel struct {
 	HostID            string `yaml:"host-id"`
 	ApiKey            string `yaml:"x-api-key"`
+	ApiKeyFile        string `yaml:"x-api-key-file,omitempty"`
 	Name              string `yaml:"name,omitempty"`
 	IgnoreNetworkInfo bool   `yaml:"ignore-network-info,omitempty"`
+	DeadLetterFile    string `yaml:"dead-letter-file,omitempty"`
+	// InventoryInterval is the interval to refresh the device inventory.
+	InventoryInterval time.Duration `yaml:"inventory-interval,omitempty"`
+	// InterfaceInterval is the interval to refresh interfaces of the host.
+	InterfaceInterval time.Duration `yaml:"interface-interval,omitempty"`
+	// Roles are role fullnames, service:role
+	Roles            []string `yaml:"roles,omitempty"`
+	CustomIdentifier string   `yaml:"custom-identifier,omitempty"`
+}
+
+type MackerelService struct {
+	Name           string       `yaml:"name"`
+	ApiKey         string       `yaml:"x-api-key"`
+	ApiKeyFile     string       `yaml:"x-api-key-file,omitempty"`
+	Aggregates     []*Aggregate `yaml:"aggregates,omitempty"`
+	DeadLetterFile string       `yaml:"dead-letter-file,omitempty"`
+}
+
+// Aggregate sums traffic of matched interfaces across all targets.
+type Aggregate struct {
+	MetricName string `yaml:"metric-name"`
+	Interface  string `yaml:"interface"`
+}
+
+// Status serves /healthz, /status and /debug/pprof/.
+type Status struct {
+	Listen string `yaml:"listen"`
+	// UnhealthyIntervals is the number of collection intervals without success, to fail /healthz.
+	UnhealthyIntervals int `yaml:"unhealthy-intervals,omitempty"`
+}
+
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+// Log configures the logger, written to stderr.
+type Log struct {
+	// Format is text or json.
+	Format string `yaml:"format,omitempty"`
+	// Level is debug, info, warn or error. debug: true overrides it.
+	Level string `yaml:"level,omitempty"`
+	// the same warning of a target is logged up to RateLimitBurst times per RateLimitInterval.
+	RateLimitInterval time.Duration `yaml:"rate-limit-interval,omitempty"`
+	RateLimitBurst    int           `yaml:"rate-limit-burst,omitempty"`
+}
+
+type Prometheus struct {
+	Listen string `yaml:"listen"`
+}
+
+const (
+	SinkInfluxDB = "influxdb"
+	SinkGraphite = "graphite"
+	SinkJSON     = "json"
+	SinkOTLP     = "otlp"
+)
+
+type Sink struct {
+	Type string `yaml:"type"`
+	// influxdb, otlp
+	URL string `yaml:"url,omitempty"`
+	// influxdb
+	Token     string `yaml:"token,omitempty"`
+	TokenFile string `yaml:"token-file,omitempty"`
+	// otlp, protobuf or json
+	Encoding string            `yaml:"encoding,omitempty"`
+	Headers  map[string]string `yaml:"headers,omitempty"`
+	// graphite
+	Address string `yaml:"address,omitempty"`
+	Prefix  string `yaml:"prefix,omitempty"`
+	// json, stdout when empty or "-"
+	Path string `yaml:"path,omitempty"`
+
+	DeadLetterFile string `yaml:"dead-letter-file,omitempty"`
 }
 
 type CustomMIB struct {
@@ -52,70 +151,259 @@ type MIBwithDisplayName struct {
 }
 
 type Config struct {
-	Community         string
-	Target            string
-	MIBs              []string
-	IncludeRegexp     *regexp.Regexp
-	ExcludeRegexp     *regexp.Regexp
+	Targets    []*Target
+	Debug      bool
+	DryRun     bool
+	Prometheus *Prometheus
+	Status     *Status
+	Sinks      []*Sink
+	Log        *Log
+
+	MackerelService *MackerelService
+	Aggregates      []*AggregateRule
+
+	// ShutdownGracePeriod is how long pending values are sent on shutdown.
+	ShutdownGracePeriod time.Duration
+}
+
+type Target struct {
+	Community string
+	// Target is as written in the config, it identifies the target.
+	Target string
+	// Host is an address or a DNS name, resolved on every connection.
+	Host      string
+	Port      uint16
+	Transport string
+
+	MIBs      []string
+	Interface InterfaceFilter
+	// InterfaceGroups are evaluated in order, MIBs are used for interfaces matching none of them.
+	InterfaceGroups   []*InterfaceGroupFilter
 	SkipDownLinkState bool
-	Debug             bool
-	DryRun            bool
 	Mackerel          *Mackerel
 
 	CustomMIBs          []string
 	CustomMIBsGraphDefs []*mackerel.GraphDefsParam
 	// metricName:mib
 	CustomMIBmetricNameMappedMIBs map[string]string
+
+	// index in targets, -1 when written at the top level.
+	index int
+	// filename is the config file, and hostIDFile is host-id-file resolved from it.
+	filename   string
+	hostIDFile string
+}
+
+// Name returns the name on Mackerel, or the target.
+func (t *Target) Name() string {
+	if t.Mackerel != nil {
+		return cmp.Or(t.Mackerel.Name, t.Target)
+	}
+	return t.Target
+}
+
+type AggregateRule struct {
+	MetricName      string
+	InterfaceRegexp *regexp.Regexp
 }
 
 func Init(filename string) (*Config, error) {
-	loadedFilename = filename
-	f, err := os.ReadFile(filename)
+	return load(filename, false)
+}
+
+// Check loads the config as Init, but unknown keys are errors, such as typos.
+func Check(filename string) (*Config, error) {
+	return load(filename, true)
+}
+
+func load(filename string, strict bool) (*Config, error) {
+	t, err := read(filename, strict)
 	if err != nil {
 		return nil, err
 	}
-	var t YAMLConfig
-	err = yaml.Unmarshal(f, &t)
+	dir := filepath.Dir(filename)
+	c, err := convert(t, dir)
 	if err != nil {
 		return nil, err
 	}
-	return convert(t)
-}
 
-func convert(t YAMLConfig) (*Config, error) {
-	if t.Community == "" {
-		return nil, fmt.Errorf("community is needed")
+	var hostIDFile string
+	ids := map[string]string{}
+	if t.HostIDFile != "" {
+		hostIDFile = resolvePath(dir, t.HostIDFile)
+		if ids, err = loadHostIDFile(hostIDFile); err != nil {
+			return nil, err
+		}
 	}
-	if t.Target == "" {
-		return nil, fmt.Errorf("target is needed")
+	for _, target := range c.Targets {
+		target.filename = filename
+		target.hostIDFile = hostIDFile
+		// host-id in the config file takes precedence.
+		if target.Mackerel != nil && target.Mackerel.HostID == "" {
+			target.Mackerel.HostID = ids[target.Target]
+		}
 	}
+	return c, nil
+}
+
+// resolvePath returns the path relative to dir, the directory of the config file, unless it is absolute.
+func resolvePath(dir, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
 
+// convert validates the config. files in it are relative to dir.
+func convert(t YAMLConfig, dir string) (*Config, error) {
 	c := &Config{
-		Target:                        t.Target,
-		Community:                     t.Community,
-		SkipDownLinkState:             t.SkipLinkdown,
-		Debug:                         t.Debug,
-		DryRun:                        t.DryRun,
-		CustomMIBmetricNameMappedMIBs: map[string]string{},
+		Debug:               t.Debug,
+		DryRun:              t.DryRun,
+		ShutdownGracePeriod: cmp.Or(t.ShutdownGracePeriod, defaultShutdownGracePeriod),
 	}
 
-	var err error
-	if t.Interface != nil {
-		if t.Interface.Include != nil && t.Interface.Exclude != nil {
-			return nil, fmt.Errorf("Interface.Exclude, Interface.Include is exclusive control")
+	// the top level is a target, unless targets are written and it has no target.
+	if t.Target != "" || len(t.Targets) == 0 {
+		target, err := convertTarget(&t.YAMLTarget, -1, dir)
+		if err != nil {
+			return nil, err
 		}
-		if t.Interface.Include != nil {
-			c.IncludeRegexp, err = regexp.Compile(*t.Interface.Include)
-			if err != nil {
-				return nil, err
-			}
+		c.Targets = append(c.Targets, target)
+	}
+	for i := range t.Targets {
+		target, err := convertTarget(inherit(t.Targets[i], &t.YAMLTarget), i, dir)
+		if err != nil {
+			return nil, fmt.Errorf("targets[%d]: %w", i, err)
+		}
+		c.Targets = append(c.Targets, target)
+	}
+
+	logConfig, err := convertLog(t.Log)
+	if err != nil {
+		return nil, err
+	}
+	c.Log = logConfig
+
+	if t.Prometheus != nil {
+		if t.Prometheus.Listen == "" {
+			return nil, fmt.Errorf("prometheus.listen is needed")
+		}
+		c.Prometheus = t.Prometheus
+	}
+
+	if t.Status != nil {
+		if t.Status.Listen == "" {
+			return nil, fmt.Errorf("status.listen is needed")
+		}
+		st := *t.Status
+		st.UnhealthyIntervals = cmp.Or(st.UnhealthyIntervals, defaultUnhealthyIntervals)
+		c.Status = &st
+	}
+
+	for i := range t.Sinks {
+		s, err := resolveSink(t.Sinks[i], dir)
+		if err != nil {
+			return nil, fmt.Errorf("sinks[%d]: %w", i, err)
+		}
+		if err := validateSink(s); err != nil {
+			return nil, err
 		}
-		if t.Interface.Exclude != nil {
-			c.ExcludeRegexp, err = regexp.Compile(*t.Interface.Exclude)
+		c.Sinks = append(c.Sinks, s)
+	}
+
+	if t.MackerelService != nil {
+		if t.MackerelService.Name == "" {
+			return nil, fmt.Errorf("mackerel-service.name is needed")
+		}
+		for _, a := range t.MackerelService.Aggregates {
+			if !metricRe.MatchString(a.MetricName) {
+				return nil, fmt.Errorf("metricName is not valid : %s", a.MetricName)
+			}
+			re, err := regexp.Compile(a.Interface)
 			if err != nil {
 				return nil, err
 			}
+			c.Aggregates = append(c.Aggregates, &AggregateRule{MetricName: a.MetricName, InterfaceRegexp: re})
 		}
+		ms := *t.MackerelService
+		ms.ApiKey, err = secret(dir, "mackerel-service.x-api-key", ms.ApiKey, ms.ApiKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		ms.ApiKeyFile = ""
+		c.MackerelService = &ms
+	}
+	return c, nil
+}
+
+func convertLog(t *Log) (*Log, error) {
+	var l Log
+	if t != nil {
+		l = *t
+	}
+	l.Format = cmp.Or(l.Format, LogFormatText)
+	if l.Format != LogFormatText && l.Format != LogFormatJSON {
+		return nil, fmt.Errorf("log.format %s is not supported", l.Format)
+	}
+	l.Level = cmp.Or(l.Level, "info")
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(l.Level)); err != nil {
+		return nil, fmt.Errorf("log.level %s is not supported", l.Level)
+	}
+	l.RateLimitInterval = cmp.Or(l.RateLimitInterval, defaultRateLimitInterval)
+	l.RateLimitBurst = cmp.Or(l.RateLimitBurst, defaultRateLimitBurst)
+	return &l, nil
+}
+
+// inherit fills community and x-api-key from the top level.
+func inherit(t, top *YAMLTarget) *YAMLTarget {
+	n := *t
+	if n.Community == "" && n.CommunityFile == "" {
+		n.Community, n.CommunityFile = top.Community, top.CommunityFile
+	}
+	if n.Mackerel != nil && top.Mackerel != nil && n.Mackerel.ApiKey == "" && n.Mackerel.ApiKeyFile == "" {
+		m := *n.Mackerel
+		m.ApiKey, m.ApiKeyFile = top.Mackerel.ApiKey, top.Mackerel.ApiKeyFile
+		n.Mackerel = &m
+	}
+	return &n
+}
+
+func convertTarget(t *YAMLTarget, index int, dir string) (*Target, error) {
+	community, err := secret(dir, "community", t.Community, t.CommunityFile)
+	if err != nil {
+		return nil, err
+	}
+	if community == "" {
+		return nil, fmt.Errorf("community is needed")
+	}
+	if t.Target == "" {
+		return nil, fmt.Errorf("target is needed")
+	}
+
+	host, port, err := splitTarget(t.Target)
+	if err != nil {
+		return nil, err
+	}
+	transport := cmp.Or(t.Transport, "udp")
+	if transport != "udp" && transport != "tcp" {
+		return nil, fmt.Errorf("transport %s is not supported", t.Transport)
+	}
+
+	c := &Target{
+		Target:                        t.Target,
+		Host:                          host,
+		Port:                          port,
+		Transport:                     transport,
+		Community:                     community,
+		SkipDownLinkState:             t.SkipLinkdown,
+		CustomMIBmetricNameMappedMIBs: map[string]string{},
+		index:                         index,
+	}
+
+	c.Interface, err = convertInterface(t.Interface)
+	if err != nil {
+		return nil, err
 	}
 
 	c.MIBs, err = mib.Validate(t.Mibs)
@@ -123,8 +411,29 @@ func convert(t YAMLConfig) (*Config, error) {
 		return nil, err
 	}
 
+	for i, g := range t.InterfaceGroups {
+		group, err := convertInterfaceGroup(g)
+		if err != nil {
+			return nil, fmt.Errorf("interface-groups[%d]: %w", i, err)
+		}
+		c.InterfaceGroups = append(c.InterfaceGroups, group)
+	}
+
 	if t.Mackerel != nil {
-		c.Mackerel = t.Mackerel
+		m := *t.Mackerel
+		m.ApiKey, err = secret(dir, "mackerel.x-api-key", m.ApiKey, m.ApiKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		m.ApiKeyFile = ""
+		m.InventoryInterval = cmp.Or(m.InventoryInterval, defaultInventoryInterval)
+		m.InterfaceInterval = cmp.Or(m.InterfaceInterval, defaultInterfaceInterval)
+		for _, role := range m.Roles {
+			if !roleRe.MatchString(role) {
+				return nil, fmt.Errorf("mackerel.roles is not valid : %s", role)
+			}
+		}
+		c.Mackerel = &m
 	}
 
 	for i := range t.CustomMibs {
@@ -141,6 +450,53 @@ func convert(t YAMLConfig) (*Config, error) {
 	return c, nil
 }
 
+// resolveSink returns a copy of the sink, with secrets resolved.
+func resolveSink(s *Sink, dir string) (*Sink, error) {
+	n := *s
+	var err error
+	n.Token, err = secret(dir, "token", s.Token, s.TokenFile)
+	if err != nil {
+		return nil, err
+	}
+	n.TokenFile = ""
+	if s.Headers != nil {
+		n.Headers = make(map[string]string, len(s.Headers))
+		for k, v := range s.Headers {
+			if n.Headers[k], err = expandEnv(v); err != nil {
+				return nil, fmt.Errorf("headers.%s: %w", k, err)
+			}
+		}
+	}
+	return &n, nil
+}
+
+func validateSink(s *Sink) error {
+	switch s.Type {
+	case SinkInfluxDB:
+		if s.URL == "" {
+			return fmt.Errorf("sinks.url is needed for %s", s.Type)
+		}
+	case SinkOTLP:
+		if s.URL == "" {
+			return fmt.Errorf("sinks.url is needed for %s", s.Type)
+		}
+		if s.Encoding != "" && s.Encoding != "protobuf" && s.Encoding != "json" {
+			return fmt.Errorf("sinks.encoding %s is not supported", s.Encoding)
+		}
+	case SinkGraphite:
+		if s.Address == "" {
+			return fmt.Errorf("sinks.address is needed for %s", s.Type)
+		}
+	case SinkJSON:
+	default:
+		return fmt.Errorf("sink %s is not supported", s.Type)
+	}
+	return nil
+}
+
+// service:role
+var roleRe = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_-]*:[a-zA-Z0-9][a-zA-Z0-9_-]*$`)
+
 var metricRe = regexp.MustCompile("^[a-zA-Z0-9._-]+$")
 
 func customMIBMackerelMetricNameParent(graphDisplayName string) string {
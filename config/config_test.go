@@ -142,6 +142,13 @@ func Test_generateCustomMIB(t *testing.T) {
 	}
 }
 
+var defaultLog = &Log{
+	Format:            LogFormatText,
+	Level:             "info",
+	RateLimitInterval: defaultRateLimitInterval,
+	RateLimitBurst:    defaultRateLimitBurst,
+}
+
 func Test_convert(t *testing.T) {
 	reg := "^(eth|wlan)"
 
@@ -156,162 +163,711 @@ func Test_convert(t *testing.T) {
 		},
 		{
 			source: YAMLConfig{
-				Community: "public",
+				YAMLTarget: YAMLTarget{
+					Community: "public",
+				},
 			},
 			wantErr: true,
 		},
 		{
 			source: YAMLConfig{
-				Target: "192.0.2.1",
+				YAMLTarget: YAMLTarget{
+					Target: "192.0.2.1",
+				},
 			},
 			wantErr: true,
 		},
 		{
 			source: YAMLConfig{
-				Community: "public",
-				Target:    "192.0.2.1",
+				YAMLTarget: YAMLTarget{
+					Community: "public",
+					Target:    "192.0.2.1",
+				},
 			},
 			expected: &Config{
-				Community:                     "public",
-				Target:                        "192.0.2.1",
-				MIBs:                          []string{"ifHCInOctets", "ifHCOutOctets", "ifInDiscards", "ifOutDiscards", "ifInErrors", "ifOutErrors"},
-				CustomMIBmetricNameMappedMIBs: map[string]string{},
+				Targets: []*Target{
+					{
+						Community:                     "public",
+						Target:                        "192.0.2.1",
+						Host:                          "192.0.2.1",
+						Port:                          161,
+						Transport:                     "udp",
+						MIBs:                          []string{"ifHCInOctets", "ifHCOutOctets", "ifInDiscards", "ifOutDiscards", "ifInErrors", "ifOutErrors"},
+						CustomMIBmetricNameMappedMIBs: map[string]string{},
+						index:                         -1,
+					},
+				},
+				Log:                 defaultLog,
+				ShutdownGracePeriod: defaultShutdownGracePeriod,
 			},
 		},
 		{
 			source: YAMLConfig{
-				Community: "public",
-				Target:    "192.0.2.1",
-				Mibs:      []string{"ifHCInOctets", "ifHCOutOctets"},
+				YAMLTarget: YAMLTarget{
+					Community: "public",
+					Target:    "192.0.2.1",
+					Mibs:      []string{"ifHCInOctets", "ifHCOutOctets"},
+				},
+			},
+			expected: &Config{
+				Targets: []*Target{
+					{
+						Community:                     "public",
+						Target:                        "192.0.2.1",
+						Host:                          "192.0.2.1",
+						Port:                          161,
+						Transport:                     "udp",
+						MIBs:                          []string{"ifHCInOctets", "ifHCOutOctets"},
+						CustomMIBmetricNameMappedMIBs: map[string]string{},
+						index:                         -1,
+					},
+				},
+				Log:                 defaultLog,
+				ShutdownGracePeriod: defaultShutdownGracePeriod,
+			},
+		},
+		{
+			source: YAMLConfig{
+				YAMLTarget: YAMLTarget{
+					Community: "public",
+					Target:    "192.0.2.1",
+					Mibs:      []string{"ifHCInOctets", "ifHCOutOctets"},
+					Interface: &Interface{
+						Include: Patterns{reg},
+					},
+				},
 			},
 			expected: &Config{
-				Community:                     "public",
-				Target:                        "192.0.2.1",
-				MIBs:                          []string{"ifHCInOctets", "ifHCOutOctets"},
-				CustomMIBmetricNameMappedMIBs: map[string]string{},
+				Targets: []*Target{
+					{
+						Community:                     "public",
+						Target:                        "192.0.2.1",
+						Host:                          "192.0.2.1",
+						Port:                          161,
+						Transport:                     "udp",
+						MIBs:                          []string{"ifHCInOctets", "ifHCOutOctets"},
+						CustomMIBmetricNameMappedMIBs: map[string]string{},
+						Interface:                     InterfaceFilter{Include: []*regexp.Regexp{regexp.MustCompile(reg)}},
+						index:                         -1,
+					},
+				},
+				Log:                 defaultLog,
+				ShutdownGracePeriod: defaultShutdownGracePeriod,
 			},
 		},
 		{
 			source: YAMLConfig{
-				Community: "public",
-				Target:    "192.0.2.1",
-				Mibs:      []string{"ifHCInOctets", "ifHCOutOctets"},
-				Interface: &Interface{
-					Include: &reg,
+				YAMLTarget: YAMLTarget{
+					Community: "public",
+					Target:    "192.0.2.1",
+					Mibs:      []string{"ifHCInOctets", "ifHCOutOctets"},
+					Interface: &Interface{
+						Exclude: Patterns{reg},
+					},
 				},
 			},
 			expected: &Config{
-				Community:                     "public",
-				Target:                        "192.0.2.1",
-				MIBs:                          []string{"ifHCInOctets", "ifHCOutOctets"},
-				CustomMIBmetricNameMappedMIBs: map[string]string{},
-				IncludeRegexp:                 regexp.MustCompile(reg),
+				Targets: []*Target{
+					{
+						Community:                     "public",
+						Target:                        "192.0.2.1",
+						Host:                          "192.0.2.1",
+						Port:                          161,
+						Transport:                     "udp",
+						MIBs:                          []string{"ifHCInOctets", "ifHCOutOctets"},
+						CustomMIBmetricNameMappedMIBs: map[string]string{},
+						Interface:                     InterfaceFilter{Exclude: []*regexp.Regexp{regexp.MustCompile(reg)}},
+						index:                         -1,
+					},
+				},
+				Log:                 defaultLog,
+				ShutdownGracePeriod: defaultShutdownGracePeriod,
 			},
 		},
 		{
 			source: YAMLConfig{
-				Community: "public",
-				Target:    "192.0.2.1",
-				Mibs:      []string{"ifHCInOctets", "ifHCOutOctets"},
-				Interface: &Interface{
-					Exclude: &reg,
+				YAMLTarget: YAMLTarget{
+					Community: "public",
+					Target:    "192.0.2.1",
+					Mibs:      []string{"ifHCInOctets", "ifHCOutOctets"},
+					Interface: &Interface{
+						Include:      Patterns{reg, "^ae"},
+						Exclude:      Patterns{"^eth0$", ""},
+						ExcludeAlias: Patterns{"unused"},
+						IfIndex:      []string{"1-48", "100"},
+						IfType:       []string{"ethernetCsmacd", "ieee8023adLag"},
+						MinSpeed:     1000,
+						SkipUnused:   true,
+					},
 				},
 			},
 			expected: &Config{
-				Community:                     "public",
-				Target:                        "192.0.2.1",
-				MIBs:                          []string{"ifHCInOctets", "ifHCOutOctets"},
-				CustomMIBmetricNameMappedMIBs: map[string]string{},
-				ExcludeRegexp:                 regexp.MustCompile(reg),
+				Targets: []*Target{
+					{
+						Community:                     "public",
+						Target:                        "192.0.2.1",
+						Host:                          "192.0.2.1",
+						Port:                          161,
+						Transport:                     "udp",
+						MIBs:                          []string{"ifHCInOctets", "ifHCOutOctets"},
+						CustomMIBmetricNameMappedMIBs: map[string]string{},
+						Interface: InterfaceFilter{
+							Include:      []*regexp.Regexp{regexp.MustCompile(reg), regexp.MustCompile("^ae")},
+							Exclude:      []*regexp.Regexp{regexp.MustCompile("^eth0$")},
+							ExcludeAlias: []*regexp.Regexp{regexp.MustCompile("unused")},
+							IfIndex:      []IndexRange{{From: 1, To: 48}, {From: 100, To: 100}},
+							IfType:       []uint64{6, 161},
+							MinSpeed:     1000,
+							SkipUnused:   true,
+						},
+						index: -1,
+					},
+				},
+				Log:                 defaultLog,
+				ShutdownGracePeriod: defaultShutdownGracePeriod,
 			},
 		},
 		{
 			source: YAMLConfig{
-				Community: "public",
-				Target:    "192.0.2.1",
-				Mibs:      []string{"ifHCInOctets", "ifHCOutOctets"},
-				Interface: &Interface{
-					Include: &reg,
-					Exclude: &reg,
+				YAMLTarget: YAMLTarget{
+					Community: "public",
+					Target:    "192.0.2.1",
+					Mibs:      []string{"ifHCInOctets"},
+					InterfaceGroups: []*InterfaceGroup{
+						{
+							Name:      "uplinks",
+							Interface: &Interface{IncludeAlias: Patterns{"uplink"}},
+							Mibs:      []string{"ifHCInOctets", "ifInErrors"},
+						},
+					},
+				},
+			},
+			expected: &Config{
+				Targets: []*Target{
+					{
+						Community:                     "public",
+						Target:                        "192.0.2.1",
+						Host:                          "192.0.2.1",
+						Port:                          161,
+						Transport:                     "udp",
+						MIBs:                          []string{"ifHCInOctets"},
+						CustomMIBmetricNameMappedMIBs: map[string]string{},
+						InterfaceGroups: []*InterfaceGroupFilter{
+							{
+								Name:      "uplinks",
+								Interface: InterfaceFilter{IncludeAlias: []*regexp.Regexp{regexp.MustCompile("uplink")}},
+								MIBs:      []string{"ifHCInOctets", "ifInErrors"},
+							},
+						},
+						index: -1,
+					},
+				},
+				Log:                 defaultLog,
+				ShutdownGracePeriod: defaultShutdownGracePeriod,
+			},
+		},
+		{
+			source: YAMLConfig{
+				YAMLTarget: YAMLTarget{
+					Community:       "public",
+					Target:          "192.0.2.1",
+					InterfaceGroups: []*InterfaceGroup{{Mibs: []string{"ifHCInOctets"}}},
 				},
 			},
 			wantErr: true,
 		},
 		{
 			source: YAMLConfig{
-				Community: "public",
-				Target:    "192.0.2.1",
-				Mibs:      []string{"^o^"},
+				YAMLTarget: YAMLTarget{
+					Community:       "public",
+					Target:          "192.0.2.1",
+					InterfaceGroups: []*InterfaceGroup{{Name: "access"}},
+				},
 			},
 			wantErr: true,
 		},
 		{
 			source: YAMLConfig{
-				Community: "public",
-				Target:    "192.0.2.1",
-				Mibs:      []string{"ifHCInOctets", "ifHCOutOctets"},
-				Mackerel: &Mackerel{
-					ApiKey:            "cat",
-					HostID:            "panda",
-					Name:              "dog",
-					IgnoreNetworkInfo: true,
+				YAMLTarget: YAMLTarget{
+					Community: "public",
+					Target:    "192.0.2.1",
+					Interface: &Interface{
+						IfIndex: []string{"48-1"},
+					},
 				},
 			},
-			expected: &Config{
-				Community:                     "public",
-				Target:                        "192.0.2.1",
-				MIBs:                          []string{"ifHCInOctets", "ifHCOutOctets"},
-				CustomMIBmetricNameMappedMIBs: map[string]string{},
-				Mackerel: &Mackerel{
-					HostID:            "panda",
-					ApiKey:            "cat",
-					Name:              "dog",
-					IgnoreNetworkInfo: true,
+			wantErr: true,
+		},
+		{
+			source: YAMLConfig{
+				YAMLTarget: YAMLTarget{
+					Community: "public",
+					Target:    "192.0.2.1",
+					Interface: &Interface{
+						IfType: []string{"ethernet"},
+					},
 				},
 			},
+			wantErr: true,
 		},
 		{
 			source: YAMLConfig{
-				Community: "public",
-				Target:    "192.0.2.1",
-				Mibs:      []string{"ifHCInOctets", "ifHCOutOctets"},
-				CustomMibs: []*CustomMIB{
+				YAMLTarget: YAMLTarget{
+					Community: "public",
+					Target:    "192.0.2.1",
+					Interface: &Interface{
+						Include: Patterns{"("},
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			source: YAMLConfig{
+				YAMLTarget: YAMLTarget{
+					Community: "public",
+					Target:    "192.0.2.1",
+					Mibs:      []string{"^o^"},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			source: YAMLConfig{
+				YAMLTarget: YAMLTarget{
+					Community: "public",
+					Target:    "192.0.2.1",
+					Mibs:      []string{"ifHCInOctets", "ifHCOutOctets"},
+					Mackerel: &Mackerel{
+						ApiKey:            "cat",
+						HostID:            "panda",
+						Name:              "dog",
+						IgnoreNetworkInfo: true,
+						Roles:             []string{"network:switch"},
+						CustomIdentifier:  "sw1.example.com",
+					},
+				},
+			},
+			expected: &Config{
+				Targets: []*Target{
 					{
-						DisplayName: "zoo",
-						Unit:        "float",
-						Mibs: []*MIBwithDisplayName{
-							{
-								DisplayName: "foobar",
-								MetricName:  "foo.bar",
-								MIB:         "1.2.34.56",
+						Community:                     "public",
+						Target:                        "192.0.2.1",
+						Host:                          "192.0.2.1",
+						Port:                          161,
+						Transport:                     "udp",
+						MIBs:                          []string{"ifHCInOctets", "ifHCOutOctets"},
+						CustomMIBmetricNameMappedMIBs: map[string]string{},
+						Mackerel: &Mackerel{
+							HostID:            "panda",
+							ApiKey:            "cat",
+							Name:              "dog",
+							IgnoreNetworkInfo: true,
+							Roles:             []string{"network:switch"},
+							CustomIdentifier:  "sw1.example.com",
+							InventoryInterval: defaultInventoryInterval,
+							InterfaceInterval: defaultInterfaceInterval,
+						},
+						index: -1,
+					},
+				},
+				Log:                 defaultLog,
+				ShutdownGracePeriod: defaultShutdownGracePeriod,
+			},
+		},
+		{
+			source: YAMLConfig{
+				YAMLTarget: YAMLTarget{
+					Community: "public",
+					Target:    "192.0.2.1",
+					Mibs:      []string{"ifHCInOctets", "ifHCOutOctets"},
+					CustomMibs: []*CustomMIB{
+						{
+							DisplayName: "zoo",
+							Unit:        "float",
+							Mibs: []*MIBwithDisplayName{
+								{
+									DisplayName: "foobar",
+									MetricName:  "foo.bar",
+									MIB:         "1.2.34.56",
+								},
 							},
 						},
 					},
 				},
 			},
 			expected: &Config{
-				Community: "public",
-				Target:    "192.0.2.1",
-				MIBs:      []string{"ifHCInOctets", "ifHCOutOctets"},
-				CustomMIBmetricNameMappedMIBs: map[string]string{
-					"custom.custommibs.d2cbe65f53da8607e64173c1a83394fe.foo.bar": "1.2.34.56",
-				},
-				CustomMIBs: []string{"1.2.34.56"},
-				CustomMIBsGraphDefs: []*mackerel.GraphDefsParam{
+				Targets: []*Target{
 					{
-						Name:        "custom.custommibs.d2cbe65f53da8607e64173c1a83394fe",
-						DisplayName: "zoo",
-						Unit:        "float",
-						Metrics: []*mackerel.GraphDefsMetric{
+						Community: "public",
+						Target:    "192.0.2.1",
+						Host:      "192.0.2.1",
+						Port:      161,
+						Transport: "udp",
+						MIBs:      []string{"ifHCInOctets", "ifHCOutOctets"},
+						CustomMIBmetricNameMappedMIBs: map[string]string{
+							"custom.custommibs.d2cbe65f53da8607e64173c1a83394fe.foo.bar": "1.2.34.56",
+						},
+						CustomMIBs: []string{"1.2.34.56"},
+						CustomMIBsGraphDefs: []*mackerel.GraphDefsParam{
 							{
-								Name:        "custom.custommibs.d2cbe65f53da8607e64173c1a83394fe.foo.bar",
-								DisplayName: "foobar",
+								Name:        "custom.custommibs.d2cbe65f53da8607e64173c1a83394fe",
+								DisplayName: "zoo",
+								Unit:        "float",
+								Metrics: []*mackerel.GraphDefsMetric{
+									{
+										Name:        "custom.custommibs.d2cbe65f53da8607e64173c1a83394fe.foo.bar",
+										DisplayName: "foobar",
+									},
+								},
 							},
 						},
+						index: -1,
+					},
+				},
+				Log:                 defaultLog,
+				ShutdownGracePeriod: defaultShutdownGracePeriod,
+			},
+		},
+		{
+			source: YAMLConfig{
+				YAMLTarget: YAMLTarget{
+					Community: "public",
+					Target:    "192.0.2.1",
+					Mibs:      []string{"ifHCInOctets", "ifHCOutOctets"},
+				},
+				Prometheus: &Prometheus{},
+			},
+			wantErr: true,
+		},
+		{
+			source: YAMLConfig{
+				YAMLTarget: YAMLTarget{
+					Community: "public",
+					Target:    "192.0.2.1",
+					Mibs:      []string{"ifHCInOctets", "ifHCOutOctets"},
+				},
+				Prometheus: &Prometheus{
+					Listen: ":9100",
+				},
+			},
+			expected: &Config{
+				Targets: []*Target{
+					{
+						Community:                     "public",
+						Target:                        "192.0.2.1",
+						Host:                          "192.0.2.1",
+						Port:                          161,
+						Transport:                     "udp",
+						MIBs:                          []string{"ifHCInOctets", "ifHCOutOctets"},
+						CustomMIBmetricNameMappedMIBs: map[string]string{},
+						index:                         -1,
 					},
 				},
+				Log:                 defaultLog,
+				ShutdownGracePeriod: defaultShutdownGracePeriod,
+				Prometheus: &Prometheus{
+					Listen: ":9100",
+				},
 			},
 		},
+		{
+			source: YAMLConfig{
+				YAMLTarget: YAMLTarget{
+					Community: "public",
+					Target:    "192.0.2.1",
+					Mibs:      []string{"ifHCInOctets", "ifHCOutOctets"},
+				},
+				Sinks: []*Sink{
+					{Type: SinkInfluxDB, URL: "http://localhost:8086/write?db=switch"},
+					{Type: SinkGraphite, Address: "localhost:2003"},
+					{Type: SinkJSON},
+				},
+			},
+			expected: &Config{
+				Targets: []*Target{
+					{
+						Community:                     "public",
+						Target:                        "192.0.2.1",
+						Host:                          "192.0.2.1",
+						Port:                          161,
+						Transport:                     "udp",
+						MIBs:                          []string{"ifHCInOctets", "ifHCOutOctets"},
+						CustomMIBmetricNameMappedMIBs: map[string]string{},
+						index:                         -1,
+					},
+				},
+				Log:                 defaultLog,
+				ShutdownGracePeriod: defaultShutdownGracePeriod,
+				Sinks: []*Sink{
+					{Type: SinkInfluxDB, URL: "http://localhost:8086/write?db=switch"},
+					{Type: SinkGraphite, Address: "localhost:2003"},
+					{Type: SinkJSON},
+				},
+			},
+		},
+		{
+			source: YAMLConfig{
+				YAMLTarget: YAMLTarget{
+					Community: "public",
+					Target:    "192.0.2.1",
+				},
+				Sinks: []*Sink{{Type: SinkInfluxDB}},
+			},
+			wantErr: true,
+		},
+		{
+			source: YAMLConfig{
+				YAMLTarget: YAMLTarget{
+					Community: "public",
+					Target:    "192.0.2.1",
+				},
+				Sinks: []*Sink{{Type: SinkGraphite}},
+			},
+			wantErr: true,
+		},
+		{
+			source: YAMLConfig{
+				YAMLTarget: YAMLTarget{
+					Community: "public",
+					Target:    "192.0.2.1",
+				},
+				Sinks: []*Sink{{Type: "unknown"}},
+			},
+			wantErr: true,
+		},
+		{
+			source: YAMLConfig{
+				YAMLTarget: YAMLTarget{
+					Community: "public",
+					Target:    "192.0.2.1",
+				},
+				Sinks: []*Sink{{Type: SinkOTLP}},
+			},
+			wantErr: true,
+		},
+		{
+			source: YAMLConfig{
+				YAMLTarget: YAMLTarget{
+					Community: "public",
+					Target:    "192.0.2.1",
+				},
+				Sinks: []*Sink{{Type: SinkOTLP, URL: "http://localhost:4318/v1/metrics", Encoding: "xml"}},
+			},
+			wantErr: true,
+		},
+		{
+			source: YAMLConfig{
+				YAMLTarget: YAMLTarget{
+					Community: "public",
+					Mackerel: &Mackerel{
+						ApiKey: "cat",
+					},
+				},
+				Targets: []*YAMLTarget{
+					{
+						Target: "192.0.2.1",
+						Mibs:   []string{"ifHCInOctets", "ifHCOutOctets"},
+						Mackerel: &Mackerel{
+							Name: "dog",
+						},
+					},
+					{
+						Community: "private",
+						Target:    "192.0.2.2:1161",
+						Transport: "tcp",
+						Mibs:      []string{"ifHCInOctets", "ifHCOutOctets"},
+					},
+				},
+				MackerelService: &MackerelService{
+					Name:   "network",
+					ApiKey: "cat",
+					Aggregates: []*Aggregate{
+						{MetricName: "uplink", Interface: "^uplink"},
+					},
+				},
+			},
+			expected: &Config{
+				Log:                 defaultLog,
+				ShutdownGracePeriod: defaultShutdownGracePeriod,
+				Targets: []*Target{
+					{
+						Community:                     "public",
+						Target:                        "192.0.2.1",
+						Host:                          "192.0.2.1",
+						Port:                          161,
+						Transport:                     "udp",
+						MIBs:                          []string{"ifHCInOctets", "ifHCOutOctets"},
+						CustomMIBmetricNameMappedMIBs: map[string]string{},
+						Mackerel: &Mackerel{
+							ApiKey:            "cat",
+							Name:              "dog",
+							InventoryInterval: defaultInventoryInterval,
+							InterfaceInterval: defaultInterfaceInterval,
+						},
+						index: 0,
+					},
+					{
+						Community:                     "private",
+						Target:                        "192.0.2.2:1161",
+						Host:                          "192.0.2.2",
+						Port:                          1161,
+						Transport:                     "tcp",
+						MIBs:                          []string{"ifHCInOctets", "ifHCOutOctets"},
+						CustomMIBmetricNameMappedMIBs: map[string]string{},
+						index:                         1,
+					},
+				},
+				MackerelService: &MackerelService{
+					Name:   "network",
+					ApiKey: "cat",
+					Aggregates: []*Aggregate{
+						{MetricName: "uplink", Interface: "^uplink"},
+					},
+				},
+				Aggregates: []*AggregateRule{
+					{MetricName: "uplink", InterfaceRegexp: regexp.MustCompile("^uplink")},
+				},
+			},
+		},
+		{
+			source: YAMLConfig{
+				YAMLTarget: YAMLTarget{
+					Community: "public",
+					Target:    "192.0.2.1",
+				},
+				MackerelService: &MackerelService{},
+			},
+			wantErr: true,
+		},
+		{
+			source: YAMLConfig{
+				YAMLTarget: YAMLTarget{
+					Community: "public",
+					Target:    "192.0.2.1",
+				},
+				Status: &Status{},
+			},
+			wantErr: true,
+		},
+		{
+			source: YAMLConfig{
+				YAMLTarget: YAMLTarget{
+					Community: "public",
+					Target:    "192.0.2.1",
+				},
+				Status: &Status{Listen: ":8080"},
+			},
+			expected: &Config{
+				Log:                 defaultLog,
+				ShutdownGracePeriod: defaultShutdownGracePeriod,
+				Targets: []*Target{
+					{
+						Community:                     "public",
+						Target:                        "192.0.2.1",
+						Host:                          "192.0.2.1",
+						Port:                          161,
+						Transport:                     "udp",
+						MIBs:                          []string{"ifHCInOctets", "ifHCOutOctets", "ifInDiscards", "ifOutDiscards", "ifInErrors", "ifOutErrors"},
+						CustomMIBmetricNameMappedMIBs: map[string]string{},
+						index:                         -1,
+					},
+				},
+				Status: &Status{Listen: ":8080", UnhealthyIntervals: defaultUnhealthyIntervals},
+			},
+		},
+		{
+			source: YAMLConfig{
+				YAMLTarget: YAMLTarget{
+					Community: "public",
+					Target:    "192.0.2.1",
+					Transport: "sctp",
+				},
+			},
+			wantErr: true,
+		},
+		{
+			source: YAMLConfig{
+				YAMLTarget: YAMLTarget{
+					Community: "public",
+					Target:    "192.0.2.1",
+					Mackerel: &Mackerel{
+						Roles: []string{"network"},
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			source: YAMLConfig{
+				YAMLTarget: YAMLTarget{
+					Community: "public",
+					Target:    "192.0.2.1",
+				},
+				MackerelService: &MackerelService{
+					Name: "network",
+					Aggregates: []*Aggregate{
+						{MetricName: "uplink", Interface: "("},
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			source: YAMLConfig{
+				YAMLTarget: YAMLTarget{
+					Community: "public",
+					Target:    "192.0.2.1",
+					Mibs:      []string{"ifHCInOctets"},
+				},
+				Log: &Log{
+					Format:         "json",
+					Level:          "warn",
+					RateLimitBurst: 1,
+				},
+			},
+			expected: &Config{
+				Targets: []*Target{
+					{
+						Community:                     "public",
+						Target:                        "192.0.2.1",
+						Host:                          "192.0.2.1",
+						Port:                          161,
+						Transport:                     "udp",
+						MIBs:                          []string{"ifHCInOctets"},
+						CustomMIBmetricNameMappedMIBs: map[string]string{},
+						index:                         -1,
+					},
+				},
+				Log: &Log{
+					Format:            LogFormatJSON,
+					Level:             "warn",
+					RateLimitInterval: defaultRateLimitInterval,
+					RateLimitBurst:    1,
+				},
+				ShutdownGracePeriod: defaultShutdownGracePeriod,
+			},
+		},
+		{
+			source: YAMLConfig{
+				YAMLTarget: YAMLTarget{
+					Community: "public",
+					Target:    "192.0.2.1",
+				},
+				Log: &Log{Format: "logfmt"},
+			},
+			wantErr: true,
+		},
+		{
+			source: YAMLConfig{
+				YAMLTarget: YAMLTarget{
+					Community: "public",
+					Target:    "192.0.2.1",
+				},
+				Log: &Log{Level: "verbose"},
+			},
+			wantErr: true,
+		},
 	}
 
 	opt1 := cmpopts.SortSlices(func(i, j string) bool { return i < j })
@@ -325,12 +881,12 @@ func Test_convert(t *testing.T) {
 	})
 
 	for _, tc := range tests {
-		actual, err := convert(tc.source)
+		actual, err := convert(tc.source, "")
 		if (err != nil) != tc.wantErr {
 			t.Error(err)
 		}
 
-		if diff := cmp.Diff(actual, tc.expected, opt1, opt2); diff != "" {
+		if diff := cmp.Diff(actual, tc.expected, opt1, opt2, cmp.AllowUnexported(Target{})); diff != "" {
 			t.Errorf("value is mismatch (-actual +expected):%s", diff)
 		}
 	}
@@ -338,39 +894,197 @@ func Test_convert(t *testing.T) {
 
 func Test_Config_Save(t *testing.T) {
 	dir := t.TempDir()
+	filename := filepath.Join(dir, "data.yml")
+
+	tests := []struct {
+		name     string
+		source   string
+		index    int
+		expected string
+		wantErr  bool
+	}{
+		{
+			name:   "top level, comments are kept",
+			source: "---\n# device\ncommunity: public # v2c\nmackerel:\n  name: 1234\n  unknown-key: kept\n",
+			index:  -1,
+			expected: `# device
+community: public # v2c
+mackerel:
+  host-id: "123456"
+  name: 1234
+  unknown-key: kept
+`,
+		},
+		{
+			name:   "host-id is replaced",
+			source: "mackerel:\n    host-id: # created on start\n    x-api-key: xxxxx\n",
+			index:  -1,
+			expected: `mackerel:
+    host-id: "123456" # created on start
+    x-api-key: xxxxx
+`,
+		},
+		{
+			name:   "mackerel without keys",
+			source: "community: public\nmackerel:\n",
+			index:  -1,
+			expected: `community: public
+mackerel:
+  host-id: "123456"
+`,
+		},
+		{
+			name:   "target in targets",
+			source: "targets:\n  - target: 192.0.2.1\n    mackerel:\n      host-id: abcdef\n  # second\n  - target: 192.0.2.2\n    mackerel: {}\n",
+			index:  1,
+			expected: `targets:
+  - target: 192.0.2.1
+    mackerel:
+      host-id: abcdef
+  # second
+  - target: 192.0.2.2
+    mackerel: {host-id: "123456"}
+`,
+		},
+		{
+			name:    "target is not found",
+			source:  "targets:\n  - target: 192.0.2.1\n    mackerel:\n",
+			index:   1,
+			wantErr: true,
+		},
+		{
+			name:   "mackerel of a profile",
+			source: "targets:\n  - target: 192.0.2.2\n    profile: switch\n",
+			index:  0,
+			expected: `targets:
+  - target: 192.0.2.2
+    profile: switch
+    mackerel:
+      host-id: "123456"
+`,
+		},
+	}
+
+	var perm fs.FileMode = 0640
+	for _, tc := range tests {
+		if err := os.WriteFile(filename, []byte(tc.source), perm); err != nil {
+			t.Fatal(err)
+		}
+		c := &Target{
+			Target:   "192.0.2.2",
+			Mackerel: &Mackerel{},
+			index:    tc.index,
+			filename: filename,
+		}
+		err := c.Save("123456")
+		if (err != nil) != tc.wantErr {
+			t.Errorf("%s: %v", tc.name, err)
+		}
+		if tc.wantErr {
+			continue
+		}
 
-	loadedFilename = filepath.Join(dir, "data.yml")
+		actual, err := os.ReadFile(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(string(actual), tc.expected); diff != "" {
+			t.Errorf("%s: value is mismatch (-actual +expected):%s", tc.name, diff)
+		}
+		stat, err := os.Stat(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stat.Mode().Perm() != perm {
+			t.Errorf("%s: invalid permission %v", tc.name, stat.Mode().Perm())
+		}
+	}
 
-	var perm fs.FileMode = 0644
-	err := os.WriteFile(loadedFilename, []byte("---\nmackerel:\n  name: 1234"), perm)
+	// temporary files are not left.
+	entries, err := os.ReadDir(dir)
 	if err != nil {
-		t.Error(err)
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("invalid result %v", entries)
 	}
+}
 
-	c := &Config{
-		Mackerel: &Mackerel{},
+func Test_HostIDFile(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "data.yml")
+	source := []byte("host-id-file: host-ids.yml\ncommunity: public\ntargets:\n  - target: 192.0.2.1\n    mackerel:\n      x-api-key: xxxxx\n  - target: 192.0.2.2\n    mackerel:\n      host-id: configured\n")
+	if err := os.WriteFile(filename, source, 0644); err != nil {
+		t.Fatal(err)
 	}
 
-	err = c.Save("123456")
+	c, err := Init(filename)
 	if err != nil {
-		t.Error(err)
+		t.Fatal(err)
+	}
+	if c.Targets[0].Mackerel.HostID != "" {
+		t.Errorf("invalid result %s", c.Targets[0].Mackerel.HostID)
+	}
+	if err = c.Targets[0].Save("123456"); err != nil {
+		t.Fatal(err)
 	}
 
-	actual, err := os.ReadFile(loadedFilename)
+	// the config file is not changed.
+	actual, err := os.ReadFile(filename)
 	if err != nil {
-		t.Error(err)
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(actual, source); diff != "" {
+		t.Errorf("value is mismatch (-actual +expected):%s", diff)
 	}
 
-	expected := []byte(`community: ""
-target: ""
-mackerel:
-    host-id: "123456"
-    x-api-key: ""
-    name: "1234"
-`)
-
-	if diff := cmp.Diff(actual, expected); diff != "" {
+	c, err = Init(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, target := range c.Targets {
+		ids = append(ids, target.Mackerel.HostID)
+	}
+	if diff := cmp.Diff(ids, []string{"123456", "configured"}); diff != "" {
 		t.Errorf("value is mismatch (-actual +expected):%s", diff)
 	}
+}
 
+func Test_Check(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "data.yml")
+
+	tests := []struct {
+		name    string
+		source  string
+		wantErr bool
+	}{
+		{
+			name:   "valid",
+			source: "community: public\ntarget: 192.0.2.1\nskip-linkdown: true\n",
+		},
+		{
+			name:    "unknown key",
+			source:  "community: public\ntarget: 192.0.2.1\nskip-link-down: true\n",
+			wantErr: true,
+		},
+		{
+			name:    "unknown key in targets",
+			source:  "community: public\ntargets:\n  - target: 192.0.2.1\n    mackerel:\n      x-api-ky: xxxxx\n",
+			wantErr: true,
+		},
+	}
+	for _, tc := range tests {
+		if err := os.WriteFile(filename, []byte(tc.source), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Check(filename); (err != nil) != tc.wantErr {
+			t.Errorf("%s: %v", tc.name, err)
+		}
+		// Init accepts unknown keys as before.
+		if _, err := Init(filename); err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+		}
+	}
 }
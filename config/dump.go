@@ -0,0 +1,84 @@
+package config
+
+import (
+	"golang.org/x/exp/maps"
+	"gopkg.in/yaml.v3"
+)
+
+const masked = "********"
+
+// Dump returns the effective config of the file, as YAML.
+// profiles and the top level are resolved into targets, defaults are filled, and secrets are masked.
+func Dump(filename string) ([]byte, error) {
+	t, err := read(filename, false)
+	if err != nil {
+		return nil, err
+	}
+	c, err := load(filename, false)
+	if err != nil {
+		return nil, err
+	}
+
+	// sources of c.Targets, as in convert.
+	var sources []*YAMLTarget
+	if t.Target != "" || len(t.Targets) == 0 {
+		sources = append(sources, &t.YAMLTarget)
+	}
+	for i := range t.Targets {
+		sources = append(sources, inherit(t.Targets[i], &t.YAMLTarget))
+	}
+
+	d := YAMLConfig{
+		Debug:               c.Debug,
+		DryRun:              c.DryRun,
+		Prometheus:          c.Prometheus,
+		Status:              c.Status,
+		Log:                 c.Log,
+		HostIDFile:          t.HostIDFile,
+		ShutdownGracePeriod: c.ShutdownGracePeriod,
+	}
+	for i, target := range c.Targets {
+		y := *sources[i]
+		y.Community, y.CommunityFile = mask(target.Community), ""
+		y.Transport = target.Transport
+		y.Mibs = target.MIBs
+		y.Mackerel = nil
+		if target.Mackerel != nil {
+			m := *target.Mackerel
+			m.ApiKey = mask(m.ApiKey)
+			y.Mackerel = &m
+		}
+		d.Targets = append(d.Targets, &y)
+	}
+	for _, s := range c.Sinks {
+		n := *s
+		n.Token = mask(n.Token)
+		if n.Headers != nil {
+			n.Headers = maps.Clone(n.Headers)
+			for k := range n.Headers {
+				n.Headers[k] = masked
+			}
+		}
+		d.Sinks = append(d.Sinks, &n)
+	}
+	if c.MackerelService != nil {
+		ms := *c.MackerelService
+		ms.ApiKey = mask(ms.ApiKey)
+		d.MackerelService = &ms
+	}
+
+	var doc yaml.Node
+	if err = doc.Encode(d); err != nil {
+		return nil, err
+	}
+	// the top level is not a target.
+	removeKeys(&doc, "community", "target")
+	return yaml.Marshal(&doc)
+}
+
+func mask(s string) string {
+	if s == "" {
+		return ""
+	}
+	return masked
+}
@@ -0,0 +1,193 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/yseto/switch-traffic-to-mackerel/mib"
+)
+
+type Interface struct {
+	// Include and Exclude match ifDescr.
+	Include      Patterns `yaml:"include,omitempty"`
+	Exclude      Patterns `yaml:"exclude,omitempty"`
+	IncludeAlias Patterns `yaml:"include-alias,omitempty"`
+	ExcludeAlias Patterns `yaml:"exclude-alias,omitempty"`
+	// IfIndex are ifIndexes or ranges of them, such as 1-48.
+	IfIndex []string `yaml:"if-index,omitempty"`
+	// IfType are names of IANAifType such as ethernetCsmacd, or numbers.
+	IfType []string `yaml:"if-type,omitempty"`
+	// MinSpeed and MaxSpeed are ifHighSpeed, Mbps.
+	MinSpeed uint64 `yaml:"min-speed,omitempty"`
+	MaxSpeed uint64 `yaml:"max-speed,omitempty"`
+	// SkipUnused excludes interfaces which have never carried traffic.
+	SkipUnused bool `yaml:"skip-unused,omitempty"`
+}
+
+// Patterns are regular expressions, written as a string or a list of them.
+type Patterns []string
+
+func (p *Patterns) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*p = Patterns{value.Value}
+		return nil
+	}
+	var s []string
+	if err := value.Decode(&s); err != nil {
+		return err
+	}
+	*p = s
+	return nil
+}
+
+// InterfaceFilter chooses interfaces to collect.
+// an interface is chosen when it matches all of include conditions, and then none of exclude conditions.
+// empty conditions are not used.
+type InterfaceFilter struct {
+	// Include matches when one of them matches.
+	Include      []*regexp.Regexp
+	Exclude      []*regexp.Regexp
+	IncludeAlias []*regexp.Regexp
+	ExcludeAlias []*regexp.Regexp
+	IfIndex      []IndexRange
+	IfType       []uint64
+	MinSpeed     uint64
+	MaxSpeed     uint64
+	SkipUnused   bool
+}
+
+// IndexRange is ifIndexes from From to To, inclusive.
+type IndexRange struct {
+	From uint64
+	To   uint64
+}
+
+func convertInterface(t *Interface) (InterfaceFilter, error) {
+	var f InterfaceFilter
+	if t == nil {
+		return f, nil
+	}
+
+	var err error
+	patterns := []struct {
+		key      string
+		source   Patterns
+		compiled *[]*regexp.Regexp
+	}{
+		{"include", t.Include, &f.Include},
+		{"exclude", t.Exclude, &f.Exclude},
+		{"include-alias", t.IncludeAlias, &f.IncludeAlias},
+		{"exclude-alias", t.ExcludeAlias, &f.ExcludeAlias},
+	}
+	for _, p := range patterns {
+		if *p.compiled, err = compilePatterns(p.source); err != nil {
+			return f, fmt.Errorf("interface.%s: %w", p.key, err)
+		}
+	}
+
+	for _, s := range t.IfIndex {
+		r, err := parseIndexRange(s)
+		if err != nil {
+			return f, fmt.Errorf("interface.if-index: %w", err)
+		}
+		f.IfIndex = append(f.IfIndex, r)
+	}
+	for _, s := range t.IfType {
+		ifType, err := mib.IfType(s)
+		if err != nil {
+			return f, fmt.Errorf("interface.if-type: %w", err)
+		}
+		f.IfType = append(f.IfType, ifType)
+	}
+
+	if t.MaxSpeed > 0 && t.MinSpeed > t.MaxSpeed {
+		return f, fmt.Errorf("interface.min-speed is greater than max-speed")
+	}
+	f.MinSpeed, f.MaxSpeed = t.MinSpeed, t.MaxSpeed
+	f.SkipUnused = t.SkipUnused
+	return f, nil
+}
+
+// compilePatterns compiles patterns, empty ones are ignored.
+func compilePatterns(patterns Patterns) ([]*regexp.Regexp, error) {
+	var compiled []*regexp.Regexp
+	for _, p := range patterns {
+		if p == "" {
+			continue
+		}
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, err
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
+
+// parseIndexRange accepts an ifIndex such as 10, or a range such as 1-48.
+func parseIndexRange(s string) (IndexRange, error) {
+	from, to, found := strings.Cut(s, "-")
+	f, err := strconv.ParseUint(strings.TrimSpace(from), 10, 64)
+	if err != nil {
+		return IndexRange{}, fmt.Errorf("%s is not valid", s)
+	}
+	if !found {
+		return IndexRange{From: f, To: f}, nil
+	}
+	t, err := strconv.ParseUint(strings.TrimSpace(to), 10, 64)
+	if err != nil || t < f {
+		return IndexRange{}, fmt.Errorf("%s is not valid", s)
+	}
+	return IndexRange{From: f, To: t}, nil
+}
+
+// InterfaceGroup collects mibs of interfaces matching the filter.
+type InterfaceGroup struct {
+	Name      string     `yaml:"name"`
+	Interface *Interface `yaml:"interface,omitempty"`
+	Mibs      []string   `yaml:"mibs,omitempty"`
+}
+
+// InterfaceGroupFilter is an interface group, an interface belongs to the first matched group.
+type InterfaceGroupFilter struct {
+	Name      string
+	Interface InterfaceFilter
+	MIBs      []string
+}
+
+func convertInterfaceGroup(t *InterfaceGroup) (*InterfaceGroupFilter, error) {
+	if t.Name == "" {
+		return nil, fmt.Errorf("name is needed")
+	}
+	// mib.Validate returns all mibs for empty ones, a group is for fewer mibs.
+	if len(t.Mibs) == 0 {
+		return nil, fmt.Errorf("mibs is needed")
+	}
+	f, err := convertInterface(t.Interface)
+	if err != nil {
+		return nil, err
+	}
+	mibs, err := mib.Validate(t.Mibs)
+	if err != nil {
+		return nil, err
+	}
+	return &InterfaceGroupFilter{Name: t.Name, Interface: f, MIBs: mibs}, nil
+}
+
+// AllMIBs returns mibs of the target and of interface groups, without duplicates.
+func (c *Target) AllMIBs() []string {
+	mibs := slices.Clone(c.MIBs)
+	for _, g := range c.InterfaceGroups {
+		for _, name := range g.MIBs {
+			if !slices.Contains(mibs, name) {
+				mibs = append(mibs, name)
+			}
+		}
+	}
+	return mibs
+}
@@ -0,0 +1,45 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_parseIndexRange(t *testing.T) {
+	tests := []struct {
+		source   string
+		expected IndexRange
+		wantErr  bool
+	}{
+		{source: "10", expected: IndexRange{From: 10, To: 10}},
+		{source: "1-48", expected: IndexRange{From: 1, To: 48}},
+		{source: "1 - 48", expected: IndexRange{From: 1, To: 48}},
+		{source: "48-1", wantErr: true},
+		{source: "ge-0/0/1", wantErr: true},
+		{source: "1-", wantErr: true},
+	}
+	for _, tc := range tests {
+		actual, err := parseIndexRange(tc.source)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("%s: %v", tc.source, err)
+		}
+		if actual != tc.expected {
+			t.Errorf("%s: invalid result %v", tc.source, actual)
+		}
+	}
+}
+
+func TestAllMIBs(t *testing.T) {
+	c := &Target{
+		MIBs: []string{"ifHCInOctets", "ifHCOutOctets"},
+		InterfaceGroups: []*InterfaceGroupFilter{
+			{Name: "uplinks", MIBs: []string{"ifHCInOctets", "ifInErrors"}},
+			{Name: "access", MIBs: []string{"ifInErrors", "ifOutErrors"}},
+		},
+	}
+	expected := []string{"ifHCInOctets", "ifHCOutOctets", "ifInErrors", "ifOutErrors"}
+	if diff := cmp.Diff(c.AllMIBs(), expected); diff != "" {
+		t.Errorf("value is mismatch (-actual +expected):%s", diff)
+	}
+}
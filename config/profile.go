@@ -0,0 +1,189 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"gopkg.in/yaml.v3"
+)
+
+// read decodes the config file, with included files and profiles applied.
+func read(filename string, strict bool) (YAMLConfig, error) {
+	var t YAMLConfig
+	f, err := os.ReadFile(filename)
+	if err != nil {
+		return t, err
+	}
+
+	var doc yaml.Node
+	if err = yaml.Unmarshal(f, &doc); err != nil {
+		return t, err
+	}
+	// an empty file has no document.
+	if doc.Kind == yaml.DocumentNode && len(doc.Content) > 0 && doc.Content[0].Kind == yaml.MappingNode {
+		if err = applyProfiles(doc.Content[0], filepath.Dir(filename)); err != nil {
+			return t, err
+		}
+		if f, err = yaml.Marshal(&doc); err != nil {
+			return t, err
+		}
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader(f))
+	dec.KnownFields(strict)
+	// an empty file is decoded as io.EOF.
+	if err = dec.Decode(&t); err != nil && !errors.Is(err, io.EOF) {
+		return t, err
+	}
+	return t, nil
+}
+
+// applyProfiles merges profiles into the top level and targets referring them,
+// and removes include, profiles and profile.
+func applyProfiles(root *yaml.Node, dir string) error {
+	profiles := make(map[string]*yaml.Node)
+	if err := addProfiles(profiles, mappingValue(root, "profiles"), "profiles"); err != nil {
+		return err
+	}
+
+	if include := mappingValue(root, "include"); include != nil {
+		// a pattern or a list of them.
+		var patterns []string
+		if include.Kind == yaml.ScalarNode {
+			patterns = []string{include.Value}
+		} else if err := include.Decode(&patterns); err != nil {
+			return fmt.Errorf("include: %w", err)
+		}
+		for _, pattern := range patterns {
+			files, err := filepath.Glob(resolvePath(dir, pattern))
+			if err != nil {
+				return fmt.Errorf("include: %w", err)
+			}
+			for _, file := range files {
+				if err := includeProfiles(profiles, file); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	removeKeys(root, "include", "profiles")
+
+	if err := applyProfile(root, profiles); err != nil {
+		return err
+	}
+	if targets := mappingValue(root, "targets"); targets != nil && targets.Kind == yaml.SequenceNode {
+		for i, target := range targets.Content {
+			if err := applyProfile(target, profiles); err != nil {
+				return fmt.Errorf("targets[%d]: %w", i, err)
+			}
+		}
+	}
+	return nil
+}
+
+// includeProfiles adds profiles in the included file, which has only profiles.
+func includeProfiles(profiles map[string]*yaml.Node, filename string) error {
+	f, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	var doc yaml.Node
+	if err = yaml.Unmarshal(f, &doc); err != nil {
+		return fmt.Errorf("%s: %w", filename, err)
+	}
+	if len(doc.Content) == 0 {
+		return nil
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return fmt.Errorf("%s: not a mapping", filename)
+	}
+	for i := 0; i < len(root.Content); i += 2 {
+		if key := root.Content[i].Value; key != "profiles" {
+			return fmt.Errorf("%s: %s is not allowed in included files", filename, key)
+		}
+	}
+	if err = addProfiles(profiles, mappingValue(root, "profiles"), "profiles"); err != nil {
+		return fmt.Errorf("%s: %w", filename, err)
+	}
+	return nil
+}
+
+func addProfiles(profiles map[string]*yaml.Node, m *yaml.Node, key string) error {
+	if m == nil {
+		return nil
+	}
+	if m.Kind != yaml.MappingNode {
+		return fmt.Errorf("%s is not a mapping", key)
+	}
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		name, profile := m.Content[i].Value, m.Content[i+1]
+		if _, ok := profiles[name]; ok {
+			return fmt.Errorf("profile %s is duplicated", name)
+		}
+		if profile.Kind != yaml.MappingNode {
+			return fmt.Errorf("profile %s is not a mapping", name)
+		}
+		if mappingValue(profile, "target") != nil || mappingValue(profile, "profile") != nil {
+			return fmt.Errorf("profile %s: target and profile are not allowed", name)
+		}
+		profiles[name] = profile
+	}
+	return nil
+}
+
+// applyProfile replaces the target with the profile overridden by the target.
+func applyProfile(target *yaml.Node, profiles map[string]*yaml.Node) error {
+	if target.Kind != yaml.MappingNode {
+		return nil
+	}
+	ref := mappingValue(target, "profile")
+	if ref == nil {
+		return nil
+	}
+	profile, ok := profiles[ref.Value]
+	if !ok {
+		return fmt.Errorf("profile %s is not found", ref.Value)
+	}
+	removeKeys(target, "profile")
+	target.Content = mergeNode(profile, target).Content
+	return nil
+}
+
+// mergeNode returns base overridden by override. mappings are merged by key, and other values are replaced.
+// base is not modified, as a profile is shared by targets.
+func mergeNode(base, override *yaml.Node) *yaml.Node {
+	if base.Kind != yaml.MappingNode || override.Kind != yaml.MappingNode {
+		return override
+	}
+	merged := *base
+	merged.Content = nil
+	for i := 0; i+1 < len(base.Content); i += 2 {
+		key, value := base.Content[i], base.Content[i+1]
+		if v := mappingValue(override, key.Value); v != nil {
+			value = mergeNode(value, v)
+		}
+		merged.Content = append(merged.Content, key, value)
+	}
+	for i := 0; i+1 < len(override.Content); i += 2 {
+		if mappingValue(base, override.Content[i].Value) == nil {
+			merged.Content = append(merged.Content, override.Content[i], override.Content[i+1])
+		}
+	}
+	return &merged
+}
+
+func removeKeys(m *yaml.Node, keys ...string) {
+	var content []*yaml.Node
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if !slices.Contains(keys, m.Content[i].Value) {
+			content = append(content, m.Content[i], m.Content[i+1])
+		}
+	}
+	m.Content = content
+}
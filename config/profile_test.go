@@ -0,0 +1,184 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"gopkg.in/yaml.v3"
+)
+
+func Test_read_profiles(t *testing.T) {
+	include := "^ge-"
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "profiles.d"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"profiles.d/juniper.yaml": `profiles:
+  juniper-ex:
+    mibs: [ifHCInOctets, ifHCOutOctets]
+    skip-linkdown: true
+    interface:
+      include: ^ge-
+    mackerel:
+      roles: [network:switch]
+`,
+		"profiles.d/README": "not included",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		source   string
+		expected []*YAMLTarget
+		wantErr  bool
+	}{
+		{
+			name: "profiles in the file and included files",
+			source: `include: profiles.d/*.yaml
+profiles:
+  small:
+    mibs: [ifInOctets, ifOutOctets]
+community: public
+targets:
+  - target: 192.0.2.1
+    profile: juniper-ex
+  - target: 192.0.2.2
+    profile: juniper-ex
+    skip-linkdown: false
+    mackerel:
+      name: sw2
+  - target: 192.0.2.3
+    profile: small
+`,
+			expected: []*YAMLTarget{
+				{
+					Target:       "192.0.2.1",
+					Mibs:         []string{"ifHCInOctets", "ifHCOutOctets"},
+					SkipLinkdown: true,
+					Interface:    &Interface{Include: Patterns{include}},
+					Mackerel:     &Mackerel{Roles: []string{"network:switch"}},
+				},
+				{
+					Target:    "192.0.2.2",
+					Mibs:      []string{"ifHCInOctets", "ifHCOutOctets"},
+					Interface: &Interface{Include: Patterns{include}},
+					Mackerel:  &Mackerel{Name: "sw2", Roles: []string{"network:switch"}},
+				},
+				{
+					Target: "192.0.2.3",
+					Mibs:   []string{"ifInOctets", "ifOutOctets"},
+				},
+			},
+		},
+		{
+			name:    "unknown profile",
+			source:  "targets:\n  - target: 192.0.2.1\n    profile: unknown\n",
+			wantErr: true,
+		},
+		{
+			name:    "duplicated profile",
+			source:  "include: profiles.d/*.yaml\nprofiles:\n  juniper-ex:\n    mibs: [ifInOctets]\n",
+			wantErr: true,
+		},
+		{
+			name:    "target in a profile",
+			source:  "profiles:\n  p:\n    target: 192.0.2.1\n",
+			wantErr: true,
+		},
+	}
+
+	filename := filepath.Join(dir, "config.yaml")
+	for _, tc := range tests {
+		if err := os.WriteFile(filename, []byte(tc.source), 0644); err != nil {
+			t.Fatal(err)
+		}
+		actual, err := read(filename, true)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("%s: %v", tc.name, err)
+		}
+		if tc.wantErr {
+			continue
+		}
+		if diff := cmp.Diff(actual.Targets, tc.expected); diff != "" {
+			t.Errorf("%s: value is mismatch (-actual +expected):%s", tc.name, diff)
+		}
+	}
+}
+
+func Test_includeProfiles(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "targets.yaml")
+	if err := os.WriteFile(filename, []byte("targets:\n  - target: 192.0.2.1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := includeProfiles(map[string]*yaml.Node{}, filename); err == nil {
+		t.Error("targets are included")
+	}
+}
+
+func Test_Dump(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "config.yaml")
+	source := `profiles:
+  switch:
+    mibs: [ifHCInOctets]
+    mackerel:
+      roles: [network:switch]
+community: secret-community
+mackerel:
+  x-api-key: secret-apikey
+targets:
+  - target: 192.0.2.1
+    profile: switch
+    mackerel:
+      host-id: abcdef
+sinks:
+  - type: otlp
+    url: http://localhost:4318
+    headers:
+      Authorization: Bearer secret-token
+`
+	if err := os.WriteFile(filename, []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	actual, err := Dump(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `targets:
+    - community: '********'
+      target: 192.0.2.1
+      transport: udp
+      mibs:
+        - ifHCInOctets
+      mackerel:
+        host-id: abcdef
+        x-api-key: '********'
+        inventory-interval: 1h0m0s
+        interface-interval: 1h0m0s
+        roles:
+            - network:switch
+sinks:
+    - type: otlp
+      url: http://localhost:4318
+      headers:
+        Authorization: '********'
+log:
+    format: text
+    level: info
+    rate-limit-interval: 1m0s
+    rate-limit-burst: 5
+shutdown-grace-period: 10s
+`
+	if diff := cmp.Diff(string(actual), expected); diff != "" {
+		t.Errorf("value is mismatch (-actual +expected):%s", diff)
+	}
+}
@@ -1,35 +1,193 @@
 package config
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
 	"os"
+	"path/filepath"
+	"sync"
 
 	"gopkg.in/yaml.v3"
 )
 
-func (c *Config) Save(hostID string) error {
-	stat, err := os.Stat(loadedFilename)
+// saveMu serializes read-modify-write of files, as targets are initialized concurrently.
+var saveMu sync.Mutex
+
+// Save writes the host id of the target to host-id-file when configured, otherwise to the loaded config file.
+// the config file is edited as a node tree, so that comments and other keys are kept.
+func (c *Target) Save(hostID string) error {
+	saveMu.Lock()
+	defer saveMu.Unlock()
+
+	if c.hostIDFile != "" {
+		return saveHostIDFile(c.hostIDFile, c.Target, hostID)
+	}
+
+	stat, err := os.Stat(c.filename)
+	if err != nil {
+		return err
+	}
+	f, err := os.ReadFile(c.filename)
 	if err != nil {
 		return err
 	}
-	perm := stat.Mode()
 
-	// read original config
-	f, err := os.ReadFile(loadedFilename)
+	var doc yaml.Node
+	if err = yaml.Unmarshal(f, &doc); err != nil {
+		return err
+	}
+	if err = setHostID(&doc, c.index, hostID); err != nil {
+		return fmt.Errorf("target %s: %w", c.Target, err)
+	}
+
+	var b bytes.Buffer
+	enc := yaml.NewEncoder(&b)
+	enc.SetIndent(detectIndent(&doc))
+	if err = enc.Encode(&doc); err != nil {
+		return err
+	}
+	if err = enc.Close(); err != nil {
+		return err
+	}
+	return writeFile(c.filename, b.Bytes(), stat.Mode().Perm())
+}
+
+// setHostID sets mackerel > host-id of the target at index, or of the top level when index is -1.
+func setHostID(doc *yaml.Node, index int, hostID string) error {
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return errors.New("config is not a mapping")
+	}
+	target := doc.Content[0]
+	if index >= 0 {
+		targets := mappingValue(target, "targets")
+		if targets == nil || targets.Kind != yaml.SequenceNode || index >= len(targets.Content) {
+			return errors.New("target is not found")
+		}
+		target = targets.Content[index]
+		if target.Kind != yaml.MappingNode {
+			return errors.New("target is not a mapping")
+		}
+	}
+
+	m := mappingValue(target, "mackerel")
+	if m == nil {
+		// mackerel of a profile.
+		m = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		target.Content = append(target.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "mackerel"}, m)
+	}
+	// "mackerel:" without keys.
+	if m.Kind == yaml.ScalarNode && m.Tag == "!!null" {
+		m.Kind, m.Tag, m.Value = yaml.MappingNode, "!!map", ""
+	}
+	if m.Kind != yaml.MappingNode {
+		return errors.New("mackerel is not a mapping")
+	}
+
+	value := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: hostID}
+	if v := mappingValue(m, "host-id"); v != nil {
+		// keeps comments of the value.
+		value.HeadComment, value.LineComment, value.FootComment = v.HeadComment, v.LineComment, v.FootComment
+		*v = *value
+		return nil
+	}
+	key := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "host-id"}
+	m.Content = append([]*yaml.Node{key, value}, m.Content...)
+	return nil
+}
+
+// mappingValue returns the value of the key, or nil.
+func mappingValue(m *yaml.Node, key string) *yaml.Node {
+	if m.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			return m.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// detectIndent returns the indentation of the first nested mapping, 2 when there is none.
+func detectIndent(doc *yaml.Node) int {
+	var walk func(n *yaml.Node) int
+	walk = func(n *yaml.Node) int {
+		if n.Kind == yaml.MappingNode && n.Style&yaml.FlowStyle == 0 {
+			for i := 0; i+1 < len(n.Content); i += 2 {
+				k, v := n.Content[i], n.Content[i+1]
+				if v.Kind == yaml.MappingNode && v.Style&yaml.FlowStyle == 0 && len(v.Content) > 0 && v.Content[0].Line > k.Line {
+					if indent := v.Content[0].Column - k.Column; indent > 0 {
+						return indent
+					}
+				}
+			}
+		}
+		for _, c := range n.Content {
+			if indent := walk(c); indent > 0 {
+				return indent
+			}
+		}
+		return 0
+	}
+	if indent := walk(doc); indent > 0 {
+		return indent
+	}
+	return 2
+}
+
+// loadHostIDFile returns host ids by target. a missing file is empty.
+func loadHostIDFile(filename string) (map[string]string, error) {
+	f, err := os.ReadFile(filename)
+	if errors.Is(err, fs.ErrNotExist) {
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	ids := map[string]string{}
+	if err = yaml.Unmarshal(f, &ids); err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	return ids, nil
+}
+
+func saveHostIDFile(filename, target, hostID string) error {
+	ids, err := loadHostIDFile(filename)
 	if err != nil {
 		return err
 	}
-	var t YAMLConfig
-	err = yaml.Unmarshal(f, &t)
+	ids[target] = hostID
+	b, err := yaml.Marshal(ids)
 	if err != nil {
 		return err
 	}
+	return writeFile(filename, b, 0600)
+}
 
-	// added Mackerel.HostID
-	t.Mackerel.HostID = hostID
-
-	b, err := yaml.Marshal(t)
+// writeFile replaces the file atomically, by renaming a temporary file in the same directory.
+func writeFile(filename string, b []byte, perm fs.FileMode) error {
+	f, err := os.CreateTemp(filepath.Dir(filename), filepath.Base(filename)+".*.tmp")
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(loadedFilename, b, perm)
+	defer os.Remove(f.Name())
+
+	if _, err = f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Chmod(perm); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), filename)
 }
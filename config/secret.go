@@ -0,0 +1,50 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+var envRe = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandEnv replaces ${NAME} with the environment variable. an unset variable is an error.
+func expandEnv(s string) (string, error) {
+	var err error
+	expanded := envRe.ReplaceAllStringFunc(s, func(m string) string {
+		name := envRe.FindStringSubmatch(m)[1]
+		v, ok := os.LookupEnv(name)
+		if !ok && err == nil {
+			err = fmt.Errorf("environment variable %s is not set", name)
+		}
+		return v
+	})
+	return expanded, err
+}
+
+// secret returns the value, or the content of the file such as Kubernetes secrets and systemd credentials.
+// ${NAME} is expanded in both of them. a relative file is in dir, the directory of the config file.
+func secret(dir, key, value, file string) (string, error) {
+	if value != "" && file != "" {
+		return "", fmt.Errorf("%s and %s-file are exclusive", key, key)
+	}
+	if file == "" {
+		v, err := expandEnv(value)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", key, err)
+		}
+		return v, nil
+	}
+
+	filename, err := expandEnv(file)
+	if err != nil {
+		return "", fmt.Errorf("%s-file: %w", key, err)
+	}
+	b, err := os.ReadFile(resolvePath(dir, filename))
+	if err != nil {
+		return "", fmt.Errorf("%s-file: %w", key, err)
+	}
+	// files usually end with a newline.
+	return strings.TrimSpace(string(b)), nil
+}
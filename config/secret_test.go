@@ -0,0 +1,137 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_secret(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("SWITCH_COMMUNITY", "private")
+	t.Setenv("SWITCH_CREDENTIALS", dir)
+	if err := os.WriteFile(filepath.Join(dir, "community"), []byte("from-file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		value    string
+		file     string
+		expected string
+		wantErr  bool
+	}{
+		{
+			name:     "plain",
+			value:    "public",
+			expected: "public",
+		},
+		{
+			name:     "environment variable",
+			value:    "${SWITCH_COMMUNITY}",
+			expected: "private",
+		},
+		{
+			name:     "environment variable in a value",
+			value:    "prefix-${SWITCH_COMMUNITY}-$HOME",
+			expected: "prefix-private-$HOME",
+		},
+		{
+			name:    "unset environment variable",
+			value:   "${SWITCH_UNSET_VARIABLE}",
+			wantErr: true,
+		},
+		{
+			name:     "file",
+			file:     filepath.Join(dir, "community"),
+			expected: "from-file",
+		},
+		{
+			name:     "file with environment variable",
+			file:     "${SWITCH_CREDENTIALS}/community",
+			expected: "from-file",
+		},
+		{
+			name:     "file relative to the config",
+			file:     "community",
+			expected: "from-file",
+		},
+		{
+			name:    "missing file",
+			file:    filepath.Join(dir, "missing"),
+			wantErr: true,
+		},
+		{
+			name:    "both of value and file",
+			value:   "public",
+			file:    filepath.Join(dir, "community"),
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range tests {
+		actual, err := secret(dir, "community", tc.value, tc.file)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("%s: %v", tc.name, err)
+		}
+		if actual != tc.expected {
+			t.Errorf("%s: invalid result %s", tc.name, actual)
+		}
+	}
+}
+
+func Test_convert_secrets(t *testing.T) {
+	dir := t.TempDir()
+	apikeyFile := filepath.Join(dir, "apikey")
+	if err := os.WriteFile(apikeyFile, []byte("file-apikey\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SWITCH_COMMUNITY", "private")
+	t.Setenv("SWITCH_TOKEN", "influx-token")
+
+	c, err := convert(YAMLConfig{
+		YAMLTarget: YAMLTarget{
+			Community: "${SWITCH_COMMUNITY}",
+			Mackerel:  &Mackerel{ApiKeyFile: apikeyFile},
+		},
+		Targets: []*YAMLTarget{
+			{Target: "192.0.2.1", Mackerel: &Mackerel{}},
+			{Target: "192.0.2.2", CommunityFile: "apikey"},
+		},
+		Sinks: []*Sink{
+			{Type: SinkInfluxDB, URL: "http://localhost:8086", Token: "${SWITCH_TOKEN}"},
+			{Type: SinkOTLP, URL: "http://localhost:4318", Headers: map[string]string{"Authorization": "Bearer ${SWITCH_TOKEN}"}},
+		},
+		MackerelService: &MackerelService{Name: "network", ApiKeyFile: apikeyFile},
+	}, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type result struct {
+		Communities []string
+		ApiKey      string
+		Token       string
+		Header      string
+		ServiceKey  string
+	}
+	actual := result{
+		Communities: []string{c.Targets[0].Community, c.Targets[1].Community},
+		ApiKey:      c.Targets[0].Mackerel.ApiKey,
+		Token:       c.Sinks[0].Token,
+		Header:      c.Sinks[1].Headers["Authorization"],
+		ServiceKey:  c.MackerelService.ApiKey,
+	}
+	expected := result{
+		Communities: []string{"private", "file-apikey"},
+		ApiKey:      "file-apikey",
+		Token:       "influx-token",
+		Header:      "Bearer influx-token",
+		ServiceKey:  "file-apikey",
+	}
+	if diff := cmp.Diff(actual, expected); diff != "" {
+		t.Errorf("value is mismatch (-actual +expected):%s", diff)
+	}
+}
@@ -0,0 +1,33 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+const defaultPort = 161
+
+// splitTarget accepts host, host:port, IPv6 address and [IPv6 address]:port.
+func splitTarget(target string) (string, uint16, error) {
+	if net.ParseIP(target) != nil {
+		return target, defaultPort, nil
+	}
+	if strings.HasPrefix(target, "[") && strings.HasSuffix(target, "]") {
+		return target[1 : len(target)-1], defaultPort, nil
+	}
+	if !strings.Contains(target, ":") {
+		return target, defaultPort, nil
+	}
+
+	host, port, err := net.SplitHostPort(target)
+	if err != nil {
+		return "", 0, fmt.Errorf("target %s is not valid : %w", target, err)
+	}
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil || p == 0 {
+		return "", 0, fmt.Errorf("target %s is not valid port", target)
+	}
+	return host, uint16(p), nil
+}
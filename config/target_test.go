@@ -0,0 +1,36 @@
+package config
+
+import (
+	"testing"
+)
+
+func Test_splitTarget(t *testing.T) {
+	tests := []struct {
+		target  string
+		host    string
+		port    uint16
+		wantErr bool
+	}{
+		{target: "192.0.2.1", host: "192.0.2.1", port: 161},
+		{target: "192.0.2.1:1161", host: "192.0.2.1", port: 1161},
+		{target: "2001:db8::1", host: "2001:db8::1", port: 161},
+		{target: "[2001:db8::1]", host: "2001:db8::1", port: 161},
+		{target: "[2001:db8::1]:1161", host: "2001:db8::1", port: 1161},
+		{target: "sw1.example.com", host: "sw1.example.com", port: 161},
+		{target: "sw1.example.com:1161", host: "sw1.example.com", port: 1161},
+		{target: "sw1.example.com:snmp", wantErr: true},
+		{target: "sw1.example.com:0", wantErr: true},
+		{target: "sw1.example.com:65536", wantErr: true},
+		{target: "[2001:db8::1", wantErr: true},
+	}
+
+	for _, tc := range tests {
+		host, port, err := splitTarget(tc.target)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("%s: %v", tc.target, err)
+		}
+		if host != tc.host || port != tc.port {
+			t.Errorf("%s: invalid result %s %d", tc.target, host, port)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/yseto/switch-traffic-to-mackerel/config"
+)
+
+// configCommand has subcommands for the config, only dump for now.
+func configCommand(_ context.Context, args []string) error {
+	if len(args) == 0 || args[0] != "dump" {
+		return fmt.Errorf("usage: %s config dump [flags]", os.Args[0])
+	}
+
+	fs := flag.NewFlagSet("config dump", flag.ExitOnError)
+	var filename string
+	fs.StringVar(&filename, "config", "config.yaml", "config `filename`")
+	fs.Parse(args[1:]) // nolint
+
+	b, err := config.Dump(filename)
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(b)
+	return err
+}
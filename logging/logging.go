@@ -0,0 +1,28 @@
+package logging
+
+import (
+	"io"
+	"log/slog"
+
+	"github.com/yseto/switch-traffic-to-mackerel/config"
+)
+
+// New returns a logger written to w. debug overrides the level of c.
+func New(w io.Writer, c *config.Log, debug bool) *slog.Logger {
+	var level slog.Level
+	// validated by config.
+	level.UnmarshalText([]byte(c.Level)) // nolint
+	if debug {
+		level = slog.LevelDebug
+	}
+
+	opts := &slog.HandlerOptions{Level: level}
+	var h slog.Handler
+	switch c.Format {
+	case config.LogFormatJSON:
+		h = slog.NewJSONHandler(w, opts)
+	default:
+		h = slog.NewTextHandler(w, opts)
+	}
+	return slog.New(NewRateLimitHandler(h, c.RateLimitInterval, c.RateLimitBurst))
+}
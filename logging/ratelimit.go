@@ -0,0 +1,131 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// RateLimitHandler drops warnings and errors repeated too often, such as timeouts of a device being down.
+// records are identified by the level, the message and the target attribute.
+// the number of dropped records is added to the next record passed.
+type RateLimitHandler struct {
+	handler slog.Handler
+	limiter *limiter
+	// target given by WithAttrs.
+	target string
+}
+
+func NewRateLimitHandler(h slog.Handler, interval time.Duration, burst int) *RateLimitHandler {
+	return &RateLimitHandler{
+		handler: h,
+		limiter: &limiter{
+			interval: interval,
+			burst:    burst,
+			windows:  make(map[string]*window),
+			now:      time.Now,
+		},
+	}
+}
+
+func (h *RateLimitHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.handler.Enabled(ctx, level)
+}
+
+func (h *RateLimitHandler) Handle(ctx context.Context, r slog.Record) error {
+	// debug and info are not repeated by failures.
+	if r.Level < slog.LevelWarn {
+		return h.handler.Handle(ctx, r)
+	}
+
+	target := h.target
+	r.Attrs(func(a slog.Attr) bool {
+		if a.Key == "target" {
+			target = a.Value.String()
+			return false
+		}
+		return true
+	})
+
+	ok, suppressed := h.limiter.allow(r.Level.String() + "\x00" + r.Message + "\x00" + target)
+	if !ok {
+		return nil
+	}
+	if suppressed > 0 {
+		r = r.Clone()
+		r.AddAttrs(slog.Int("suppressed", suppressed))
+	}
+	return h.handler.Handle(ctx, r)
+}
+
+func (h *RateLimitHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	target := h.target
+	for _, a := range attrs {
+		if a.Key == "target" {
+			target = a.Value.String()
+		}
+	}
+	return &RateLimitHandler{handler: h.handler.WithAttrs(attrs), limiter: h.limiter, target: target}
+}
+
+func (h *RateLimitHandler) WithGroup(name string) slog.Handler {
+	return &RateLimitHandler{handler: h.handler.WithGroup(name), limiter: h.limiter, target: h.target}
+}
+
+type limiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	burst    int
+	windows  map[string]*window
+	// pruned is the time expired windows were deleted last.
+	pruned time.Time
+
+	now func() time.Time
+}
+
+type window struct {
+	start      time.Time
+	count      int
+	suppressed int
+}
+
+// allow reports whether a record of key is passed, and the number of records dropped before it.
+func (l *limiter) allow(key string) (bool, int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	w, ok := l.windows[key]
+	if !ok || now.Sub(w.start) >= l.interval {
+		var suppressed int
+		if ok {
+			suppressed = w.suppressed
+		} else {
+			l.prune(now)
+		}
+		l.windows[key] = &window{start: now, count: 1}
+		return true, suppressed
+	}
+	if w.count < l.burst {
+		w.count++
+		return true, 0
+	}
+	w.suppressed++
+	return false, 0
+}
+
+// prune deletes expired windows at most once an interval, keys include changing error texts.
+// suppressed records are reported if the key is repeated in the next interval, dropped after that.
+func (l *limiter) prune(now time.Time) {
+	if now.Sub(l.pruned) < l.interval {
+		return
+	}
+	l.pruned = now
+	for key, w := range l.windows {
+		expired := now.Sub(w.start)
+		if expired >= 2*l.interval || (expired >= l.interval && w.suppressed == 0) {
+			delete(l.windows, key)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package logging
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRateLimitHandler(t *testing.T) {
+	var buf bytes.Buffer
+	h := NewRateLimitHandler(slog.NewTextHandler(&buf, &slog.HandlerOptions{
+		ReplaceAttr: func(_ []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		},
+	}), time.Minute, 2)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	h.limiter.now = func() time.Time { return now }
+
+	logger := slog.New(h)
+	sw1 := logger.With("target", "sw1")
+	for range 4 {
+		sw1.Warn("collect failed", "phase", "collect")
+		logger.Warn("collect failed", "target", "sw2")
+		logger.Info("collected", "target", "sw1")
+	}
+	now = now.Add(time.Minute)
+	sw1.Warn("collect failed", "phase", "collect")
+
+	expected := []string{
+		`level=WARN msg="collect failed" target=sw1 phase=collect`,
+		`level=WARN msg="collect failed" target=sw2`,
+		`level=INFO msg=collected target=sw1`,
+		`level=WARN msg="collect failed" target=sw1 phase=collect`,
+		`level=WARN msg="collect failed" target=sw2`,
+		`level=INFO msg=collected target=sw1`,
+		`level=INFO msg=collected target=sw1`,
+		`level=INFO msg=collected target=sw1`,
+		`level=WARN msg="collect failed" target=sw1 phase=collect suppressed=2`,
+	}
+	actual := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if d := cmp.Diff(actual, expected); d != "" {
+		t.Errorf("value is mismatch (-actual +expected):%s", d)
+	}
+}
+
+func TestRateLimitHandlerPrune(t *testing.T) {
+	var buf bytes.Buffer
+	h := NewRateLimitHandler(slog.NewTextHandler(&buf, nil), time.Minute, 1)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	h.limiter.now = func() time.Time { return now }
+
+	logger := slog.New(h)
+	for i := range 3 {
+		logger.Warn("collect failed", "target", "sw1", "error", i)
+	}
+	logger.Warn("collect failed: timeout 1", "target", "sw1")
+	now = now.Add(time.Minute)
+	logger.Warn("collect failed: timeout 2", "target", "sw1")
+
+	// windows without suppressed records are deleted after the interval.
+	if _, ok := h.limiter.windows["WARN\x00collect failed: timeout 1\x00sw1"]; ok {
+		t.Error("expired window is not deleted")
+	}
+	if len(h.limiter.windows) != 2 {
+		t.Errorf("invalid windows %d", len(h.limiter.windows))
+	}
+
+	now = now.Add(2 * time.Minute)
+	logger.Warn("collect failed: timeout 3", "target", "sw1")
+	if len(h.limiter.windows) != 1 {
+		t.Errorf("invalid windows %d", len(h.limiter.windows))
+	}
+}
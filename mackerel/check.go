@@ -0,0 +1,45 @@
+package mackerel
+
+import (
+	"cmp"
+	"fmt"
+	"os"
+
+	mackerel "github.com/mackerelio/mackerel-client-go"
+)
+
+type checkClient interface {
+	GetOrg() (*mackerel.Org, error)
+	FindHost(id string) (*mackerel.Host, error)
+}
+
+// Check verifies the API key, and the host when hostID is given.
+// it returns a description of the organization and the host.
+func Check(apikey, hostID string) (string, error) {
+	baseURL := cmp.Or(os.Getenv("MACKEREL_APIBASE"), "https://api.mackerelio.com/")
+	apikey = cmp.Or(os.Getenv("MACKEREL_APIKEY"), apikey)
+
+	client, err := mackerel.NewClientWithOptions(apikey, baseURL, false)
+	if err != nil {
+		return "", err
+	}
+	return check(client, hostID)
+}
+
+func check(client checkClient, hostID string) (string, error) {
+	org, err := client.GetOrg()
+	if err != nil {
+		return "", fmt.Errorf("x-api-key is not valid: %w", err)
+	}
+	if hostID == "" {
+		return fmt.Sprintf("organization %s", org.Name), nil
+	}
+	host, err := client.FindHost(hostID)
+	if err != nil {
+		return "", fmt.Errorf("host-id %s is not found: %w", hostID, err)
+	}
+	if host.IsRetired {
+		return "", fmt.Errorf("host-id %s is retired", hostID)
+	}
+	return fmt.Sprintf("organization %s, host %s", org.Name, host.Name), nil
+}
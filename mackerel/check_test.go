@@ -0,0 +1,76 @@
+package mackerel
+
+import (
+	"testing"
+
+	"github.com/mackerelio/mackerel-client-go"
+)
+
+type checkClientMock struct {
+	orgErr error
+	host   *mackerel.Host
+}
+
+func (m *checkClientMock) GetOrg() (*mackerel.Org, error) {
+	if m.orgErr != nil {
+		return nil, m.orgErr
+	}
+	return &mackerel.Org{Name: "example"}, nil
+}
+
+func (m *checkClientMock) FindHost(id string) (*mackerel.Host, error) {
+	if m.host == nil || m.host.ID != id {
+		return nil, &mackerel.APIError{StatusCode: 404, Message: "Host Not Found."}
+	}
+	return m.host, nil
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name     string
+		mock     *checkClientMock
+		hostID   string
+		expected string
+		wantErr  bool
+	}{
+		{
+			name:     "without host-id",
+			mock:     &checkClientMock{},
+			expected: "organization example",
+		},
+		{
+			name:     "with host-id",
+			mock:     &checkClientMock{host: &mackerel.Host{ID: "1234567890", Name: "sw1"}},
+			hostID:   "1234567890",
+			expected: "organization example, host sw1",
+		},
+		{
+			name:    "invalid x-api-key",
+			mock:    &checkClientMock{orgErr: &mackerel.APIError{StatusCode: 401, Message: "Authentication failed."}},
+			wantErr: true,
+		},
+		{
+			name:    "host not found",
+			mock:    &checkClientMock{},
+			hostID:  "1234567890",
+			wantErr: true,
+		},
+		{
+			name:    "host retired",
+			mock:    &checkClientMock{host: &mackerel.Host{ID: "1234567890", IsRetired: true}},
+			hostID:  "1234567890",
+			wantErr: true,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			actual, err := check(tc.mock, tc.hostID)
+			if (err != nil) != tc.wantErr {
+				t.Errorf("invalid error %v", err)
+			}
+			if actual != tc.expected {
+				t.Errorf("invalid result %s", actual)
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package mackerel
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	mackerel "github.com/mackerelio/mackerel-client-go"
+)
+
+// SendError is returned from Send, classified by whether a retry may succeed.
+type SendError struct {
+	Err        error
+	StatusCode int
+	// Message is the error message extracted from the response body.
+	Message string
+}
+
+func (e *SendError) Error() string {
+	if e.StatusCode == 0 {
+		return fmt.Sprintf("send failed: %v", e.Err)
+	}
+	return fmt.Sprintf("send failed: status %d: %s", e.StatusCode, e.Message)
+}
+
+func (e *SendError) Unwrap() error {
+	return e.Err
+}
+
+// Retryable reports true for network errors, 429 and 5xx responses.
+func (e *SendError) Retryable() bool {
+	switch {
+	case e.StatusCode == 0:
+		return true
+	case e.StatusCode == http.StatusTooManyRequests:
+		return true
+	case e.StatusCode >= 500:
+		return true
+	}
+	return false
+}
+
+func classifyError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var apiErr *mackerel.APIError
+	if errors.As(err, &apiErr) {
+		return &SendError{
+			Err:        err,
+			StatusCode: apiErr.StatusCode,
+			Message:    apiErr.Message,
+		}
+	}
+	return &SendError{Err: err}
+}
@@ -0,0 +1,56 @@
+package mackerel
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/mackerelio/mackerel-client-go"
+)
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		retryable bool
+	}{
+		{
+			name:      "network error",
+			err:       errors.New("connection refused"),
+			retryable: true,
+		},
+		{
+			name:      "too many requests",
+			err:       &mackerel.APIError{StatusCode: 429},
+			retryable: true,
+		},
+		{
+			name:      "server error",
+			err:       &mackerel.APIError{StatusCode: 503},
+			retryable: true,
+		},
+		{
+			name:      "bad request",
+			err:       &mackerel.APIError{StatusCode: 400, Message: "invalid metric name"},
+			retryable: false,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var sendErr *SendError
+			if !errors.As(classifyError(tc.err), &sendErr) {
+				t.Fatal("invalid error type")
+			}
+			if sendErr.Retryable() != tc.retryable {
+				t.Error("invalid retryable")
+			}
+			if !errors.Is(sendErr, tc.err) {
+				t.Error("invalid unwrap")
+			}
+		})
+	}
+
+	if classifyError(nil) != nil {
+		t.Error("invalid nil")
+	}
+}
@@ -47,4 +47,101 @@ var graphDefs = []*mackerel.GraphDefsParam{
 			},
 		},
 	},
+	// self monitoring
+	{
+		Name:        "custom.stm.snmp_rtt",
+		Unit:        "milliseconds",
+		DisplayName: "STM SNMP RTT",
+		Metrics: []*mackerel.GraphDefsMetric{
+			{
+				Name:        "custom.stm.snmp_rtt.average",
+				DisplayName: "average",
+			},
+		},
+	},
+	{
+		Name:        "custom.stm.collection_duration",
+		Unit:        "milliseconds",
+		DisplayName: "STM Collection Duration",
+		Metrics: []*mackerel.GraphDefsMetric{
+			{
+				Name:        "custom.stm.collection_duration.total",
+				DisplayName: "total",
+			},
+		},
+	},
+	{
+		Name:        "custom.stm.snmp_requests",
+		Unit:        "integer",
+		DisplayName: "STM SNMP Requests",
+		Metrics: []*mackerel.GraphDefsMetric{
+			{
+				Name:        "custom.stm.snmp_requests.pdus",
+				DisplayName: "PDUs",
+			},
+			{
+				Name:        "custom.stm.snmp_requests.varbinds",
+				DisplayName: "varbinds",
+			},
+		},
+	},
+	{
+		Name:        "custom.stm.snmp_errors",
+		Unit:        "integer",
+		DisplayName: "STM SNMP Errors",
+		Metrics: []*mackerel.GraphDefsMetric{
+			{
+				Name:        "custom.stm.snmp_errors.timeouts",
+				DisplayName: "timeouts",
+			},
+			{
+				Name:        "custom.stm.snmp_errors.retries",
+				DisplayName: "retries",
+			},
+		},
+	},
+	{
+		Name:        "custom.stm.interfaces",
+		Unit:        "integer",
+		DisplayName: "STM Interfaces",
+		Metrics: []*mackerel.GraphDefsMetric{
+			{
+				Name:        "custom.stm.interfaces.collected",
+				DisplayName: "collected",
+			},
+		},
+	},
+	{
+		Name:        "custom.stm.queue_length",
+		Unit:        "integer",
+		DisplayName: "STM Queue Length",
+		Metrics: []*mackerel.GraphDefsMetric{
+			{
+				Name:        "custom.stm.queue_length.*",
+				DisplayName: "%1",
+			},
+		},
+	},
+	{
+		Name:        "custom.stm.dropped",
+		Unit:        "integer",
+		DisplayName: "STM Dropped Values",
+		Metrics: []*mackerel.GraphDefsMetric{
+			{
+				Name:        "custom.stm.dropped.*",
+				DisplayName: "%1",
+			},
+		},
+	},
+	{
+		Name:        "custom.stm.send_latency",
+		Unit:        "milliseconds",
+		DisplayName: "STM Send Latency",
+		Metrics: []*mackerel.GraphDefsMetric{
+			{
+				Name:        "custom.stm.send_latency.*",
+				DisplayName: "%1",
+			},
+		},
+	},
 }
@@ -0,0 +1,78 @@
+package mackerel
+
+import (
+	"reflect"
+
+	mackerel "github.com/mackerelio/mackerel-client-go"
+
+	"github.com/yseto/switch-traffic-to-mackerel/collector"
+)
+
+// metadataNamespace is the namespace of host metadata.
+const metadataNamespace = "switch-traffic-to-mackerel"
+
+type inventory struct {
+	SysDescr    string `json:"sysDescr"`
+	SysObjectID string `json:"sysObjectID"`
+	SysName     string `json:"sysName"`
+	SysLocation string `json:"sysLocation"`
+	SysContact  string `json:"sysContact"`
+	// seconds
+	SysUpTime int64 `json:"sysUpTime"`
+
+	SerialNumber     string `json:"serialNumber,omitempty"`
+	ModelName        string `json:"modelName,omitempty"`
+	FirmwareRevision string `json:"firmwareRevision,omitempty"`
+	SoftwareRevision string `json:"softwareRevision,omitempty"`
+}
+
+func newInventory(info *collector.SystemInfo) *inventory {
+	inv := &inventory{
+		SysDescr:    info.SysDescr,
+		SysObjectID: info.SysObjectID,
+		SysName:     info.SysName,
+		SysLocation: info.SysLocation,
+		SysContact:  info.SysContact,
+		SysUpTime:   int64(info.SysUpTime.Seconds()),
+	}
+	if info.Entity != nil {
+		inv.SerialNumber = info.Entity.SerialNum
+		inv.ModelName = info.Entity.ModelName
+		inv.FirmwareRevision = info.Entity.FirmwareRev
+		inv.SoftwareRevision = info.Entity.SoftwareRev
+	}
+	return inv
+}
+
+// hostMeta shows the inventory on the host page. sysUpTime is excluded, it changes always.
+func hostMeta(info *collector.SystemInfo) mackerel.HostMeta {
+	if info == nil {
+		return mackerel.HostMeta{}
+	}
+	kernel := mackerel.Kernel{
+		"name": info.SysName,
+		"os":   info.SysDescr,
+	}
+	if info.Entity != nil {
+		kernel["machine"] = info.Entity.ModelName
+		kernel["release"] = info.Entity.SoftwareRev
+		kernel["version"] = info.Entity.FirmwareRev
+	}
+	return mackerel.HostMeta{
+		AgentName: metadataNamespace,
+		Kernel:    kernel,
+	}
+}
+
+// UpdateInventory publishes the inventory as host metadata, and updates the host when meta changed.
+// meta is kept only when the update succeeded, so that a failed one is retried next time.
+func (m *Mackerel) UpdateInventory(info *collector.SystemInfo) error {
+	meta := hostMeta(info)
+	if !reflect.DeepEqual(meta, m.meta) {
+		if _, err := m.client.UpdateHost(m.hostID, m.hostParam(meta, m.interfaces)); err != nil {
+			return err
+		}
+		m.meta = meta
+	}
+	return m.client.PutHostMetaData(m.hostID, metadataNamespace, newInventory(info))
+}
@@ -0,0 +1,92 @@
+package mackerel
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mackerelio/mackerel-client-go"
+
+	"github.com/yseto/switch-traffic-to-mackerel/collector"
+)
+
+func TestUpdateInventory(t *testing.T) {
+	mock := &mackerelClientMock{}
+	m := &Mackerel{
+		client: mock,
+		hostID: "0987654321",
+		name:   "sw1",
+		interfaces: []mackerel.Interface{
+			{Name: "main", IPv4Addresses: []string{"192.0.2.1"}},
+		},
+	}
+
+	info := &collector.SystemInfo{
+		SysName:     "sw1",
+		SysObjectID: "1.3.6.1.4.1.9.1.1",
+		SysDescr:    "Cisco IOS Software",
+		SysUpTime:   90 * time.Second,
+		Entity: &collector.Entity{
+			SerialNum:   "FOC1234X0AB",
+			ModelName:   "WS-C2960X-24TS-L",
+			SoftwareRev: "15.2(7)E4",
+		},
+	}
+	// meta is compared with the previous one only after the update succeeded.
+	mock.returnError = errors.New("api error")
+	if err := m.UpdateInventory(info); err == nil {
+		t.Error("error is not returned")
+	}
+	mock.returnError = nil
+	mock.updateParam = mackerel.UpdateHostParam{}
+	if err := m.UpdateInventory(info); err != nil {
+		t.Error(err)
+	}
+
+	expectedUpdate := mackerel.UpdateHostParam{
+		Name: "sw1",
+		Meta: mackerel.HostMeta{
+			AgentName: "switch-traffic-to-mackerel",
+			Kernel: mackerel.Kernel{
+				"name":    "sw1",
+				"os":      "Cisco IOS Software",
+				"machine": "WS-C2960X-24TS-L",
+				"release": "15.2(7)E4",
+				"version": "",
+			},
+		},
+		Interfaces: []mackerel.Interface{
+			{Name: "main", IPv4Addresses: []string{"192.0.2.1"}},
+		},
+	}
+	if diff := cmp.Diff(mock.updateParam, expectedUpdate); diff != "" {
+		t.Errorf("value is mismatch (-actual +expected):%s", diff)
+	}
+
+	expectedMetadata := &inventory{
+		SysDescr:         "Cisco IOS Software",
+		SysObjectID:      "1.3.6.1.4.1.9.1.1",
+		SysName:          "sw1",
+		SysUpTime:        90,
+		SerialNumber:     "FOC1234X0AB",
+		ModelName:        "WS-C2960X-24TS-L",
+		SoftwareRevision: "15.2(7)E4",
+	}
+	if diff := cmp.Diff(mock.metadata, expectedMetadata); diff != "" {
+		t.Errorf("value is mismatch (-actual +expected):%s", diff)
+	}
+
+	// host is not updated when only uptime changed.
+	mock.updateParam = mackerel.UpdateHostParam{}
+	info.SysUpTime = 150 * time.Second
+	if err := m.UpdateInventory(info); err != nil {
+		t.Error(err)
+	}
+	if diff := cmp.Diff(mock.updateParam, mackerel.UpdateHostParam{}); diff != "" {
+		t.Errorf("value is mismatch (-actual +expected):%s", diff)
+	}
+	if mock.metadata.(*inventory).SysUpTime != 150 {
+		t.Error("metadata is not updated")
+	}
+}
@@ -3,12 +3,18 @@ package mackerel
 import (
 	"cmp"
 	"context"
-	"log"
+	"log/slog"
+	"net"
 	"os"
+	"reflect"
+	"slices"
+	"strings"
+	"sync/atomic"
 
 	mackerel "github.com/mackerelio/mackerel-client-go"
 
 	"github.com/yseto/switch-traffic-to-mackerel/collector"
+	"github.com/yseto/switch-traffic-to-mackerel/metric"
 )
 
 type mackerelClient interface {
@@ -16,6 +22,7 @@ type mackerelClient interface {
 	UpdateHost(hostID string, param *mackerel.UpdateHostParam) (string, error)
 	CreateGraphDefs(payloads []*mackerel.GraphDefsParam) error
 	PostHostMetricValuesByHostID(hostID string, metricValues []*mackerel.MetricValue) error
+	PutHostMetaData(hostID, namespace string, metadata mackerel.HostMetaData) error
 }
 
 type Mackerel struct {
@@ -23,13 +30,29 @@ type Mackerel struct {
 	hostID     string
 	targetAddr string
 	name       string
+
+	roles            []string
+	customIdentifier string
+
+	lookupIP func(host string) ([]net.IP, error)
+	logger   atomic.Pointer[slog.Logger]
+
+	// sent on every update of the host.
+	interfaces []mackerel.Interface
+	meta       mackerel.HostMeta
 }
 
 type Arg struct {
-	Apikey     string
-	HostID     string
+	Apikey string
+	HostID string
+	// TargetAddr is an address or a DNS name.
 	TargetAddr string
 	Name       string
+	// service:role
+	Roles            []string
+	CustomIdentifier string
+	// slog.Default() when nil.
+	Logger *slog.Logger
 }
 
 func New(qa *Arg) *Mackerel {
@@ -38,54 +61,56 @@ func New(qa *Arg) *Mackerel {
 
 	client, _ := mackerel.NewClientWithOptions(apikey, baseURL, false)
 
-	return &Mackerel{
+	m := &Mackerel{
 		client:     client,
 		hostID:     qa.HostID,
 		targetAddr: qa.TargetAddr,
 		name:       qa.Name,
+
+		roles:            qa.Roles,
+		customIdentifier: qa.CustomIdentifier,
+
+		lookupIP: net.LookupIP,
 	}
+	m.SetLogger(qa.Logger)
+	return m
 }
 
-// return host ID when create.
-func (m *Mackerel) Init(ifs []collector.Interface) (*string, error) {
-	log.Println("init mackerel")
+// SetLogger replaces the logger, such as on reload of the log config. slog.Default() when nil.
+func (m *Mackerel) SetLogger(logger *slog.Logger) {
+	m.logger.Store(cmp.Or(logger, slog.Default()))
+}
 
-	var interfaces []mackerel.Interface
+// Logger returns the logger, the one replaced by SetLogger.
+func (m *Mackerel) Logger() *slog.Logger {
+	return m.logger.Load()
+}
 
-	if len(ifs) == 0 {
-		interfaces = []mackerel.Interface{
-			{
-				Name:          "main",
-				IPv4Addresses: []string{m.targetAddr},
-			},
-		}
-	} else {
-		for i := range ifs {
-			interfaces = append(interfaces, mackerel.Interface{
-				Name:          ifs[i].IfName,
-				IPv4Addresses: ifs[i].IpAddress,
-				MacAddress:    ifs[i].MacAddress,
-			})
-		}
-	}
+// return host ID when create. info is nil when the inventory is not collected.
+func (m *Mackerel) Init(ifs []collector.Interface, info *collector.SystemInfo) (*string, error) {
+	m.logger.Load().Info("init mackerel", "phase", "init")
+
+	interfaces := m.hostInterfaces(ifs)
+	meta := hostMeta(info)
 
 	var newHostID *string
 	var err error
 	if m.hostID != "" {
-		_, err = m.client.UpdateHost(m.hostID, &mackerel.UpdateHostParam{
-			Name:       m.name,
-			Interfaces: interfaces,
-		})
+		_, err = m.client.UpdateHost(m.hostID, m.hostParam(meta, interfaces))
 	} else {
-		m.hostID, err = m.client.CreateHost(&mackerel.CreateHostParam{
-			Name:       m.name,
-			Interfaces: interfaces,
-		})
+		m.hostID, err = m.client.CreateHost((*mackerel.CreateHostParam)(m.hostParam(meta, interfaces)))
 		newHostID = &m.hostID
 	}
 	if err != nil {
 		return nil, err
 	}
+	m.interfaces, m.meta = interfaces, meta
+
+	if info != nil {
+		if err = m.client.PutHostMetaData(m.hostID, metadataNamespace, newInventory(info)); err != nil {
+			return nil, err
+		}
+	}
 
 	if err = m.CreateGraphDefs(graphDefs); err != nil {
 		return nil, err
@@ -93,10 +118,110 @@ func (m *Mackerel) Init(ifs []collector.Interface) (*string, error) {
 	return newHostID, nil
 }
 
+// hostInterfaces sorts interfaces, to compare with the previous ones.
+func (m *Mackerel) hostInterfaces(ifs []collector.Interface) []mackerel.Interface {
+	if len(ifs) == 0 {
+		return []mackerel.Interface{m.mainInterface()}
+	}
+
+	var interfaces []mackerel.Interface
+	for i := range ifs {
+		interfaces = append(interfaces, mackerel.Interface{
+			Name:          ifs[i].IfName,
+			IPv4Addresses: sorted(ifs[i].IpAddress),
+			IPv6Addresses: sorted(ifs[i].IPv6Address),
+			MacAddress:    ifs[i].MacAddress,
+		})
+	}
+	slices.SortFunc(interfaces, func(a, b mackerel.Interface) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return interfaces
+}
+
+// mainInterface has addresses of the target, DNS names are resolved.
+func (m *Mackerel) mainInterface() mackerel.Interface {
+	main := mackerel.Interface{Name: "main"}
+
+	ips := []net.IP{net.ParseIP(m.targetAddr)}
+	if ips[0] == nil {
+		var err error
+		ips, err = m.lookupIP(m.targetAddr)
+		if err != nil {
+			m.logger.Load().Warn("lookup failed", "phase", "init", "error", err)
+		}
+	}
+	for _, ip := range ips {
+		if ip.To4() != nil {
+			main.IPv4Addresses = append(main.IPv4Addresses, ip.String())
+		} else {
+			main.IPv6Addresses = append(main.IPv6Addresses, ip.String())
+		}
+	}
+	main.IPv4Addresses = sorted(main.IPv4Addresses)
+	main.IPv6Addresses = sorted(main.IPv6Addresses)
+	return main
+}
+
+func sorted(s []string) []string {
+	s = slices.Clone(s)
+	slices.Sort(s)
+	return s
+}
+
+// UpdateInterfaces updates the host only when interfaces changed.
+// interfaces are kept only when the update succeeded, so that a failed one is retried next time.
+func (m *Mackerel) UpdateInterfaces(ifs []collector.Interface) (bool, error) {
+	interfaces := m.hostInterfaces(ifs)
+	if reflect.DeepEqual(interfaces, m.interfaces) {
+		return false, nil
+	}
+	if _, err := m.client.UpdateHost(m.hostID, m.hostParam(m.meta, interfaces)); err != nil {
+		return false, err
+	}
+	m.interfaces = interfaces
+	return true, nil
+}
+
+func (m *Mackerel) hostParam(meta mackerel.HostMeta, interfaces []mackerel.Interface) *mackerel.UpdateHostParam {
+	return &mackerel.UpdateHostParam{
+		Name:             m.name,
+		Meta:             meta,
+		Interfaces:       interfaces,
+		RoleFullnames:    m.roles,
+		CustomIdentifier: m.customIdentifier,
+	}
+}
+
+// HostID returns the id of the host, created by Init when not given.
+func (m *Mackerel) HostID() string {
+	return m.hostID
+}
+
 func (m *Mackerel) CreateGraphDefs(d []*mackerel.GraphDefsParam) error {
 	return m.client.CreateGraphDefs(d)
 }
 
-func (m *Mackerel) Send(ctx context.Context, value []*mackerel.MetricValue) error {
-	return m.client.PostHostMetricValuesByHostID(m.hostID, value)
+func (m *Mackerel) Send(ctx context.Context, value []*metric.Metric) error {
+	values := metricValues(value)
+	if len(values) == 0 {
+		return nil
+	}
+	return classifyError(m.client.PostHostMetricValuesByHostID(m.hostID, values))
+}
+
+// counters are skipped, Mackerel needs differences.
+func metricValues(value []*metric.Metric) []*mackerel.MetricValue {
+	var values []*mackerel.MetricValue
+	for _, v := range value {
+		if v.Kind == metric.KindCounter {
+			continue
+		}
+		values = append(values, &mackerel.MetricValue{
+			Name:  v.Path(),
+			Time:  v.Time.Unix(),
+			Value: v.Value,
+		})
+	}
+	return values
 }
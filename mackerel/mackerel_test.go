@@ -3,12 +3,15 @@ package mackerel
 import (
 	"context"
 	"errors"
+	"net"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/mackerelio/mackerel-client-go"
 
 	"github.com/yseto/switch-traffic-to-mackerel/collector"
+	"github.com/yseto/switch-traffic-to-mackerel/metric"
 )
 
 type mackerelClientMock struct {
@@ -17,6 +20,7 @@ type mackerelClientMock struct {
 	graphDef     []*mackerel.GraphDefsParam
 	hostID       string
 	metricValues []*mackerel.MetricValue
+	metadata     mackerel.HostMetaData
 
 	returnHostID        string
 	returnError         error
@@ -41,6 +45,11 @@ func (m *mackerelClientMock) PostHostMetricValuesByHostID(hostID string, metricV
 	return m.returnError
 }
 
+func (m *mackerelClientMock) PutHostMetaData(hostID, namespace string, metadata mackerel.HostMetaData) error {
+	m.metadata = metadata
+	return nil
+}
+
 func TestInit(t *testing.T) {
 	id := "1234567890"
 	createHost := mackerel.CreateHostParam{
@@ -179,7 +188,8 @@ func TestInit(t *testing.T) {
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
 			tc.queue.client = tc.mock
-			newHostID, err := tc.queue.Init(tc.interfaces)
+			tc.queue.SetLogger(nil)
+			newHostID, err := tc.queue.Init(tc.interfaces, nil)
 			if !errors.Is(err, tc.expectedError) {
 				t.Error("invalid error")
 			}
@@ -209,7 +219,24 @@ func TestSend(t *testing.T) {
 		client: mock,
 	}
 
-	if err := mc.Send(ctx, nil); err != nil {
+	now := time.Unix(time.Now().Unix(), 0)
+	value := []*metric.Metric{
+		{
+			Name:   "interface.*.rxBytes.delta",
+			Labels: map[string]string{"ifName": "ge-0/0/1"},
+			Value:  1,
+			Time:   now,
+			Kind:   metric.KindGauge,
+		},
+		{
+			Name:   "interface.*.rxBytes",
+			Labels: map[string]string{"ifName": "ge-0/0/1"},
+			Value:  12345,
+			Time:   now,
+			Kind:   metric.KindCounter,
+		},
+	}
+	if err := mc.Send(ctx, value); err != nil {
 		t.Errorf("occur error %v", err)
 	}
 
@@ -217,4 +244,120 @@ func TestSend(t *testing.T) {
 		t.Error("invalid need hostID")
 	}
 
+	expected := []*mackerel.MetricValue{
+		{
+			Name:  "interface.ge-0-0-1.rxBytes.delta",
+			Time:  now.Unix(),
+			Value: float64(1),
+		},
+	}
+	if !reflect.DeepEqual(mock.metricValues, expected) {
+		t.Error("metricValues is invalid")
+	}
+
+}
+
+func TestUpdateInterfaces(t *testing.T) {
+	mock := &mackerelClientMock{}
+	m := &Mackerel{
+		client:           mock,
+		hostID:           "0987654321",
+		name:             "sw1",
+		roles:            []string{"network:switch"},
+		customIdentifier: "sw1.example.com",
+		interfaces: []mackerel.Interface{
+			{Name: "eth0", IPv4Addresses: []string{"192.0.2.1", "192.0.2.2"}},
+		},
+	}
+
+	// interfaces are compared with the previous ones only after the update succeeded.
+	mock.returnError = errors.New("api error")
+	if _, err := m.UpdateInterfaces([]collector.Interface{{IfName: "eth1"}}); err == nil {
+		t.Error("error is not returned")
+	}
+	mock.returnError = nil
+	updated, err := m.UpdateInterfaces([]collector.Interface{{IfName: "eth1"}})
+	if err != nil || !updated {
+		t.Error("failed update is not retried")
+	}
+	m.interfaces = []mackerel.Interface{
+		{Name: "eth0", IPv4Addresses: []string{"192.0.2.1", "192.0.2.2"}},
+	}
+
+	// same set in other order.
+	updated, err = m.UpdateInterfaces([]collector.Interface{
+		{IfName: "eth0", IpAddress: []string{"192.0.2.2", "192.0.2.1"}},
+	})
+	if err != nil {
+		t.Error(err)
+	}
+	if updated {
+		t.Error("host is updated when interfaces are not changed")
+	}
+
+	updated, err = m.UpdateInterfaces([]collector.Interface{
+		{IfName: "vlan10", IpAddress: []string{"198.51.100.1"}, IPv6Address: []string{"2001:db8::1"}, MacAddress: "00:00:87:12:34:56"},
+		{IfName: "eth0", IpAddress: []string{"192.0.2.2", "192.0.2.1"}},
+	})
+	if err != nil {
+		t.Error(err)
+	}
+	if !updated {
+		t.Error("host is not updated")
+	}
+	expected := mackerel.UpdateHostParam{
+		Name: "sw1",
+		Interfaces: []mackerel.Interface{
+			{Name: "eth0", IPv4Addresses: []string{"192.0.2.1", "192.0.2.2"}},
+			{Name: "vlan10", IPv4Addresses: []string{"198.51.100.1"}, IPv6Addresses: []string{"2001:db8::1"}, MacAddress: "00:00:87:12:34:56"},
+		},
+		RoleFullnames:    []string{"network:switch"},
+		CustomIdentifier: "sw1.example.com",
+	}
+	if !reflect.DeepEqual(mock.updateParam, expected) {
+		t.Errorf("updateParam is invalid %v", mock.updateParam)
+	}
+}
+
+func TestMainInterface(t *testing.T) {
+	lookupIP := func(host string) ([]net.IP, error) {
+		if host != "sw1.example.com" {
+			return nil, errors.New("no such host")
+		}
+		return []net.IP{net.ParseIP("2001:db8::1"), net.ParseIP("192.0.2.1")}, nil
+	}
+
+	tests := []struct {
+		targetAddr string
+		expected   mackerel.Interface
+	}{
+		{
+			targetAddr: "192.0.2.1",
+			expected:   mackerel.Interface{Name: "main", IPv4Addresses: []string{"192.0.2.1"}},
+		},
+		{
+			targetAddr: "2001:db8::1",
+			expected:   mackerel.Interface{Name: "main", IPv6Addresses: []string{"2001:db8::1"}},
+		},
+		{
+			targetAddr: "sw1.example.com",
+			expected: mackerel.Interface{
+				Name:          "main",
+				IPv4Addresses: []string{"192.0.2.1"},
+				IPv6Addresses: []string{"2001:db8::1"},
+			},
+		},
+		{
+			targetAddr: "unknown.example.com",
+			expected:   mackerel.Interface{Name: "main"},
+		},
+	}
+
+	for _, tc := range tests {
+		m := &Mackerel{targetAddr: tc.targetAddr, lookupIP: lookupIP}
+		m.SetLogger(nil)
+		if actual := m.mainInterface(); !reflect.DeepEqual(actual, tc.expected) {
+			t.Errorf("%s: invalid result %v", tc.targetAddr, actual)
+		}
+	}
 }
@@ -0,0 +1,77 @@
+package mackerel
+
+import (
+	"strings"
+
+	mackerel "github.com/mackerelio/mackerel-client-go"
+
+	"github.com/yseto/switch-traffic-to-mackerel/metric"
+)
+
+// PluginMeta is the graph definitions of a mackerel-agent plugin, printed on MACKEREL_AGENT_PLUGIN_META=1.
+// names are without "custom.", mackerel-agent prefixes it.
+type PluginMeta struct {
+	Graphs map[string]*PluginGraph `json:"graphs"`
+}
+
+type PluginGraph struct {
+	Label   string          `json:"label"`
+	Unit    string          `json:"unit"`
+	Metrics []*PluginMetric `json:"metrics"`
+}
+
+type PluginMetric struct {
+	// Name is relative to the graph.
+	Name    string `json:"name"`
+	Label   string `json:"label"`
+	Stacked bool   `json:"stacked"`
+}
+
+// interface traffic is a host metric, it is posted as a custom metric by plugins.
+var trafficGraphDef = &mackerel.GraphDefsParam{
+	Name:        "custom.traffic.#",
+	Unit:        "bytes/sec",
+	DisplayName: "Interface Traffic",
+	Metrics: []*mackerel.GraphDefsMetric{
+		{Name: "custom.traffic.#.rxBytes", DisplayName: "rx"},
+		{Name: "custom.traffic.#.txBytes", DisplayName: "tx"},
+	},
+}
+
+// NewPluginMeta returns graph definitions of the agent and custom MIBs. graph names are prefixed by prefix.
+func NewPluginMeta(prefix string, custom []*mackerel.GraphDefsParam) *PluginMeta {
+	p := &PluginMeta{Graphs: make(map[string]*PluginGraph)}
+	p.Add(prefix, custom)
+	return p
+}
+
+// Add adds graph definitions, for another target.
+// self monitoring graphs are not added, plugins do not print them.
+func (p *PluginMeta) Add(prefix string, custom []*mackerel.GraphDefsParam) {
+	defs := append([]*mackerel.GraphDefsParam{trafficGraphDef}, graphDefs...)
+	for _, d := range append(defs, custom...) {
+		if strings.HasPrefix(d.Name, "custom.stm.") {
+			continue
+		}
+		name := strings.TrimPrefix(d.Name, "custom.")
+		g := &PluginGraph{Label: d.DisplayName, Unit: d.Unit}
+		for _, m := range d.Metrics {
+			g.Metrics = append(g.Metrics, &PluginMetric{
+				Name:    strings.TrimPrefix(m.Name, d.Name+"."),
+				Label:   m.DisplayName,
+				Stacked: m.IsStacked,
+			})
+		}
+		p.Graphs[prefix+name] = g
+	}
+}
+
+// PluginName returns the name printed by plugins, without "custom.".
+func PluginName(m *metric.Metric) string {
+	path := m.Path()
+	// interface.eth0.rxBytes.delta to traffic.eth0.rxBytes
+	if strings.HasPrefix(m.Name, "interface.*.") {
+		return "traffic." + strings.TrimSuffix(strings.TrimPrefix(path, "interface."), ".delta")
+	}
+	return strings.TrimPrefix(path, "custom.")
+}
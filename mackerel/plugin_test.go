@@ -0,0 +1,92 @@
+package mackerel
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mackerelio/mackerel-client-go"
+
+	"github.com/yseto/switch-traffic-to-mackerel/metric"
+)
+
+func TestPluginName(t *testing.T) {
+	tests := []struct {
+		metric   *metric.Metric
+		expected string
+	}{
+		{
+			metric:   &metric.Metric{Name: "interface.*.rxBytes.delta", Labels: map[string]string{metric.InstanceLabel: "Gi0/1"}},
+			expected: "traffic.Gi0-1.rxBytes",
+		},
+		{
+			metric:   &metric.Metric{Name: "custom.interface.ifInErrors.*", Labels: map[string]string{metric.InstanceLabel: "eth0"}},
+			expected: "interface.ifInErrors.eth0",
+		},
+		{
+			metric:   &metric.Metric{Name: "custom.custommibs.abc.temperature"},
+			expected: "custommibs.abc.temperature",
+		},
+	}
+	for _, tc := range tests {
+		if actual := PluginName(tc.metric); actual != tc.expected {
+			t.Errorf("invalid result %s, expected %s", actual, tc.expected)
+		}
+	}
+}
+
+func TestPluginMeta(t *testing.T) {
+	p := NewPluginMeta("", []*mackerel.GraphDefsParam{
+		{
+			Name:        "custom.custommibs.abc",
+			Unit:        "integer",
+			DisplayName: "sensor",
+			Metrics: []*mackerel.GraphDefsMetric{
+				{Name: "custom.custommibs.abc.temperature", DisplayName: "temperature"},
+			},
+		},
+	})
+	p.Add("sw2.", nil)
+
+	expected := map[string]*PluginGraph{
+		"traffic.#": {
+			Label: "Interface Traffic",
+			Unit:  "bytes/sec",
+			Metrics: []*PluginMetric{
+				{Name: "rxBytes", Label: "rx"},
+				{Name: "txBytes", Label: "tx"},
+			},
+		},
+		"interface.ifInErrors": {
+			Label:   "In Errors",
+			Unit:    "integer",
+			Metrics: []*PluginMetric{{Name: "*", Label: "%1"}},
+		},
+		"custommibs.abc": {
+			Label:   "sensor",
+			Unit:    "integer",
+			Metrics: []*PluginMetric{{Name: "temperature", Label: "temperature"}},
+		},
+		"sw2.traffic.#": {
+			Label: "Interface Traffic",
+			Unit:  "bytes/sec",
+			Metrics: []*PluginMetric{
+				{Name: "rxBytes", Label: "rx"},
+				{Name: "txBytes", Label: "tx"},
+			},
+		},
+	}
+	for name, g := range expected {
+		if d := cmp.Diff(p.Graphs[name], g); d != "" {
+			t.Errorf("%s: value is mismatch (-actual +expected):%s", name, d)
+		}
+	}
+	if _, ok := p.Graphs["sw2.custommibs.abc"]; ok {
+		t.Error("custom graph of another target")
+	}
+	for name := range p.Graphs {
+		if strings.Contains(name, "stm.") {
+			t.Errorf("self monitoring graph %s", name)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package mackerel
+
+import (
+	"cmp"
+	"context"
+	"os"
+	"regexp"
+	"sync"
+
+	mackerel "github.com/mackerelio/mackerel-client-go"
+
+	"github.com/yseto/switch-traffic-to-mackerel/metric"
+)
+
+type serviceClient interface {
+	PostServiceMetricValues(serviceName string, metricValues []*mackerel.MetricValue) error
+}
+
+// Service posts values as service metrics, prefixed by the name of the target.
+type Service struct {
+	client serviceClient
+	name   string
+
+	mu      sync.RWMutex
+	targets map[string]string
+}
+
+type ServiceArg struct {
+	Apikey string
+	Name   string
+	// Targets maps the target address to the name used as prefix.
+	Targets map[string]string
+}
+
+func NewService(qa *ServiceArg) *Service {
+	baseURL := cmp.Or(os.Getenv("MACKEREL_APIBASE"), "https://api.mackerelio.com/")
+	apikey := cmp.Or(os.Getenv("MACKEREL_APIKEY"), qa.Apikey)
+
+	client, _ := mackerel.NewClientWithOptions(apikey, baseURL, false)
+
+	return &Service{
+		client:  client,
+		name:    qa.Name,
+		targets: qa.Targets,
+	}
+}
+
+// SetTargets replaces names of targets, such as on reload.
+func (s *Service) SetTargets(targets map[string]string) {
+	s.mu.Lock()
+	s.targets = targets
+	s.mu.Unlock()
+}
+
+func (s *Service) Send(ctx context.Context, value []*metric.Metric) error {
+	s.mu.RLock()
+	targets := s.targets
+	s.mu.RUnlock()
+
+	var values []*mackerel.MetricValue
+	for _, v := range value {
+		if v.Kind == metric.KindCounter {
+			continue
+		}
+		name := v.Path()
+		// values without target, such as aggregates, are posted as is.
+		if target, ok := v.Labels["target"]; ok {
+			name = servicePrefix(cmp.Or(targets[target], target)) + "." + name
+		}
+		values = append(values, &mackerel.MetricValue{
+			Name:  name,
+			Time:  v.Time.Unix(),
+			Value: v.Value,
+		})
+	}
+	if len(values) == 0 {
+		return nil
+	}
+	return classifyError(s.client.PostServiceMetricValues(s.name, values))
+}
+
+var invalidServiceMetricRe = regexp.MustCompile(`[^a-zA-Z0-9_-]`)
+
+// dots in the prefix would split the metric name.
+func servicePrefix(name string) string {
+	return invalidServiceMetricRe.ReplaceAllString(name, "_")
+}
@@ -0,0 +1,77 @@
+package mackerel
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mackerelio/mackerel-client-go"
+
+	"github.com/yseto/switch-traffic-to-mackerel/metric"
+)
+
+type serviceClientMock struct {
+	serviceName  string
+	metricValues []*mackerel.MetricValue
+}
+
+func (m *serviceClientMock) PostServiceMetricValues(serviceName string, metricValues []*mackerel.MetricValue) error {
+	m.serviceName = serviceName
+	m.metricValues = metricValues
+	return nil
+}
+
+func TestServiceSend(t *testing.T) {
+	mock := &serviceClientMock{}
+	s := &Service{
+		client: mock,
+		name:   "network",
+		targets: map[string]string{
+			"192.0.2.1": "core-sw",
+		},
+	}
+
+	now := time.Unix(1700000000, 0)
+	err := s.Send(context.Background(), []*metric.Metric{
+		{Name: "interface.*.rxBytes.delta", Labels: map[string]string{"ifName": "eth0", "target": "192.0.2.1"}, Value: 1, Time: now, Kind: metric.KindGauge},
+		{Name: "interface.*.ifHCInOctets", Labels: map[string]string{"ifName": "eth0", "target": "192.0.2.1"}, Value: 2, Time: now, Kind: metric.KindCounter},
+		{Name: "interface.*.rxBytes.delta", Labels: map[string]string{"ifName": "ge-0/0/1", "target": "192.0.2.2"}, Value: 3, Time: now, Kind: metric.KindGauge},
+		{Name: "aggregate.uplink.rxBytes", Value: 4, Time: now, Kind: metric.KindGauge},
+	})
+	if err != nil {
+		t.Error(err)
+	}
+
+	if mock.serviceName != "network" {
+		t.Errorf("invalid service name %s", mock.serviceName)
+	}
+	expected := []*mackerel.MetricValue{
+		{Name: "core-sw.interface.eth0.rxBytes.delta", Time: now.Unix(), Value: 1.0},
+		{Name: "192_0_2_2.interface.ge-0-0-1.rxBytes.delta", Time: now.Unix(), Value: 3.0},
+		{Name: "aggregate.uplink.rxBytes", Time: now.Unix(), Value: 4.0},
+	}
+	if diff := cmp.Diff(mock.metricValues, expected); diff != "" {
+		t.Errorf("value is mismatch (-actual +expected):%s", diff)
+	}
+}
+
+func TestServiceSetTargets(t *testing.T) {
+	mock := &serviceClientMock{}
+	s := &Service{client: mock, name: "network", targets: map[string]string{"192.0.2.1": "core-sw"}}
+	s.SetTargets(map[string]string{"192.0.2.1": "core-sw1"})
+
+	now := time.Unix(1700000000, 0)
+	err := s.Send(context.Background(), []*metric.Metric{
+		{Name: "interface.*.rxBytes.delta", Labels: map[string]string{"ifName": "eth0", "target": "192.0.2.1"}, Value: 1, Time: now, Kind: metric.KindGauge},
+	})
+	if err != nil {
+		t.Error(err)
+	}
+	expected := []*mackerel.MetricValue{
+		{Name: "core-sw1.interface.eth0.rxBytes.delta", Time: now.Unix(), Value: 1.0},
+	}
+	if diff := cmp.Diff(mock.metricValues, expected); diff != "" {
+		t.Errorf("value is mismatch (-actual +expected):%s", diff)
+	}
+}
@@ -3,149 +3,420 @@ package main
 import (
 	"cmp"
 	"context"
+	"errors"
 	"flag"
-	"log"
+	"fmt"
+	"log/slog"
+	"net/http"
 	"os"
 	"os/signal"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/yseto/switch-traffic-to-mackerel/collector"
 	"github.com/yseto/switch-traffic-to-mackerel/config"
+	"github.com/yseto/switch-traffic-to-mackerel/logging"
 	"github.com/yseto/switch-traffic-to-mackerel/mackerel"
 	"github.com/yseto/switch-traffic-to-mackerel/metric"
+	"github.com/yseto/switch-traffic-to-mackerel/prometheus"
 	"github.com/yseto/switch-traffic-to-mackerel/queue"
+	"github.com/yseto/switch-traffic-to-mackerel/sink"
+	"github.com/yseto/switch-traffic-to-mackerel/snmp"
+	"github.com/yseto/switch-traffic-to-mackerel/status"
 )
 
 func main() {
-	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	if len(os.Args) > 1 {
+		if _, ok := commands[os.Args[1]]; ok {
+			os.Exit(runCommand(os.Args[1], os.Args[2:]))
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
 
 	var filename string
-	var debug, dryrun bool
+	var debug, dryrun, watch bool
 	flag.StringVar(&filename, "config", "config.yaml", "config `filename`")
 	flag.BoolVar(&debug, "debug", false, "debug")
 	flag.BoolVar(&dryrun, "dry-run", false, "dry run")
+	flag.BoolVar(&watch, "watch", false, "reload the config when the file is changed, as on SIGHUP")
 	flag.Parse()
 
+	load := func() (*config.Config, error) {
+		return loadConfig(filename, debug, dryrun)
+	}
+	c, err := load()
+	if err != nil {
+		fatal(slog.Default(), "config failed", "phase", "config", "error", err)
+	}
+	slog.SetDefault(logging.New(os.Stderr, c.Log, c.Debug))
+
+	a := newAgent(ctx)
+
+	// servers by listen address, prometheus and status may share one.
+	muxes := make(map[string]*http.ServeMux)
+	muxFor := func(listen string) *http.ServeMux {
+		if _, ok := muxes[listen]; !ok {
+			muxes[listen] = http.NewServeMux()
+		}
+		return muxes[listen]
+	}
+
+	if c.Prometheus != nil {
+		a.exporter = prometheus.New(c)
+		muxFor(c.Prometheus.Listen).Handle("/metrics", a.exporter)
+	}
+
+	if c.Status != nil {
+		a.status = status.New(nil, a, collectInterval, c.Status.UnhealthyIntervals)
+		a.status.Register(muxFor(c.Status.Listen))
+	}
+
+	if err := a.apply(c); err != nil {
+		fatal(slog.Default(), "init failed", "phase", "init", "error", err)
+	}
+
+	for listen, mux := range muxes {
+		srv := serve(listen, mux)
+		defer srv.Close()
+	}
+
+	wg := &sync.WaitGroup{}
+	wg.Add(2)
+	go a.collectTicker(ctx, wg)
+	go reloadLoop(ctx, wg, a, filename, watch, load)
+	wg.Wait()
+
+	a.shutdown()
+}
+
+// loadConfig loads the config, overridden by flags.
+func loadConfig(filename string, debug, dryrun bool) (*config.Config, error) {
 	c, err := config.Init(filename)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 	c.Debug = (c.Debug || debug)
 	c.DryRun = (c.DryRun || dryrun)
 
-	if c.Mackerel == nil {
-		log.Println("force dry-run.")
+	if !hasOutput(c) {
+		slog.Info("force dry-run.")
 		c.DryRun = true
 	}
+	return c, nil
+}
 
-	var mClient *mackerel.Mackerel
-	if c.Mackerel != nil {
-		mClient = mackerel.New(&mackerel.Arg{
-			TargetAddr: c.Target,
-			Apikey:     c.Mackerel.ApiKey,
-			HostID:     c.Mackerel.HostID,
-			Name:       cmp.Or(c.Mackerel.Name, c.Target),
-		})
+// fatal logs an error and exits.
+func fatal(logger *slog.Logger, msg string, args ...any) {
+	logger.Error(msg, args...)
+	os.Exit(1)
+}
 
-		var interfaces []collector.Interface
-		if !c.Mackerel.IgnoreNetworkInfo {
-			interfaces, err = collector.DoInterfaceIPAddress(ctx, c)
-			if err != nil {
-				log.Println("HINT: try mackerel > ignore-network-info: true")
-				log.Fatal(err)
-			}
-		}
+// serviceOutput is the queue of mackerel-service, kept across reloads while its config is not changed.
+type serviceOutput struct {
+	config  *config.MackerelService
+	service *mackerel.Service
+	queue   *queue.Queue
+}
+
+// newServiceOutput returns the queue of mackerel-service, names of targets are set by SetTargets.
+func newServiceOutput(c *config.MackerelService, dryRun bool, logger *slog.Logger) *serviceOutput {
+	service := mackerel.NewService(&mackerel.ServiceArg{
+		Apikey: c.ApiKey,
+		Name:   c.Name,
+	})
+	return &serviceOutput{
+		config:  c,
+		service: service,
+		queue: queue.New(queue.Arg{
+			Name:           "mackerel-service",
+			SendFunc:       service,
+			Logger:         logger,
+			DryRun:         dryRun,
+			DeadLetterFile: c.DeadLetterFile,
+		}),
+	}
+}
+
+// sinkOutput is the queue of a sink, kept across reloads while its config is not changed.
+type sinkOutput struct {
+	config *config.Sink
+	// otlp is nil for other sinks, resources are set by SetResources.
+	otlp  *sink.OTLP
+	queue *queue.Queue
+}
+
+func newSinkOutput(s *config.Sink, dryRun bool, logger *slog.Logger) (*sinkOutput, error) {
+	sendFunc, err := sink.New(s)
+	if err != nil {
+		return nil, fmt.Errorf("sink %s: %w", s.Type, err)
+	}
+	o := &sinkOutput{
+		config: s,
+		queue: queue.New(queue.Arg{
+			Name:           s.Type,
+			SendFunc:       sendFunc,
+			Logger:         logger,
+			DryRun:         dryRun,
+			DeadLetterFile: s.DeadLetterFile,
+		}),
+	}
+	o.otlp, _ = sendFunc.(*sink.OTLP)
+	return o, nil
+}
 
-		newHostID, err := mClient.Init(interfaces)
+// targetNames returns names of targets by address, prefixes of mackerel-service.
+func targetNames(c *config.Config) map[string]string {
+	names := make(map[string]string, len(c.Targets))
+	for _, t := range c.Targets {
+		names[t.Target] = t.Name()
+	}
+	return names
+}
+
+// sharedQueues returns queues shared by all targets, and the queue of mackerel-service.
+func sharedQueues(ctx context.Context, c *config.Config) (queue.Group, *queue.Queue, error) {
+	var shared queue.Group
+	var serviceQueue *queue.Queue
+	if c.MackerelService != nil {
+		o := newServiceOutput(c.MackerelService, c.DryRun, nil)
+		o.service.SetTargets(targetNames(c))
+		serviceQueue = o.queue
+		shared = append(shared, o.queue)
+	}
+	for _, s := range c.Sinks {
+		o, err := newSinkOutput(s, c.DryRun, nil)
 		if err != nil {
-			log.Fatal(err)
+			return nil, nil, err
 		}
-		if newHostID != nil {
-			log.Println("save HostID")
-			if err = c.Save(*newHostID); err != nil {
-				log.Fatal(err)
+		if o.otlp != nil {
+			resources := make(map[string]map[string]string, len(c.Targets))
+			for _, t := range c.Targets {
+				resources[t.Target] = resourceAttributes(ctx, t)
 			}
+			o.otlp.SetResources(resources)
 		}
-		if len(c.CustomMIBsGraphDefs) > 0 {
-			if err = mClient.CreateGraphDefs(c.CustomMIBsGraphDefs); err != nil {
-				log.Fatal(err)
-			}
+		shared = append(shared, o.queue)
+	}
+	return shared, serviceQueue, nil
+}
+
+func hasOutput(c *config.Config) bool {
+	if c.MackerelService != nil || len(c.Sinks) > 0 {
+		return true
+	}
+	for _, t := range c.Targets {
+		if t.Mackerel != nil {
+			return true
 		}
 	}
+	return false
+}
+
+// initMackerel creates or updates the host of the target.
+func initMackerel(ctx context.Context, t *config.Target, logger *slog.Logger) (*mackerel.Mackerel, error) {
+	mClient := mackerel.New(&mackerel.Arg{
+		TargetAddr: t.Host,
+		Apikey:     t.Mackerel.ApiKey,
+		HostID:     t.Mackerel.HostID,
+		Name:       t.Name(),
 
-	queueHandler := queue.New(queue.Arg{
-		SendFunc: mClient,
-		Debug:    c.Debug,
-		DryRun:   c.DryRun,
+		Roles:            t.Mackerel.Roles,
+		CustomIdentifier: t.Mackerel.CustomIdentifier,
+		Logger:           logger,
 	})
 
-	wg := &sync.WaitGroup{}
-	wg.Add(1)
-	go collectTicker(ctx, wg, c, queueHandler)
+	var interfaces []collector.Interface
+	var err error
+	if !t.Mackerel.IgnoreNetworkInfo {
+		interfaces, err = collector.DoInterfaceIPAddress(ctx, t)
+		if err != nil {
+			return nil, fmt.Errorf("%w (HINT: try mackerel > ignore-network-info: true)", err)
+		}
+	}
 
-	wg.Add(1)
-	go sendTicker(ctx, wg, queueHandler)
-	wg.Wait()
+	info, err := collector.DoSystemInfo(ctx, t)
+	if err != nil {
+		// the inventory is optional, the host is registered without it.
+		logger.Warn("inventory failed", "phase", "init", "error", err)
+	}
+
+	newHostID, err := mClient.Init(interfaces, info)
+	if err != nil {
+		return nil, err
+	}
+	if newHostID != nil {
+		logger.Info("save HostID", "phase", "init", "host_id", *newHostID)
+		if err = t.Save(*newHostID); err != nil {
+			return nil, err
+		}
+	}
+	if len(t.CustomMIBsGraphDefs) > 0 {
+		if err = mClient.CreateGraphDefs(t.CustomMIBsGraphDefs); err != nil {
+			return nil, err
+		}
+	}
+	return mClient, nil
 }
 
-func collectTicker(ctx context.Context, wg *sync.WaitGroup, c *config.Config, queueHandler *queue.Queue) {
-	t := time.NewTicker(1 * time.Minute)
+// resourceAttributes returns device metadata for OTLP.
+func resourceAttributes(ctx context.Context, c *config.Target) map[string]string {
+	attributes := map[string]string{"host.name": c.Target}
+	info, err := collector.DoSystemInfo(ctx, c)
+	if err != nil {
+		slog.Warn("inventory failed", "target", c.Target, "phase", "init", "error", err)
+		return attributes
+	}
+	attributes["host.name"] = cmp.Or(info.SysName, c.Target)
+	attributes["sysName"] = info.SysName
+	attributes["sysObjectID"] = info.SysObjectID
+	return attributes
+}
+
+func serve(listen string, handler http.Handler) *http.Server {
+	srv := &http.Server{
+		Addr:              listen,
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fatal(slog.Default(), "listen failed", "phase", "serve", "listen", listen, "error", err)
+		}
+	}()
+	return srv
+}
+
+// refreshHost keeps the host on Mackerel up to date, such as firmware upgrades and address changes.
+func refreshHost(ctx context.Context, wg *sync.WaitGroup, c *config.Target, mClient *mackerel.Mackerel) {
+	inventoryTicker := time.NewTicker(c.Mackerel.InventoryInterval)
 	defer func() {
-		t.Stop()
+		inventoryTicker.Stop()
 		wg.Done()
 	}()
 
-	customConverter := metric.NewCustom(c.CustomMIBmetricNameMappedMIBs)
+	// nil channel never receives.
+	var interfaceC <-chan time.Time
+	if !c.Mackerel.IgnoreNetworkInfo {
+		interfaceTicker := time.NewTicker(c.Mackerel.InterfaceInterval)
+		defer interfaceTicker.Stop()
+		interfaceC = interfaceTicker.C
+	}
 
 	for {
 		select {
-		case <-t.C:
-			metrics, err := collector.Do(ctx, c)
+		case <-inventoryTicker.C:
+			info, err := collector.DoSystemInfo(ctx, c)
 			if err != nil {
-				log.Println(err.Error())
+				mClient.Logger().Warn("inventory failed", "phase", "inventory", "error", err)
 				continue
 			}
-			if m := metric.Convert(metrics); m != nil {
-				queueHandler.Enqueue(m)
+			if err := mClient.UpdateInventory(info); err != nil {
+				mClient.Logger().Warn("update inventory failed", "phase", "inventory", "error", err)
 			}
 
-			customMetrics, err := collector.DoCustomMIBs(ctx, c)
+		case <-interfaceC:
+			interfaces, err := collector.DoInterfaceIPAddress(ctx, c)
 			if err != nil {
-				log.Println(err.Error())
+				mClient.Logger().Warn("interfaces failed", "phase", "interfaces", "error", err)
 				continue
 			}
-
-			queueHandler.Enqueue(customConverter.ConvertCustom(customMetrics))
+			updated, err := mClient.UpdateInterfaces(interfaces)
+			if err != nil {
+				mClient.Logger().Warn("update interfaces failed", "phase", "interfaces", "error", err)
+				continue
+			}
+			if updated {
+				mClient.Logger().Info("interfaces are updated", "phase", "interfaces")
+			}
 
 		case <-ctx.Done():
-			log.Println("cancellation from context:", ctx.Err())
 			return
 		}
 	}
 }
 
-type sendTickerFunc interface {
-	Tick(context.Context)
+const collectInterval = 1 * time.Minute
+
+// collect enqueues values of the target and of the agent itself, and returns interface values for aggregation.
+// interface values are nil when they are not collected, or on the first collection.
+func collect(ctx context.Context, r *target, exporter *prometheus.Exporter, st *status.Status) ([]*metric.Metric, error) {
+	c := r.config
+	start := time.Now()
+	stats := &snmp.Stats{}
+
+	m, interfaces, err := collectTarget(snmp.WithStats(ctx, stats), r, exporter)
+	if err != nil {
+		r.logger.Warn("collect failed", "phase", "collect", "error", err)
+	} else {
+		r.logger.Debug("collected", "phase", "collect", "interfaces", interfaces, "duration", time.Since(start))
+	}
+	st.Collected(c.Target, start, interfaces, err)
+
+	self := &metric.Self{
+		SNMP:               *stats,
+		CollectionDuration: time.Since(start),
+		Interfaces:         interfaces,
+	}
+	for _, q := range r.queues.Stats() {
+		self.Queues = append(self.Queues, metric.SelfQueue{
+			Name:        q.Name,
+			Length:      q.Values,
+			SendLatency: q.LastSendDuration,
+			Dropped:     q.Dropped,
+		})
+	}
+	selfMetrics := r.self.ConvertSelf(self)
+	metric.SetLabel(selfMetrics, "target", c.Target)
+	r.queues.Enqueue(selfMetrics)
+	return m, err
 }
 
-func sendTicker(ctx context.Context, wg *sync.WaitGroup, f sendTickerFunc) {
-	t := time.NewTicker(500 * time.Millisecond)
+// collectTarget returns interface values and the number of interfaces.
+func collectTarget(ctx context.Context, r *target, exporter *prometheus.Exporter) ([]*metric.Metric, int, error) {
+	c := r.config
 
-	defer func() {
-		t.Stop()
-		wg.Done()
-	}()
+	metrics, err := collector.Do(ctx, c)
+	if err != nil {
+		// scrapers see the target missing, instead of flat counters.
+		if exporter != nil {
+			exporter.Update(c.Target, nil)
+			exporter.UpdateCustom(c.Target, nil)
+		}
+		return nil, 0, err
+	}
+	if exporter != nil {
+		exporter.Update(c.Target, metrics)
+	}
+	counters := metric.Counters(metrics)
+	metric.SetLabel(counters, "target", c.Target)
+	r.queues.Enqueue(counters)
+	m := r.converter.Convert(metrics)
+	if m != nil {
+		metric.SetLabel(m, "target", c.Target)
+		r.queues.Enqueue(m)
+	}
 
-	for {
-		select {
-		case <-t.C:
-			f.Tick(ctx)
+	interfaces := make(map[uint64]struct{})
+	for _, v := range metrics {
+		interfaces[v.IfIndex] = struct{}{}
+	}
 
-		case <-ctx.Done():
-			log.Println("cancellation from context:", ctx.Err())
-			return
+	customMetrics, err := collector.DoCustomMIBs(ctx, c)
+	if err != nil {
+		if exporter != nil {
+			exporter.UpdateCustom(c.Target, nil)
 		}
+		return m, len(interfaces), err
+	}
+	if exporter != nil {
+		exporter.UpdateCustom(c.Target, customMetrics)
 	}
+
+	custom := r.custom.ConvertCustom(customMetrics)
+	metric.SetLabel(custom, "target", c.Target)
+	r.queues.Enqueue(custom)
+	return m, len(interfaces), nil
 }
@@ -0,0 +1,45 @@
+package metric
+
+import (
+	"regexp"
+)
+
+// Aggregate sums traffic of interfaces matched by re, across all targets.
+func Aggregate(metrics []*Metric, name string, re *regexp.Regexp) []*Metric {
+	sums := map[string]*Metric{}
+	for _, m := range metrics {
+		var direction string
+		switch m.Name {
+		case "interface.*.rxBytes.delta":
+			direction = "rxBytes"
+		case "interface.*.txBytes.delta":
+			direction = "txBytes"
+		default:
+			continue
+		}
+		if !re.MatchString(m.Labels[InstanceLabel]) {
+			continue
+		}
+		sum, ok := sums[direction]
+		if !ok {
+			sum = &Metric{
+				Name: "aggregate." + name + "." + direction,
+				Time: m.Time,
+				Kind: KindGauge,
+			}
+			sums[direction] = sum
+		}
+		sum.Value += m.Value
+		if m.Time.After(sum.Time) {
+			sum.Time = m.Time
+		}
+	}
+
+	var aggregated []*Metric
+	for _, direction := range []string{"rxBytes", "txBytes"} {
+		if sum, ok := sums[direction]; ok {
+			aggregated = append(aggregated, sum)
+		}
+	}
+	return aggregated
+}
@@ -0,0 +1,33 @@
+package metric
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestAggregate(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	metrics := []*Metric{
+		{Name: "interface.*.rxBytes.delta", Labels: map[string]string{"ifName": "uplink1", "target": "192.0.2.1"}, Value: 10, Time: now, Kind: KindGauge},
+		{Name: "interface.*.txBytes.delta", Labels: map[string]string{"ifName": "uplink1", "target": "192.0.2.1"}, Value: 20, Time: now, Kind: KindGauge},
+		{Name: "interface.*.rxBytes.delta", Labels: map[string]string{"ifName": "uplink2", "target": "192.0.2.2"}, Value: 1, Time: now.Add(time.Second), Kind: KindGauge},
+		{Name: "interface.*.rxBytes.delta", Labels: map[string]string{"ifName": "eth0", "target": "192.0.2.2"}, Value: 100, Time: now, Kind: KindGauge},
+		{Name: "custom.interface.ifInErrors.*", Labels: map[string]string{"ifName": "uplink1", "target": "192.0.2.1"}, Value: 1000, Time: now, Kind: KindDelta},
+	}
+
+	actual := Aggregate(metrics, "uplink", regexp.MustCompile("^uplink"))
+	expected := []*Metric{
+		{Name: "aggregate.uplink.rxBytes", Value: 11, Time: now.Add(time.Second), Kind: KindGauge},
+		{Name: "aggregate.uplink.txBytes", Value: 20, Time: now, Kind: KindGauge},
+	}
+	if diff := cmp.Diff(actual, expected); diff != "" {
+		t.Errorf("value is mismatch (-actual +expected):%s", diff)
+	}
+
+	if actual := Aggregate(metrics, "none", regexp.MustCompile("^none")); actual != nil {
+		t.Errorf("unexpected value %v", actual)
+	}
+}
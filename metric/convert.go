@@ -3,37 +3,56 @@ package metric
 import (
 	"fmt"
 	"math"
+	"strconv"
 	"strings"
 	"time"
 
-	"github.com/mackerelio/mackerel-client-go"
 	"github.com/yseto/switch-traffic-to-mackerel/collector"
 )
 
-var prevSnapshot []collector.MetricsDutum
+// Converter keeps the previous snapshot of a target to calculate differences.
+type Converter struct {
+	prevSnapshot []collector.MetricsDutum
+	// interval between snapshots, octets are converted to bytes per second.
+	interval time.Duration
+}
+
+func NewConverter(interval time.Duration) *Converter {
+	return &Converter{interval: interval}
+}
+
+// Snapshot returns the previous values, to keep them across processes.
+func (c *Converter) Snapshot() []collector.MetricsDutum {
+	return c.prevSnapshot
+}
 
-func Convert(rawMetrics []collector.MetricsDutum) []*mackerel.MetricValue {
-	return replaceSnapshot(rawMetrics, convert)
+// Restore sets the previous values saved by Snapshot.
+func (c *Converter) Restore(snapshot []collector.MetricsDutum) {
+	c.prevSnapshot = snapshot
 }
 
-func replaceSnapshot(rawMetrics []collector.MetricsDutum, fn func(rawMetrics []collector.MetricsDutum) []*mackerel.MetricValue) []*mackerel.MetricValue {
+func (c *Converter) Convert(rawMetrics []collector.MetricsDutum) []*Metric {
+	return c.replaceSnapshot(rawMetrics, c.convert)
+}
+
+func (c *Converter) replaceSnapshot(rawMetrics []collector.MetricsDutum, fn func(rawMetrics []collector.MetricsDutum) []*Metric) []*Metric {
 	defer func() {
-		prevSnapshot = rawMetrics
+		c.prevSnapshot = rawMetrics
 	}()
 
-	if len(prevSnapshot) == 0 {
+	if len(c.prevSnapshot) == 0 {
 		return nil
 	}
 	return fn(rawMetrics)
 }
 
-func convert(rawMetrics []collector.MetricsDutum) []*mackerel.MetricValue {
-	now := time.Now().Unix()
+func (c *Converter) convert(rawMetrics []collector.MetricsDutum) []*Metric {
+	now := time.Unix(time.Now().Unix(), 0)
 
-	metrics := make([]*mackerel.MetricValue, 0)
+	metrics := make([]*Metric, 0)
 	for _, metric := range rawMetrics {
 		prevValue := metric.Value
-		for _, v := range prevSnapshot {
+		for _, v := range c.prevSnapshot {
 			if v.IfIndex == metric.IfIndex && v.Mib == metric.Mib {
 				prevValue = v.Value
 				break
@@ -43,26 +62,41 @@ func convert(rawMetrics []collector.MetricsDutum) []*mackerel.MetricValue {
 		value := calcurateDiff(prevValue, metric.Value, overflowValue(metric.Mib))
 
 		var name string
-		ifName := escapeInterfaceName(metric.IfName)
+		kind := KindDelta
 		if deltaValues(metric.Mib) {
 			direction := "txBytes"
 			if receiveDirection(metric.Mib) {
 				direction = "rxBytes"
 			}
-			name = fmt.Sprintf("interface.%s.%s.delta", ifName, direction)
-			value /= 60
+			name = fmt.Sprintf("interface.*.%s.delta", direction)
+			// the interval is not always whole seconds, such as once -interval 1500ms.
+			value = uint64(math.Trunc(float64(value) / c.interval.Seconds()))
+			kind = KindGauge
 		} else {
-			name = fmt.Sprintf("custom.interface.%s.%s", metric.Mib, ifName)
+			name = fmt.Sprintf("custom.interface.%s.*", metric.Mib)
 		}
-		metrics = append(metrics, &mackerel.MetricValue{
-			Name:  name,
-			Time:  now,
-			Value: value,
+		metrics = append(metrics, &Metric{
+			Name:   name,
+			Labels: interfaceLabels(metric),
+			Time:   now,
+			Value:  float64(value),
+			Kind:   kind,
 		})
 	}
 	return metrics
 }
 
+func interfaceLabels(metric collector.MetricsDutum) map[string]string {
+	labels := map[string]string{
+		"ifIndex":     strconv.FormatUint(metric.IfIndex, 10),
+		InstanceLabel: metric.IfName,
+	}
+	if metric.IfAlias != "" {
+		labels["ifAlias"] = metric.IfAlias
+	}
+	return labels
+}
+
 func escapeInterfaceName(ifName string) string {
 	return strings.Replace(strings.Replace(strings.Replace(ifName, "/", "-", -1), ".", "_", -1), " ", "", -1)
 }
@@ -89,3 +123,20 @@ func calcurateDiff(a, b, overflow uint64) uint64 {
 		return b - a
 	}
 }
+
+// Counters returns values as read from the device, for sinks calculating by themselves.
+func Counters(rawMetrics []collector.MetricsDutum) []*Metric {
+	now := time.Unix(time.Now().Unix(), 0)
+
+	metrics := make([]*Metric, 0, len(rawMetrics))
+	for _, metric := range rawMetrics {
+		metrics = append(metrics, &Metric{
+			Name:   fmt.Sprintf("interface.*.%s", metric.Mib),
+			Labels: interfaceLabels(metric),
+			Time:   now,
+			Value:  float64(metric.Value),
+			Kind:   KindCounter,
+		})
+	}
+	return metrics
+}
@@ -7,7 +7,6 @@ import (
 	"time"
 
 	"github.com/google/go-cmp/cmp"
-	"github.com/mackerelio/mackerel-client-go"
 
 	"github.com/yseto/switch-traffic-to-mackerel/collector"
 )
@@ -30,12 +29,13 @@ func TestCalcurateDiff(t *testing.T) {
 	compare(t, calcurateDiff(5, 2, 4), 1)
 }
 
-func dummyFn(rawMetrics []collector.MetricsDutum) []*mackerel.MetricValue {
+func dummyFn(rawMetrics []collector.MetricsDutum) []*Metric {
 	return nil
 }
 
 func Test_replaceSnapshot(t *testing.T) {
-	replaceSnapshot([]collector.MetricsDutum{
+	c := NewConverter(time.Minute)
+	c.replaceSnapshot([]collector.MetricsDutum{
 		{
 			IfIndex: 1,
 			Mib:     "",
@@ -44,7 +44,7 @@ func Test_replaceSnapshot(t *testing.T) {
 		},
 	}, dummyFn)
 
-	actual := prevSnapshot
+	actual := c.prevSnapshot
 	expected := []collector.MetricsDutum{
 		{
 			IfIndex: 1,
@@ -60,7 +60,8 @@ func Test_replaceSnapshot(t *testing.T) {
 }
 
 func Test_convert(t *testing.T) {
-	prevSnapshot = []collector.MetricsDutum{
+	c := NewConverter(time.Minute)
+	c.prevSnapshot = []collector.MetricsDutum{
 		{
 			IfIndex: 1,
 			Mib:     "ifHCInOctets",
@@ -81,7 +82,7 @@ func Test_convert(t *testing.T) {
 		},
 	}
 
-	actual := convert([]collector.MetricsDutum{
+	actual := c.convert([]collector.MetricsDutum{
 		{
 			IfIndex: 1,
 			Mib:     "ifHCInOctets",
@@ -102,21 +103,98 @@ func Test_convert(t *testing.T) {
 		},
 	})
 
-	expected := []*mackerel.MetricValue{
+	labels := map[string]string{"ifIndex": "1", "ifName": "eth0"}
+	now := time.Unix(time.Now().Unix(), 0)
+	expected := []*Metric{
 		{
-			Name:  "interface.eth0.rxBytes.delta",
-			Time:  time.Now().Unix(),
-			Value: uint64(0),
+			Name:   "interface.*.rxBytes.delta",
+			Labels: labels,
+			Time:   now,
+			Value:  0,
+			Kind:   KindGauge,
 		},
 		{
-			Name:  "interface.eth0.txBytes.delta",
-			Time:  time.Now().Unix(),
-			Value: uint64(1),
+			Name:   "interface.*.txBytes.delta",
+			Labels: labels,
+			Time:   now,
+			Value:  1,
+			Kind:   KindGauge,
 		},
 		{
-			Name:  "custom.interface.ifInDiscards.eth0",
-			Time:  time.Now().Unix(),
-			Value: uint64(1),
+			Name:   "custom.interface.ifInDiscards.*",
+			Labels: labels,
+			Time:   now,
+			Value:  1,
+			Kind:   KindDelta,
+		},
+	}
+
+	if diff := cmp.Diff(actual, expected); diff != "" {
+		t.Errorf("value is mismatch (-actual +expected):%s", diff)
+	}
+}
+
+func Test_convert_interval(t *testing.T) {
+	prev := []collector.MetricsDutum{{IfIndex: 1, Mib: "ifHCInOctets", IfName: "eth0", Value: 0}}
+	current := []collector.MetricsDutum{{IfIndex: 1, Mib: "ifHCInOctets", IfName: "eth0", Value: 3000}}
+	tests := []struct {
+		interval time.Duration
+		expected float64
+	}{
+		{interval: time.Minute, expected: 50},
+		{interval: 1500 * time.Millisecond, expected: 2000},
+		{interval: 61900 * time.Millisecond, expected: 48},
+	}
+	for _, tc := range tests {
+		c := NewConverter(tc.interval)
+		c.prevSnapshot = prev
+		actual := c.convert(current)
+		if actual[0].Value != tc.expected {
+			t.Errorf("invalid result %s %v", tc.interval, actual[0].Value)
+		}
+	}
+}
+
+func TestMetricPath(t *testing.T) {
+	m := &Metric{
+		Name:   "interface.*.rxBytes.delta",
+		Labels: map[string]string{"ifName": "ge-0/0/1.0"},
+	}
+	compare(t, m.Path(), "interface.ge-0-0-1_0.rxBytes.delta")
+	compare(t, m.BaseName(), "interface.rxBytes.delta")
+
+	m = &Metric{
+		Name:   "custom.interface.ifInDiscards.*",
+		Labels: map[string]string{"ifName": "eth0"},
+	}
+	compare(t, m.Path(), "custom.interface.ifInDiscards.eth0")
+	compare(t, m.BaseName(), "custom.interface.ifInDiscards")
+
+	m = &Metric{
+		Name: "custom.custommibs.d41d8cd98f00b204e9800998ecf8427e.foo.bar",
+	}
+	compare(t, m.Path(), "custom.custommibs.d41d8cd98f00b204e9800998ecf8427e.foo.bar")
+	compare(t, m.BaseName(), "custom.custommibs.d41d8cd98f00b204e9800998ecf8427e.foo.bar")
+}
+
+func TestCounters(t *testing.T) {
+	actual := Counters([]collector.MetricsDutum{
+		{
+			IfIndex: 1,
+			Mib:     "ifHCInOctets",
+			IfName:  "eth0",
+			IfAlias: "uplink",
+			Value:   12345,
+		},
+	})
+
+	expected := []*Metric{
+		{
+			Name:   "interface.*.ifHCInOctets",
+			Labels: map[string]string{"ifIndex": "1", "ifName": "eth0", "ifAlias": "uplink"},
+			Time:   time.Unix(time.Now().Unix(), 0),
+			Value:  12345,
+			Kind:   KindCounter,
 		},
 	}
 
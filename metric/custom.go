@@ -2,8 +2,6 @@ package metric
 
 import (
 	"time"
-
-	"github.com/mackerelio/mackerel-client-go"
 )
 
 type Custom struct {
@@ -14,16 +12,18 @@ func NewCustom(mapping map[string]string) *Custom {
 	return &Custom{mapping: mapping}
 }
 
-func (c *Custom) ConvertCustom(resp map[string]float64) []*mackerel.MetricValue {
-	now := time.Now().Unix()
+func (c *Custom) ConvertCustom(resp map[string]float64) []*Metric {
+	now := time.Unix(time.Now().Unix(), 0)
 
-	metrics := make([]*mackerel.MetricValue, 0)
+	metrics := make([]*Metric, 0)
 	for metricName, mib := range c.mapping {
 		if f, ok := resp[mib]; ok {
-			metrics = append(metrics, &mackerel.MetricValue{
-				Name:  metricName,
-				Time:  now,
-				Value: f,
+			metrics = append(metrics, &Metric{
+				Name:   metricName,
+				Labels: map[string]string{"mib": mib},
+				Time:   now,
+				Value:  f,
+				Kind:   KindGauge,
 			})
 		}
 	}
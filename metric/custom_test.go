@@ -5,7 +5,6 @@ import (
 	"time"
 
 	"github.com/google/go-cmp/cmp"
-	"github.com/mackerelio/mackerel-client-go"
 )
 
 func TestConvertCustom(t *testing.T) {
@@ -23,11 +22,13 @@ func TestConvertCustom(t *testing.T) {
 
 	actual := c.ConvertCustom(input)
 
-	expected := []*mackerel.MetricValue{
+	expected := []*Metric{
 		{
-			Name:  "foo",
-			Time:  time.Now().Unix(),
-			Value: 1.2345,
+			Name:   "foo",
+			Labels: map[string]string{"mib": "1.2.3.4"},
+			Time:   time.Unix(time.Now().Unix(), 0),
+			Value:  1.2345,
+			Kind:   KindGauge,
 		},
 	}
 
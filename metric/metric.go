@@ -0,0 +1,52 @@
+package metric
+
+import (
+	"strings"
+	"time"
+)
+
+// Kind is how the value of Metric is measured.
+type Kind string
+
+const (
+	// KindGauge is a value at the time, such as a rate.
+	KindGauge Kind = "gauge"
+	// KindDelta is a difference from the previous collection.
+	KindDelta Kind = "delta"
+	// KindCounter is a cumulative value as read from the device.
+	KindCounter Kind = "counter"
+)
+
+// InstanceLabel is the label placed at "*" of the name.
+const InstanceLabel = "ifName"
+
+// Metric is a value independent of sinks.
+type Metric struct {
+	// Name is a dotted name. "*" stands for the instance, as graph definitions of Mackerel.
+	Name   string            `json:"name"`
+	Labels map[string]string `json:"labels,omitempty"`
+	Value  float64           `json:"value"`
+	Time   time.Time         `json:"timestamp"`
+	Kind   Kind              `json:"kind"`
+}
+
+// Path returns the hierarchical name, replaced "*" by the instance label.
+func (m *Metric) Path() string {
+	return strings.Replace(m.Name, "*", escapeInterfaceName(m.Labels[InstanceLabel]), 1)
+}
+
+// BaseName returns the name without the instance, for sinks having labels.
+func (m *Metric) BaseName() string {
+	name := strings.Replace(m.Name, ".*", "", 1)
+	return strings.Replace(name, "*.", "", 1)
+}
+
+// SetLabel sets the label to all metrics.
+func SetLabel(metrics []*Metric, key, value string) {
+	for _, m := range metrics {
+		if m.Labels == nil {
+			m.Labels = make(map[string]string)
+		}
+		m.Labels[key] = value
+	}
+}
@@ -0,0 +1,72 @@
+package metric
+
+import (
+	"regexp"
+	"time"
+
+	"github.com/yseto/switch-traffic-to-mackerel/snmp"
+)
+
+// Self is the state of the agent about a target, in a collection cycle.
+type Self struct {
+	SNMP               snmp.Stats
+	CollectionDuration time.Duration
+	Interfaces         int
+	Queues             []SelfQueue
+}
+
+type SelfQueue struct {
+	Name        string
+	Length      int
+	SendLatency time.Duration
+	// Dropped is the total since start.
+	Dropped int
+}
+
+// SelfConverter keeps the previous number of dropped values, to post differences.
+type SelfConverter struct {
+	prevDropped map[string]int
+}
+
+func NewSelfConverter() *SelfConverter {
+	return &SelfConverter{prevDropped: make(map[string]int)}
+}
+
+var invalidQueueNameRe = regexp.MustCompile(`[^a-zA-Z0-9_-]`)
+
+func (c *SelfConverter) ConvertSelf(s *Self) []*Metric {
+	now := time.Unix(time.Now().Unix(), 0)
+
+	gauge := func(name string, value float64) *Metric {
+		return &Metric{Name: name, Time: now, Value: value, Kind: KindGauge}
+	}
+	metrics := []*Metric{
+		gauge("custom.stm.snmp_rtt.average", milliseconds(s.SNMP.AverageRTT())),
+		gauge("custom.stm.collection_duration.total", milliseconds(s.CollectionDuration)),
+		gauge("custom.stm.snmp_requests.pdus", float64(s.SNMP.Responses)),
+		gauge("custom.stm.snmp_requests.varbinds", float64(s.SNMP.Varbinds)),
+		gauge("custom.stm.snmp_errors.timeouts", float64(s.SNMP.Timeouts)),
+		gauge("custom.stm.snmp_errors.retries", float64(s.SNMP.Retries)),
+		gauge("custom.stm.interfaces.collected", float64(s.Interfaces)),
+	}
+
+	for _, q := range s.Queues {
+		name := invalidQueueNameRe.ReplaceAllString(q.Name, "_")
+		dropped := q.Dropped - c.prevDropped[q.Name]
+		c.prevDropped[q.Name] = q.Dropped
+
+		for _, m := range []*Metric{
+			gauge("custom.stm.queue_length."+name, float64(q.Length)),
+			gauge("custom.stm.dropped."+name, float64(dropped)),
+			gauge("custom.stm.send_latency."+name, milliseconds(q.SendLatency)),
+		} {
+			m.Labels = map[string]string{"queue": q.Name}
+			metrics = append(metrics, m)
+		}
+	}
+	return metrics
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,52 @@
+package metric
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/yseto/switch-traffic-to-mackerel/snmp"
+)
+
+func TestConvertSelf(t *testing.T) {
+	c := NewSelfConverter()
+	self := &Self{
+		SNMP: snmp.Stats{
+			Responses: 4,
+			Varbinds:  100,
+			Retries:   1,
+			RTT:       20 * time.Millisecond,
+		},
+		CollectionDuration: 1500 * time.Millisecond,
+		Interfaces:         24,
+		Queues: []SelfQueue{
+			{Name: "mackerel:sw1", Length: 2, SendLatency: 300 * time.Millisecond, Dropped: 5},
+		},
+	}
+
+	now := time.Unix(time.Now().Unix(), 0)
+	queue := map[string]string{"queue": "mackerel:sw1"}
+	expected := []*Metric{
+		{Name: "custom.stm.snmp_rtt.average", Value: 5, Time: now, Kind: KindGauge},
+		{Name: "custom.stm.collection_duration.total", Value: 1500, Time: now, Kind: KindGauge},
+		{Name: "custom.stm.snmp_requests.pdus", Value: 4, Time: now, Kind: KindGauge},
+		{Name: "custom.stm.snmp_requests.varbinds", Value: 100, Time: now, Kind: KindGauge},
+		{Name: "custom.stm.snmp_errors.timeouts", Value: 0, Time: now, Kind: KindGauge},
+		{Name: "custom.stm.snmp_errors.retries", Value: 1, Time: now, Kind: KindGauge},
+		{Name: "custom.stm.interfaces.collected", Value: 24, Time: now, Kind: KindGauge},
+		{Name: "custom.stm.queue_length.mackerel_sw1", Labels: queue, Value: 2, Time: now, Kind: KindGauge},
+		{Name: "custom.stm.dropped.mackerel_sw1", Labels: queue, Value: 5, Time: now, Kind: KindGauge},
+		{Name: "custom.stm.send_latency.mackerel_sw1", Labels: queue, Value: 300, Time: now, Kind: KindGauge},
+	}
+	if diff := cmp.Diff(c.ConvertSelf(self), expected); diff != "" {
+		t.Errorf("value is mismatch (-actual +expected):%s", diff)
+	}
+
+	// dropped is the difference from the previous.
+	self.Queues[0].Dropped = 7
+	actual := c.ConvertSelf(self)
+	if actual[8].Value != 2 {
+		t.Errorf("invalid dropped %v", actual[8].Value)
+	}
+}
@@ -3,6 +3,8 @@ package mib
 import (
 	"fmt"
 	"regexp"
+	"slices"
+	"strconv"
 )
 
 func Oidmapping() map[string]string {
@@ -30,6 +32,8 @@ func Validate(rawMibs []string) ([]string, error) {
 			}
 			parseMibs = append(parseMibs, key)
 		}
+		// in the same order on every load, to compare configs on reload.
+		slices.Sort(parseMibs)
 		return parseMibs, nil
 	}
 
@@ -51,3 +55,45 @@ func ValidateCustom(mib string) error {
 	}
 	return nil
 }
+
+// ifTypes are common names of IANAifType.
+var ifTypes = map[string]uint64{
+	"other":            1,
+	"ethernetCsmacd":   6,
+	"ppp":              23,
+	"softwareLoopback": 24,
+	"atm":              37,
+	"sonet":            39,
+	"propVirtual":      53,
+	"fibreChannel":     56,
+	"fastEther":        62,
+	"ieee80211":        71,
+	"gigabitEthernet":  117,
+	"tunnel":           131,
+	"l2vlan":           135,
+	"l3ipvlan":         136,
+	"ieee8023adLag":    161,
+	"mpls":             166,
+	"bridge":           209,
+}
+
+// IfType returns the IANAifType of a name such as ethernetCsmacd, or of a number.
+func IfType(name string) (uint64, error) {
+	if v, ok := ifTypes[name]; ok {
+		return v, nil
+	}
+	if v, err := strconv.ParseUint(name, 10, 64); err == nil {
+		return v, nil
+	}
+	return 0, fmt.Errorf("ifType %s is not supported", name)
+}
+
+// IfTypeName returns the name of the IANAifType, or the number when it is not known.
+func IfTypeName(ifType uint64) string {
+	for name, v := range ifTypes {
+		if v == ifType {
+			return name
+		}
+	}
+	return strconv.FormatUint(ifType, 10)
+}
@@ -92,3 +92,22 @@ func TestOidMapping(t *testing.T) {
 		t.Errorf("value is mismatch (-actual +expected):%s", diff)
 	}
 }
+
+func TestIfType(t *testing.T) {
+	var cases = map[string]uint64{
+		"ethernetCsmacd": 6,
+		"ieee8023adLag":  161,
+		"161":            161,
+		"unknownType":    0,
+	}
+
+	for tc, expected := range cases {
+		actual, err := IfType(tc)
+		if (err != nil) != (expected == 0) {
+			t.Errorf("%s: %v", tc, err)
+		}
+		if actual != expected {
+			t.Errorf("%s: invalid result %d", tc, actual)
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"slices"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/yseto/switch-traffic-to-mackerel/collector"
+	"github.com/yseto/switch-traffic-to-mackerel/config"
+	"github.com/yseto/switch-traffic-to-mackerel/mackerel"
+	"github.com/yseto/switch-traffic-to-mackerel/metric"
+	"github.com/yseto/switch-traffic-to-mackerel/queue"
+)
+
+const (
+	formatTable  = "table"
+	formatJSON   = "json"
+	formatPlugin = "plugin"
+)
+
+// onceCommand samples targets twice, prints the values, and posts them optionally.
+func onceCommand(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("once", flag.ExitOnError)
+	var tf targetFlags
+	tf.register(fs)
+	fs.Lookup("target").Usage = "`target` or name on Mackerel, all targets when empty"
+	var interval time.Duration
+	var format string
+	var post bool
+	fs.DurationVar(&interval, "interval", 10*time.Second, "`interval` between two samples")
+	fs.StringVar(&format, "format", formatTable, "output `format`, table, json or plugin")
+	fs.BoolVar(&post, "post", false, "post values to mackerel and sinks of the config")
+	fs.Parse(args) // nolint
+
+	if interval < time.Second {
+		return fmt.Errorf("interval must be 1s or more")
+	}
+	if format != formatTable && format != formatJSON && format != formatPlugin {
+		return fmt.Errorf("format %s is not supported", format)
+	}
+
+	c, err := config.Init(tf.filename)
+	if err != nil {
+		return err
+	}
+	if tf.target != "" {
+		t, err := tf.find(c)
+		if err != nil {
+			return err
+		}
+		c.Targets = []*config.Target{t}
+	}
+
+	results := make([][]*metric.Metric, len(c.Targets))
+	errs := make([]error, len(c.Targets))
+	wg := &sync.WaitGroup{}
+	for i := range c.Targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], errs[i] = sample(ctx, c.Targets[i], interval)
+		}()
+	}
+	wg.Wait()
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+
+	if err := printMetrics(os.Stdout, format, c.Targets, results); err != nil {
+		return err
+	}
+	if post {
+		return postMetrics(ctx, c, results)
+	}
+	return nil
+}
+
+// sample returns differences of two samples, and custom MIBs of the latter.
+func sample(ctx context.Context, t *config.Target, interval time.Duration) ([]*metric.Metric, error) {
+	converter := metric.NewConverter(interval)
+	next := time.Now().Add(interval)
+
+	first, err := collector.Do(ctx, t)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", t.Target, err)
+	}
+	converter.Convert(first)
+
+	timer := time.NewTimer(time.Until(next))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	second, err := collector.Do(ctx, t)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", t.Target, err)
+	}
+	metrics := converter.Convert(second)
+	counters := metric.Counters(second)
+
+	if len(t.CustomMIBs) > 0 {
+		values, err := collector.DoCustomMIBs(ctx, t)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", t.Target, err)
+		}
+		metrics = append(metrics, metric.NewCustom(t.CustomMIBmetricNameMappedMIBs).ConvertCustom(values)...)
+	}
+	slices.SortStableFunc(metrics, func(a, b *metric.Metric) int {
+		return cmp.Compare(a.Path(), b.Path())
+	})
+	metrics = append(metrics, counters...)
+	metric.SetLabel(metrics, "target", t.Target)
+	return metrics, nil
+}
+
+var invalidPluginPrefixRe = regexp.MustCompile(`[^a-zA-Z0-9_-]`)
+
+// printMetrics prints values except counters.
+func printMetrics(w io.Writer, format string, targets []*config.Target, results [][]*metric.Metric) error {
+	switch format {
+	case formatJSON:
+		values := make([]*metric.Metric, 0)
+		for _, m := range slices.Concat(results...) {
+			if m.Kind != metric.KindCounter {
+				values = append(values, m)
+			}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(values)
+
+	case formatPlugin:
+		for i, t := range targets {
+			if err := writePlugin(w, pluginPrefix(targets, t), results[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	default:
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "TARGET\tMETRIC\tVALUE") // nolint
+		for i, t := range targets {
+			for _, m := range results[i] {
+				if m.Kind == metric.KindCounter {
+					continue
+				}
+				fmt.Fprintf(tw, "%s\t%s\t%v\n", t.Target, m.Path(), m.Value) // nolint
+			}
+		}
+		return tw.Flush()
+	}
+}
+
+// pluginPrefix returns the prefix of names in plugin format, the name of the target when there are targets.
+func pluginPrefix(targets []*config.Target, t *config.Target) string {
+	if len(targets) == 1 {
+		return ""
+	}
+	return invalidPluginPrefixRe.ReplaceAllString(t.Name(), "_") + "."
+}
+
+// writePlugin writes values in the format of custom metric plugins of mackerel-agent.
+func writePlugin(w io.Writer, prefix string, metrics []*metric.Metric) error {
+	for _, m := range metrics {
+		if m.Kind == metric.KindCounter {
+			continue
+		}
+		if _, err := fmt.Fprintf(w, "%s%s\t%v\t%d\n", prefix, mackerel.PluginName(m), m.Value, m.Time.Unix()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// postMetrics sends values to the outputs of the config, as the agent does in a collection.
+func postMetrics(ctx context.Context, c *config.Config, results [][]*metric.Metric) error {
+	shared, serviceQueue, err := sharedQueues(ctx, c)
+	if err != nil {
+		return err
+	}
+	queues := append(queue.Group{}, shared...)
+	for i, t := range c.Targets {
+		targetQueues := shared
+		if t.Mackerel != nil {
+			if t.Mackerel.HostID == "" {
+				return fmt.Errorf("%s: mackerel.host-id is needed to post, run the agent once to register the host", t.Target)
+			}
+			q := queue.New(queue.Arg{
+				Name: "mackerel:" + t.Name(),
+				SendFunc: mackerel.New(&mackerel.Arg{
+					TargetAddr: t.Host,
+					Apikey:     t.Mackerel.ApiKey,
+					HostID:     t.Mackerel.HostID,
+					Name:       t.Name(),
+				}),
+				DryRun:         c.DryRun,
+				DeadLetterFile: t.Mackerel.DeadLetterFile,
+			})
+			queues = append(queues, q)
+			targetQueues = append(queue.Group{q}, shared...)
+		}
+		targetQueues.Enqueue(results[i])
+	}
+	if serviceQueue != nil {
+		all := slices.Concat(results...)
+		for _, a := range c.Aggregates {
+			serviceQueue.Enqueue(metric.Aggregate(all, a.MetricName, a.InterfaceRegexp))
+		}
+	}
+
+	flushCtx, cancel := context.WithTimeout(ctx, c.ShutdownGracePeriod)
+	defer cancel()
+	before := dropped(queues)
+	queues.Flush(flushCtx)
+	// values rejected permanently are dropped as well as abandoned ones.
+	if n := dropped(queues) - before; n > 0 {
+		return fmt.Errorf("%d values are not posted", n)
+	}
+	return nil
+}
+
+// dropped returns the number of values rejected or abandoned by the queues.
+func dropped(queues queue.Group) int {
+	var n int
+	for _, s := range queues.Stats() {
+		n += s.Dropped
+	}
+	return n
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/yseto/switch-traffic-to-mackerel/collector"
+	"github.com/yseto/switch-traffic-to-mackerel/config"
+	"github.com/yseto/switch-traffic-to-mackerel/mackerel"
+	"github.com/yseto/switch-traffic-to-mackerel/metric"
+)
+
+// values older than this are not used, differences would be averaged too long.
+const stalePluginState = 10 * time.Minute
+
+// pluginState is values of the previous run, as mackerel-agent runs plugins every minute.
+type pluginState struct {
+	Targets map[string]*pluginTargetState `json:"targets"`
+}
+
+type pluginTargetState struct {
+	Time   time.Time                `json:"time"`
+	Values []collector.MetricsDutum `json:"values"`
+}
+
+// pluginCommand prints values for mackerel-agent, as a custom metric plugin.
+func pluginCommand(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("plugin", flag.ExitOnError)
+	var tf targetFlags
+	tf.register(fs)
+	fs.Lookup("target").Usage = "`target` or name on Mackerel, all targets when empty"
+	var statePath string
+	fs.StringVar(&statePath, "state", "", "state `file` keeping values of the previous run, in MACKEREL_PLUGIN_WORKDIR or the temporary directory when empty")
+	fs.Parse(args) // nolint
+
+	c, err := config.Init(tf.filename)
+	if err != nil {
+		return err
+	}
+	if tf.target != "" {
+		t, err := tf.find(c)
+		if err != nil {
+			return err
+		}
+		c.Targets = []*config.Target{t}
+	}
+
+	if os.Getenv("MACKEREL_AGENT_PLUGIN_META") == "1" {
+		meta := mackerel.NewPluginMeta(pluginPrefix(c.Targets, c.Targets[0]), c.Targets[0].CustomMIBsGraphDefs)
+		for _, t := range c.Targets[1:] {
+			meta.Add(pluginPrefix(c.Targets, t), t.CustomMIBsGraphDefs)
+		}
+		fmt.Println("# mackerel-agent-plugin")
+		return json.NewEncoder(os.Stdout).Encode(meta)
+	}
+
+	if statePath == "" {
+		statePath, err = defaultPluginStatePath(tf.filename)
+		if err != nil {
+			return err
+		}
+	}
+	state, err := loadPluginState(statePath)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	results := make([][]*metric.Metric, len(c.Targets))
+	states := make([]*pluginTargetState, len(c.Targets))
+	errs := make([]error, len(c.Targets))
+	wg := &sync.WaitGroup{}
+	for i, t := range c.Targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], states[i], errs[i] = pluginSample(ctx, t, state.Targets[t.Target], now)
+		}()
+	}
+	wg.Wait()
+
+	// failed targets keep the previous values.
+	for i, t := range c.Targets {
+		if errs[i] != nil {
+			slog.Warn("collect failed", "target", t.Target, "phase", "collect", "error", errs[i])
+			continue
+		}
+		state.Targets[t.Target] = states[i]
+	}
+	if err := savePluginState(statePath, state); err != nil {
+		return err
+	}
+
+	for i, t := range c.Targets {
+		if err := writePlugin(os.Stdout, pluginPrefix(c.Targets, t), results[i]); err != nil {
+			return err
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// pluginSample returns differences from the previous run, and the state of this run.
+func pluginSample(ctx context.Context, t *config.Target, prev *pluginTargetState, now time.Time) ([]*metric.Metric, *pluginTargetState, error) {
+	raw, err := collector.Do(ctx, t)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var metrics []*metric.Metric
+	if prev != nil {
+		if elapsed := now.Sub(prev.Time); elapsed >= time.Second && elapsed <= stalePluginState {
+			converter := metric.NewConverter(elapsed)
+			converter.Restore(prev.Values)
+			metrics = converter.Convert(raw)
+		}
+	}
+
+	if len(t.CustomMIBs) > 0 {
+		values, err := collector.DoCustomMIBs(ctx, t)
+		if err != nil {
+			return nil, nil, err
+		}
+		metrics = append(metrics, metric.NewCustom(t.CustomMIBmetricNameMappedMIBs).ConvertCustom(values)...)
+	}
+	return metrics, &pluginTargetState{Time: now, Values: raw}, nil
+}
+
+// defaultPluginStatePath is per config, configs for sites may run on one host.
+func defaultPluginStatePath(filename string) (string, error) {
+	abs, err := filepath.Abs(filename)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(abs))
+	dir := os.Getenv("MACKEREL_PLUGIN_WORKDIR")
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "switch-traffic-to-mackerel-"+hex.EncodeToString(sum[:8])+".json"), nil
+}
+
+func loadPluginState(path string) (*pluginState, error) {
+	state := &pluginState{Targets: make(map[string]*pluginTargetState)}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, state); err != nil {
+		// a broken state is discarded, values are reported from the next run.
+		slog.Warn("state is discarded", "phase", "plugin", "path", path, "error", err)
+		return &pluginState{Targets: make(map[string]*pluginTargetState)}, nil
+	}
+	if state.Targets == nil {
+		state.Targets = make(map[string]*pluginTargetState)
+	}
+	return state, nil
+}
+
+// savePluginState replaces the file, not to leave a partial state.
+func savePluginState(path string, state *pluginState) error {
+	b, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name()) // nolint
+	if _, err := f.Write(b); err != nil {
+		f.Close() // nolint
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
@@ -0,0 +1,283 @@
+package prometheus
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/exp/maps"
+
+	"github.com/yseto/switch-traffic-to-mackerel/collector"
+	"github.com/yseto/switch-traffic-to-mackerel/config"
+)
+
+const contentType = "text/plain; version=0.0.4; charset=utf-8"
+
+type family struct {
+	name string
+	help string
+}
+
+var (
+	octetsFamily = family{
+		name: "switch_interface_octets_total",
+		help: "The total number of octets on the interface.",
+	}
+	discardsFamily = family{
+		name: "switch_interface_discards_total",
+		help: "The number of packets discarded on the interface.",
+	}
+	errorsFamily = family{
+		name: "switch_interface_errors_total",
+		help: "The number of packets with errors on the interface.",
+	}
+	customFamily = family{
+		name: "switch_custom_mib_value",
+		help: "The value of custom MIB.",
+	}
+)
+
+type counterMIB struct {
+	family    family
+	direction string
+	// 64 bit counter is preferred over 32 bit one.
+	highCapacity bool
+}
+
+var counterMIBs = map[string]counterMIB{
+	"ifInOctets":    {family: octetsFamily, direction: "in"},
+	"ifOutOctets":   {family: octetsFamily, direction: "out"},
+	"ifHCInOctets":  {family: octetsFamily, direction: "in", highCapacity: true},
+	"ifHCOutOctets": {family: octetsFamily, direction: "out", highCapacity: true},
+	"ifInDiscards":  {family: discardsFamily, direction: "in"},
+	"ifOutDiscards": {family: discardsFamily, direction: "out"},
+	"ifInErrors":    {family: errorsFamily, direction: "in"},
+	"ifOutErrors":   {family: errorsFamily, direction: "out"},
+}
+
+type customMIB struct {
+	graph  string
+	metric string
+	mib    string
+}
+
+// Exporter exposes the latest collected values in Prometheus text format.
+type Exporter struct {
+	mu sync.RWMutex
+
+	// in order of config.
+	targets []*targetState
+}
+
+type targetState struct {
+	target     string
+	customMIBs []customMIB
+
+	interfaces []collector.MetricsDutum
+	custom     map[string]float64
+}
+
+func New(c *config.Config) *Exporter {
+	e := &Exporter{}
+	e.Reload(c)
+	return e
+}
+
+// Reload replaces targets by the config. values of kept targets are served until the next collection.
+func (e *Exporter) Reload(c *config.Config) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var targets []*targetState
+	for _, t := range c.Targets {
+		var customMIBs []customMIB
+		for _, g := range t.CustomMIBsGraphDefs {
+			for _, m := range g.Metrics {
+				customMIBs = append(customMIBs, customMIB{
+					graph:  g.DisplayName,
+					metric: m.DisplayName,
+					mib:    t.CustomMIBmetricNameMappedMIBs[m.Name],
+				})
+			}
+		}
+		state := &targetState{
+			target:     t.Target,
+			customMIBs: customMIBs,
+		}
+		if prev := e.lookup(t.Target); prev != nil {
+			state.interfaces = prev.interfaces
+			state.custom = prev.custom
+		}
+		targets = append(targets, state)
+	}
+	e.targets = targets
+}
+
+func (e *Exporter) lookup(target string) *targetState {
+	for _, t := range e.targets {
+		if t.target == target {
+			return t
+		}
+	}
+	return nil
+}
+
+// Update replaces interface counters of the target by raw values of the collection cycle.
+// nil drops them on a collection error, stale counters are not served.
+func (e *Exporter) Update(target string, metrics []collector.MetricsDutum) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if t := e.lookup(target); t != nil {
+		t.interfaces = metrics
+	}
+}
+
+// UpdateCustom replaces custom MIB values of the target. mib:value
+// nil drops them on a collection error.
+func (e *Exporter) UpdateCustom(target string, values map[string]float64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if t := e.lookup(target); t != nil {
+		t.custom = values
+	}
+}
+
+func (e *Exporter) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", contentType)
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	e.write(w) // nolint
+}
+
+type sample struct {
+	family family
+	labels [][2]string
+	value  string
+}
+
+type counterKey struct {
+	family    string
+	ifIndex   uint64
+	direction string
+}
+
+func (e *Exporter) write(w io.Writer) error {
+	var samples, customSamples []sample
+	for _, t := range e.targets {
+		samples = append(samples, t.counterSamples()...)
+		customSamples = append(customSamples, t.customSamples()...)
+	}
+	// samples of a family must be contiguous.
+	slices.SortStableFunc(samples, func(a, b sample) int {
+		return strings.Compare(a.family.name, b.family.name)
+	})
+	samples = append(samples, customSamples...)
+
+	var current string
+	for _, s := range samples {
+		if s.family.name != current {
+			current = s.family.name
+			typ := "counter"
+			if s.family == customFamily {
+				typ = "gauge"
+			}
+			if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", s.family.name, s.family.help, s.family.name, typ); err != nil {
+				return err
+			}
+		}
+		if _, err := fmt.Fprintf(w, "%s{%s} %s\n", s.family.name, formatLabels(s.labels), s.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *targetState) counterSamples() []sample {
+	counters := make(map[counterKey]collector.MetricsDutum)
+	for _, m := range t.interfaces {
+		c, ok := counterMIBs[m.Mib]
+		if !ok {
+			continue
+		}
+		key := counterKey{family: c.family.name, ifIndex: m.IfIndex, direction: c.direction}
+		if prev, exists := counters[key]; exists && counterMIBs[prev.Mib].highCapacity {
+			continue
+		}
+		counters[key] = m
+	}
+
+	keys := maps.Keys(counters)
+	slices.SortFunc(keys, func(a, b counterKey) int {
+		return cmp.Or(
+			strings.Compare(a.family, b.family),
+			cmp.Compare(a.ifIndex, b.ifIndex),
+			strings.Compare(a.direction, b.direction),
+		)
+	})
+
+	var samples []sample
+	for _, key := range keys {
+		m := counters[key]
+		samples = append(samples, sample{
+			family: counterMIBs[m.Mib].family,
+			labels: [][2]string{
+				{"target", t.target},
+				{"ifIndex", strconv.FormatUint(m.IfIndex, 10)},
+				{"ifName", m.IfName},
+				{"ifAlias", m.IfAlias},
+				{"direction", key.direction},
+			},
+			value: strconv.FormatUint(m.Value, 10),
+		})
+	}
+	return samples
+}
+
+func (t *targetState) customSamples() []sample {
+	var samples []sample
+	for _, c := range t.customMIBs {
+		v, ok := t.custom[c.mib]
+		if !ok {
+			continue
+		}
+		samples = append(samples, sample{
+			family: customFamily,
+			labels: [][2]string{
+				{"target", t.target},
+				{"graph", c.graph},
+				{"metric", c.metric},
+				{"mib", c.mib},
+			},
+			value: formatFloat(v),
+		})
+	}
+	return samples
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatLabels(labels [][2]string) string {
+	parts := make([]string, 0, len(labels))
+	for _, l := range labels {
+		parts = append(parts, fmt.Sprintf(`%s="%s"`, l[0], labelValueEscaper.Replace(l[1])))
+	}
+	return strings.Join(parts, ",")
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsNaN(v):
+		return "NaN"
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
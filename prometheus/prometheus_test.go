@@ -0,0 +1,154 @@
+package prometheus
+
+import (
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mackerelio/mackerel-client-go"
+
+	"github.com/yseto/switch-traffic-to-mackerel/collector"
+	"github.com/yseto/switch-traffic-to-mackerel/config"
+)
+
+func TestServeHTTP(t *testing.T) {
+	e := New(&config.Config{
+		Targets: []*config.Target{
+			{
+				Target: "192.0.2.1",
+				CustomMIBsGraphDefs: []*mackerel.GraphDefsParam{
+					{
+						Name:        "custom.custommibs.d2cbe65f53da8607e64173c1a83394fe",
+						DisplayName: "zoo",
+						Metrics: []*mackerel.GraphDefsMetric{
+							{
+								Name:        "custom.custommibs.d2cbe65f53da8607e64173c1a83394fe.foo.bar",
+								DisplayName: "foobar",
+							},
+						},
+					},
+				},
+				CustomMIBmetricNameMappedMIBs: map[string]string{
+					"custom.custommibs.d2cbe65f53da8607e64173c1a83394fe.foo.bar": "1.2.34.56",
+				},
+			},
+			{
+				Target: "192.0.2.2",
+			},
+		},
+	})
+
+	e.Update("192.0.2.1", []collector.MetricsDutum{
+		{IfIndex: 2, Mib: "ifHCOutOctets", IfName: "eth1", Value: 200},
+		{IfIndex: 1, Mib: "ifHCInOctets", IfName: "eth0", IfAlias: `uplink "a"`, Value: 10},
+		{IfIndex: 1, Mib: "ifInOctets", IfName: "eth0", IfAlias: `uplink "a"`, Value: 5},
+		{IfIndex: 1, Mib: "ifHCOutOctets", IfName: "eth0", IfAlias: `uplink "a"`, Value: 20},
+		{IfIndex: 1, Mib: "ifInErrors", IfName: "eth0", IfAlias: `uplink "a"`, Value: 1},
+	})
+	e.Update("192.0.2.2", []collector.MetricsDutum{
+		{IfIndex: 1, Mib: "ifHCInOctets", IfName: "ge-0/0/0", Value: 30},
+	})
+	// unknown target is ignored.
+	e.Update("192.0.2.3", []collector.MetricsDutum{
+		{IfIndex: 1, Mib: "ifHCInOctets", IfName: "eth0", Value: 40},
+	})
+	e.UpdateCustom("192.0.2.1", map[string]float64{
+		"1.2.34.56": 1.5,
+	})
+
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+
+	if ct := w.Header().Get("Content-Type"); ct != contentType {
+		t.Errorf("invalid content-type %s", ct)
+	}
+
+	actual, _ := io.ReadAll(w.Body)
+	expected := `# HELP switch_interface_errors_total The number of packets with errors on the interface.
+# TYPE switch_interface_errors_total counter
+switch_interface_errors_total{target="192.0.2.1",ifIndex="1",ifName="eth0",ifAlias="uplink \"a\"",direction="in"} 1
+# HELP switch_interface_octets_total The total number of octets on the interface.
+# TYPE switch_interface_octets_total counter
+switch_interface_octets_total{target="192.0.2.1",ifIndex="1",ifName="eth0",ifAlias="uplink \"a\"",direction="in"} 10
+switch_interface_octets_total{target="192.0.2.1",ifIndex="1",ifName="eth0",ifAlias="uplink \"a\"",direction="out"} 20
+switch_interface_octets_total{target="192.0.2.1",ifIndex="2",ifName="eth1",ifAlias="",direction="out"} 200
+switch_interface_octets_total{target="192.0.2.2",ifIndex="1",ifName="ge-0/0/0",ifAlias="",direction="in"} 30
+# HELP switch_custom_mib_value The value of custom MIB.
+# TYPE switch_custom_mib_value gauge
+switch_custom_mib_value{target="192.0.2.1",graph="zoo",metric="foobar",mib="1.2.34.56"} 1.5
+`
+	if diff := cmp.Diff(string(actual), expected); diff != "" {
+		t.Errorf("value is mismatch (-actual +expected):%s", diff)
+	}
+}
+
+func TestReload(t *testing.T) {
+	e := New(&config.Config{
+		Targets: []*config.Target{
+			{Target: "192.0.2.1"},
+			{Target: "192.0.2.2"},
+		},
+	})
+	e.Update("192.0.2.1", []collector.MetricsDutum{
+		{IfIndex: 1, Mib: "ifHCInOctets", IfName: "eth0", Value: 10},
+	})
+	e.Update("192.0.2.2", []collector.MetricsDutum{
+		{IfIndex: 1, Mib: "ifHCInOctets", IfName: "eth0", Value: 20},
+	})
+
+	e.Reload(&config.Config{
+		Targets: []*config.Target{
+			{Target: "192.0.2.1"},
+			{Target: "192.0.2.3"},
+		},
+	})
+
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := io.ReadAll(w.Result().Body)
+
+	expected := `# HELP switch_interface_octets_total The total number of octets on the interface.
+# TYPE switch_interface_octets_total counter
+switch_interface_octets_total{target="192.0.2.1",ifIndex="1",ifName="eth0",ifAlias="",direction="in"} 10
+`
+	if d := cmp.Diff(string(body), expected); d != "" {
+		t.Errorf("value is mismatch (-actual +expected):%s", d)
+	}
+}
+
+func TestUpdateFailed(t *testing.T) {
+	e := New(&config.Config{
+		Targets: []*config.Target{
+			{
+				Target:                        "192.0.2.1",
+				CustomMIBsGraphDefs:           []*mackerel.GraphDefsParam{{DisplayName: "zoo", Metrics: []*mackerel.GraphDefsMetric{{Name: "foo", DisplayName: "foobar"}}}},
+				CustomMIBmetricNameMappedMIBs: map[string]string{"foo": "1.2.34.56"},
+			},
+			{Target: "192.0.2.2"},
+		},
+	})
+	e.Update("192.0.2.1", []collector.MetricsDutum{
+		{IfIndex: 1, Mib: "ifHCInOctets", IfName: "eth0", Value: 10},
+	})
+	e.UpdateCustom("192.0.2.1", map[string]float64{"1.2.34.56": 1.5})
+	e.Update("192.0.2.2", []collector.MetricsDutum{
+		{IfIndex: 1, Mib: "ifHCInOctets", IfName: "eth0", Value: 20},
+	})
+
+	// the collection of 192.0.2.1 failed.
+	e.Update("192.0.2.1", nil)
+	e.UpdateCustom("192.0.2.1", nil)
+
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := io.ReadAll(w.Result().Body)
+
+	expected := `# HELP switch_interface_octets_total The total number of octets on the interface.
+# TYPE switch_interface_octets_total counter
+switch_interface_octets_total{target="192.0.2.2",ifIndex="1",ifName="eth0",ifAlias="",direction="in"} 20
+`
+	if d := cmp.Diff(string(body), expected); d != "" {
+		t.Errorf("value is mismatch (-actual +expected):%s", d)
+	}
+}
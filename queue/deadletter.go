@@ -0,0 +1,41 @@
+package queue
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/yseto/switch-traffic-to-mackerel/metric"
+)
+
+type deadLetter struct {
+	Time    time.Time        `json:"time"`
+	Error   string           `json:"error"`
+	Metrics []*metric.Metric `json:"metrics"`
+}
+
+// writeDeadLetter appends rejected values to the dead-letter file as a JSON line.
+func (q *Queue) writeDeadLetter(value []*metric.Metric, sendErr error) error {
+	if q.deadLetterFile == "" {
+		return nil
+	}
+
+	b, err := json.Marshal(deadLetter{
+		Time:    q.now(),
+		Error:   sendErr.Error(),
+		Metrics: value,
+	})
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(q.deadLetterFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(append(b, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
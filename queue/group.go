@@ -0,0 +1,50 @@
+package queue
+
+import (
+	"context"
+	"sync"
+
+	"github.com/yseto/switch-traffic-to-mackerel/metric"
+)
+
+// Group fans out values to queues, each with its own sender and retry state.
+type Group []*Queue
+
+func (g Group) Enqueue(rawMetrics []*metric.Metric) {
+	for _, q := range g {
+		q.Enqueue(rawMetrics)
+	}
+}
+
+// Run runs every queue, and blocks until ctx is done.
+func (g Group) Run(ctx context.Context) {
+	wg := &sync.WaitGroup{}
+	for _, q := range g {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			q.Run(ctx)
+		}()
+	}
+	wg.Wait()
+}
+
+// Flush flushes every queue concurrently, and returns the total.
+func (g Group) Flush(ctx context.Context) (flushed, abandoned int) {
+	var mu sync.Mutex
+	wg := &sync.WaitGroup{}
+	for _, q := range g {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			f, a := q.Flush(ctx)
+
+			mu.Lock()
+			flushed += f
+			abandoned += a
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	return flushed, abandoned
+}
@@ -1,39 +1,84 @@
 package queue
 
 import (
+	"cmp"
 	"container/list"
 	"context"
-	"fmt"
-	"log"
+	"errors"
+	"log/slog"
+	"math/rand/v2"
 	"sync"
+	"sync/atomic"
+	"time"
 
-	"github.com/mackerelio/mackerel-client-go"
+	"github.com/yseto/switch-traffic-to-mackerel/metric"
+)
+
+const (
+	minBackoff = 1 * time.Second
+	maxBackoff = 5 * time.Minute
+
+	// flushStep is the longest wait between retries in Flush, not to sleep
+	// through the grace period in backoff.
+	flushStep = 1 * time.Second
 )
 
 type SendInterface interface {
-	Send(context.Context, []*mackerel.MetricValue) error
+	Send(context.Context, []*metric.Metric) error
+}
+
+// retryableError is implemented by errors returned from SendInterface that know
+// whether resending the same values may succeed.
+type retryableError interface {
+	Retryable() bool
 }
 
+// acceptor is implemented by SendInterface choosing values to receive.
+// otherwise counters are not received.
+type acceptor interface {
+	Accept(*metric.Metric) bool
+}
+
+// Queue buffers values for one sender. it is safe for concurrent use.
 type Queue struct {
-	sync.Mutex
+	mu      sync.Mutex
 	buffers *list.List
+	notify  chan struct{}
+	result  sendResult
 
+	// sendMu serializes senders, and guards the retry state.
+	sendMu      sync.Mutex
+	retries     int
+	nextAttempt time.Time
+
+	name     string
 	sendFunc SendInterface
 
-	debug  bool
+	logger atomic.Pointer[slog.Logger]
 	dryrun bool
+
+	deadLetterFile string
+
+	now func() time.Time
 }
 
 type Arg struct {
+	// Name identifies the sender in logs.
+	Name     string
 	SendFunc SendInterface
 
-	Debug  bool
+	// Logger receives sent values at the debug level. slog.Default() when nil.
+	Logger *slog.Logger
 	DryRun bool
+
+	// DeadLetterFile receives values rejected permanently or abandoned on shutdown.
+	// they are dropped when empty.
+	DeadLetterFile string
 }
 
 type noopSendFunc struct{}
 
-func (noopSendFunc) Send(_ context.Context, _ []*mackerel.MetricValue) error {
+func (noopSendFunc) Send(_ context.Context, _ []*metric.Metric) error {
 	return nil
 }
 
@@ -41,44 +86,239 @@ func New(qa Arg) *Queue {
 	if qa.SendFunc == nil {
 		qa.SendFunc = &noopSendFunc{}
 	}
-	return &Queue{
+	q := &Queue{
 		buffers: list.New(),
+		notify:  make(chan struct{}, 1),
 
+		name:     qa.Name,
 		sendFunc: qa.SendFunc,
-		debug:    qa.Debug,
 		dryrun:   qa.DryRun,
+
+		deadLetterFile: qa.DeadLetterFile,
+		now:            time.Now,
 	}
+	q.SetLogger(qa.Logger)
+	return q
+}
+
+// SetLogger replaces the logger, such as on reload of the log config. slog.Default() when nil.
+func (q *Queue) SetLogger(logger *slog.Logger) {
+	q.logger.Store(cmp.Or(logger, slog.Default()).With("queue", q.name))
 }
 
-func (q *Queue) Tick(ctx context.Context) {
-	if q.buffers.Len() == 0 {
+func (q *Queue) Enqueue(rawMetrics []*metric.Metric) {
+	value := q.accept(rawMetrics)
+	if len(value) == 0 {
 		return
 	}
 
-	e := q.buffers.Front()
-	value := e.Value.([](*mackerel.MetricValue))
+	q.mu.Lock()
+	q.buffers.PushBack(value)
+	q.mu.Unlock()
+
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (q *Queue) accept(rawMetrics []*metric.Metric) []*metric.Metric {
+	a, ok := q.sendFunc.(acceptor)
+	value := make([]*metric.Metric, 0, len(rawMetrics))
+	for _, m := range rawMetrics {
+		if ok && !a.Accept(m) {
+			continue
+		}
+		if !ok && m.Kind == metric.KindCounter {
+			continue
+		}
+		value = append(value, m)
+	}
+	return value
+}
+
+// Len returns the number of pending batches.
+func (q *Queue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.buffers.Len()
+}
+
+func (q *Queue) front() *list.Element {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.buffers.Front()
+}
+
+func (q *Queue) remove(e *list.Element) {
+	q.mu.Lock()
+	q.buffers.Remove(e)
+	q.mu.Unlock()
+}
+
+// Run sends values as they are enqueued, until ctx is done.
+func (q *Queue) Run(ctx context.Context) {
+	for {
+		var retry <-chan time.Time
+		_, wait := q.drain(ctx)
+		t := time.NewTimer(wait)
+		if wait > 0 {
+			retry = t.C
+		}
+
+		select {
+		case <-q.notify:
+		case <-retry:
+		case <-ctx.Done():
+		}
+		t.Stop()
+
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// drain sends values until the queue is empty. it returns the number of
+// delivered values, and the time to wait for retry when values are left.
+func (q *Queue) drain(ctx context.Context) (int, time.Duration) {
+	var delivered int
+	for ctx.Err() == nil {
+		n, ok := q.send(ctx)
+		if !ok {
+			break
+		}
+		delivered += n
+	}
+
+	q.sendMu.Lock()
+	defer q.sendMu.Unlock()
+	if q.front() == nil {
+		return delivered, 0
+	}
+	// at least a moment, not to miss a retry which is already due.
+	return delivered, max(q.nextAttempt.Sub(q.now()), time.Millisecond)
+}
+
+// send tries the head of the queue. it returns the number of delivered values,
+// and whether the head was removed.
+func (q *Queue) send(ctx context.Context) (int, bool) {
+	q.sendMu.Lock()
+	defer q.sendMu.Unlock()
+
+	e := q.front()
+	if e == nil {
+		return 0, false
+	}
+	if q.now().Before(q.nextAttempt) {
+		return 0, false
+	}
+
+	value := e.Value.([]*metric.Metric)
+	delivered := len(value)
 
-	if q.debug {
+	if q.logger.Load().Enabled(ctx, slog.LevelDebug) {
 		for idx := range value {
-			fmt.Printf("%d\t%s\t%v\n", value[idx].Time, value[idx].Name, value[idx].Value)
+			q.logger.Load().DebugContext(ctx, "value", "phase", "send", "time", value[idx].Time.Unix(), "metric", value[idx].Path(), "value", value[idx].Value)
 		}
 	}
 
 	if !q.dryrun {
+		start := q.now()
 		err := q.sendFunc.Send(ctx, value)
+		q.recordSend(start, q.now().Sub(start), err)
+		if err != nil && isRetryable(err) {
+			q.retries++
+			wait := backoff(q.retries)
+			q.nextAttempt = q.now().Add(wait)
+			q.logger.Load().Warn("send failed", "phase", "send", "error", err, "retry", q.retries, "wait", wait)
+			return 0, false
+		}
 		if err != nil {
-			log.Println(err)
-			return
+			q.logger.Load().Error("rejected permanently", "phase", "send", "error", err, "dropped", len(value))
+			if err := q.writeDeadLetter(value, err); err != nil {
+				q.logger.Load().Error("dead-letter failed", "phase", "send", "error", err)
+			}
+			q.mu.Lock()
+			q.result.dropped += len(value)
+			q.mu.Unlock()
+			delivered = 0
 		}
 	}
 
-	q.Lock()
-	q.buffers.Remove(e)
-	q.Unlock()
+	q.retries = 0
+	q.nextAttempt = time.Time{}
+
+	q.remove(e)
+	return delivered, true
+}
+
+// Flush sends pending values until the queue is empty or ctx is done.
+// values left at that time are abandoned, and written to the dead-letter file.
+func (q *Queue) Flush(ctx context.Context) (flushed, abandoned int) {
+	for {
+		// attempt at once even in backoff, the backend may have recovered.
+		q.resetRetry()
+		n, wait := q.drain(ctx)
+		flushed += n
+		if q.Len() == 0 {
+			return flushed, 0
+		}
+
+		if wait > 0 {
+			t := time.NewTimer(min(wait, flushStep))
+			select {
+			case <-ctx.Done():
+			case <-t.C:
+			}
+			t.Stop()
+		}
+		if ctx.Err() != nil {
+			return flushed, q.abandon()
+		}
+	}
+}
+
+func (q *Queue) resetRetry() {
+	q.sendMu.Lock()
+	defer q.sendMu.Unlock()
+	q.retries = 0
+	q.nextAttempt = time.Time{}
+}
+
+var errAbandoned = errors.New("abandoned on shutdown")
+
+func (q *Queue) abandon() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var abandoned int
+	for e := q.buffers.Front(); e != nil; e = e.Next() {
+		value := e.Value.([]*metric.Metric)
+		abandoned += len(value)
+		if err := q.writeDeadLetter(value, errAbandoned); err != nil {
+			q.logger.Load().Error("dead-letter failed", "phase", "flush", "error", err)
+		}
+	}
+	q.buffers.Init()
+	q.result.dropped += abandoned
+	return abandoned
 }
 
-func (q *Queue) Enqueue(rawMetrics []*mackerel.MetricValue) {
-	q.Lock()
-	q.buffers.PushBack(rawMetrics)
-	q.Unlock()
+// errors not reporting Retryable are assumed to be transient.
+func isRetryable(err error) bool {
+	var r retryableError
+	if errors.As(err, &r) {
+		return r.Retryable()
+	}
+	return true
+}
+
+// backoff returns exponential backoff with jitter, between half and full of the step.
+func backoff(retries int) time.Duration {
+	d := maxBackoff
+	if retries < 32 {
+		d = min(minBackoff<<(retries-1), maxBackoff)
+	}
+	return d/2 + rand.N(d/2+1)
 }
@@ -1,12 +1,18 @@
 package queue
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/google/go-cmp/cmp"
-	"github.com/mackerelio/mackerel-client-go"
+	"github.com/yseto/switch-traffic-to-mackerel/metric"
 )
 
 func TestNew(t *testing.T) {
@@ -15,24 +21,33 @@ func TestNew(t *testing.T) {
 }
 
 type mockSendFunc struct {
+	sync.Mutex
 	count  int
-	values []*mackerel.MetricValue
+	values []*metric.Metric
 }
 
-func (m *mockSendFunc) Send(_ context.Context, v []*mackerel.MetricValue) error {
+func (m *mockSendFunc) Send(_ context.Context, v []*metric.Metric) error {
+	m.Lock()
+	defer m.Unlock()
 	m.count++
 	m.values = append(m.values, v...)
 	return nil
 }
 
-func TestTick(t *testing.T) {
+func (m *mockSendFunc) len() int {
+	m.Lock()
+	defer m.Unlock()
+	return len(m.values)
+}
+
+func TestSend(t *testing.T) {
 	t.Run("empty queue", func(t *testing.T) {
 		mock := &mockSendFunc{}
 		q := New(Arg{
 			SendFunc: mock,
 		})
 
-		q.Tick(context.TODO())
+		q.send(context.TODO())
 
 		if mock.count != 0 {
 			t.Error("invalid. called Send()")
@@ -40,20 +55,20 @@ func TestTick(t *testing.T) {
 	})
 
 	t.Run("exist queue", func(t *testing.T) {
-		tm := time.Now().Unix()
+		tm := time.Unix(time.Now().Unix(), 0)
 		mock := &mockSendFunc{}
 		q := New(Arg{
 			SendFunc: mock,
 		})
 
-		q.Enqueue([]*mackerel.MetricValue{
+		q.Enqueue([]*metric.Metric{
 			{
 				Name:  "name12345",
 				Time:  tm,
 				Value: 1.2345,
 			},
 		})
-		q.Enqueue([]*mackerel.MetricValue{
+		q.Enqueue([]*metric.Metric{
 			{
 				Name:  "name12345678",
 				Time:  tm,
@@ -61,10 +76,10 @@ func TestTick(t *testing.T) {
 			},
 		})
 
-		q.Tick(context.TODO())
+		q.send(context.TODO())
 
 		actual := mock.values
-		expected := []*mackerel.MetricValue{
+		expected := []*metric.Metric{
 			{
 				Name:  "name12345",
 				Time:  tm,
@@ -78,10 +93,10 @@ func TestTick(t *testing.T) {
 			t.Error("invalid. called Send()")
 		}
 
-		q.Tick(context.TODO())
+		q.send(context.TODO())
 
 		actual = mock.values
-		expected = append(expected, &mackerel.MetricValue{
+		expected = append(expected, &metric.Metric{
 			Name:  "name12345678",
 			Time:  tm,
 			Value: 1.2345678,
@@ -95,3 +110,354 @@ func TestTick(t *testing.T) {
 		}
 	})
 }
+
+type retryableErr bool
+
+func (e retryableErr) Error() string   { return "error" }
+func (e retryableErr) Retryable() bool { return bool(e) }
+
+type errorSendFunc struct {
+	count int
+	err   error
+}
+
+func (m *errorSendFunc) Send(_ context.Context, _ []*metric.Metric) error {
+	m.count++
+	return m.err
+}
+
+func TestSendError(t *testing.T) {
+	t.Run("retryable error", func(t *testing.T) {
+		mock := &errorSendFunc{err: retryableErr(true)}
+		q := New(Arg{
+			SendFunc: mock,
+		})
+		now := time.Now()
+		q.now = func() time.Time { return now }
+
+		q.Enqueue([]*metric.Metric{{Name: "name12345"}})
+
+		q.send(context.TODO())
+		if mock.count != 1 {
+			t.Error("invalid. called Send()")
+		}
+		if q.buffers.Len() != 1 {
+			t.Error("invalid. removed from queue")
+		}
+
+		// during backoff
+		q.send(context.TODO())
+		if mock.count != 1 {
+			t.Error("invalid. called Send() during backoff")
+		}
+
+		now = now.Add(maxBackoff)
+		mock.err = nil
+		q.send(context.TODO())
+		if mock.count != 2 {
+			t.Error("invalid. not called Send() after backoff")
+		}
+		if q.buffers.Len() != 0 || q.retries != 0 {
+			t.Error("invalid. queue is not drained")
+		}
+	})
+
+	t.Run("permanent error", func(t *testing.T) {
+		deadLetterFile := filepath.Join(t.TempDir(), "dead-letter.jsonl")
+		mock := &errorSendFunc{err: retryableErr(false)}
+		q := New(Arg{
+			SendFunc:       mock,
+			DeadLetterFile: deadLetterFile,
+		})
+
+		q.Enqueue([]*metric.Metric{{Name: "name12345", Value: 1.5}})
+		q.Enqueue([]*metric.Metric{{Name: "name12345678"}})
+
+		q.send(context.TODO())
+		if q.buffers.Len() != 1 {
+			t.Error("invalid. rejected values is not removed")
+		}
+		if q.Stats().Dropped != 1 {
+			t.Error("invalid. dropped values are not counted")
+		}
+
+		b, err := os.ReadFile(deadLetterFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var actual deadLetter
+		if err := json.Unmarshal(b, &actual); err != nil {
+			t.Fatal(err)
+		}
+		expected := []*metric.Metric{{Name: "name12345", Value: 1.5}}
+		if diff := cmp.Diff(actual.Metrics, expected); diff != "" {
+			t.Errorf("value is mismatch (-actual +expected):%s", diff)
+		}
+		if actual.Error != "error" {
+			t.Error("invalid error")
+		}
+	})
+}
+
+func TestBackoff(t *testing.T) {
+	for retries, expected := range []time.Duration{minBackoff, minBackoff * 2, minBackoff * 4} {
+		d := backoff(retries + 1)
+		if d < expected/2 || d > expected {
+			t.Errorf("invalid backoff %d: %s", retries+1, d)
+		}
+	}
+	if d := backoff(100); d > maxBackoff {
+		t.Errorf("invalid backoff: %s", d)
+	}
+}
+
+func TestFlush(t *testing.T) {
+	t.Run("drained", func(t *testing.T) {
+		mock := &mockSendFunc{}
+		q := New(Arg{
+			SendFunc: mock,
+		})
+		q.Enqueue([]*metric.Metric{{Name: "name12345"}, {Name: "name123456"}})
+		q.Enqueue([]*metric.Metric{{Name: "name12345678"}})
+
+		flushed, abandoned := q.Flush(context.TODO())
+		if flushed != 3 || abandoned != 0 {
+			t.Errorf("invalid flushed %d abandoned %d", flushed, abandoned)
+		}
+		if mock.count != 2 {
+			t.Error("invalid. called Send()")
+		}
+	})
+
+	t.Run("abandoned", func(t *testing.T) {
+		deadLetterFile := filepath.Join(t.TempDir(), "dead-letter.jsonl")
+		mock := &errorSendFunc{err: retryableErr(true)}
+		q := New(Arg{
+			SendFunc:       mock,
+			DeadLetterFile: deadLetterFile,
+		})
+		q.Enqueue([]*metric.Metric{{Name: "name12345"}, {Name: "name123456"}})
+		q.Enqueue([]*metric.Metric{{Name: "name12345678"}})
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		flushed, abandoned := q.Flush(ctx)
+		if flushed != 0 || abandoned != 3 {
+			t.Errorf("invalid flushed %d abandoned %d", flushed, abandoned)
+		}
+		if q.buffers.Len() != 0 {
+			t.Error("invalid. queue is not empty")
+		}
+
+		b, err := os.ReadFile(deadLetterFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if lines := bytes.Count(b, []byte("\n")); lines != 2 {
+			t.Errorf("invalid dead-letter lines %d", lines)
+		}
+	})
+
+	t.Run("in backoff", func(t *testing.T) {
+		mock := &recoverSendFunc{}
+		q := New(Arg{
+			SendFunc: mock,
+		})
+		q.Enqueue([]*metric.Metric{{Name: "name12345"}, {Name: "name123456"}})
+		q.send(context.TODO())
+		if q.nextAttempt.IsZero() {
+			t.Fatal("invalid. not in backoff")
+		}
+
+		// shorter than the backoff.
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		flushed, abandoned := q.Flush(ctx)
+		if flushed != 2 || abandoned != 0 {
+			t.Errorf("invalid flushed %d abandoned %d", flushed, abandoned)
+		}
+		if mock.count != 2 {
+			t.Errorf("invalid. called Send() %d", mock.count)
+		}
+	})
+}
+
+// recoverSendFunc fails once, and succeeds after that.
+type recoverSendFunc struct {
+	count int
+}
+
+func (m *recoverSendFunc) Send(_ context.Context, _ []*metric.Metric) error {
+	m.count++
+	if m.count == 1 {
+		return retryableErr(true)
+	}
+	return nil
+}
+
+func TestRun(t *testing.T) {
+	mock := &mockSendFunc{}
+	q := New(Arg{
+		SendFunc: mock,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		q.Run(ctx)
+		close(done)
+	}()
+
+	// multiple producers
+	wg := &sync.WaitGroup{}
+	for i := range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range 10 {
+				q.Enqueue([]*metric.Metric{{Name: fmt.Sprintf("name%d.%d", i, j)}})
+			}
+		}()
+	}
+	wg.Wait()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for mock.len() < 100 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	if n := mock.len(); n != 100 {
+		t.Errorf("invalid. sent %d values", n)
+	}
+	if q.Len() != 0 {
+		t.Error("invalid. queue is not empty")
+	}
+}
+
+func TestGroup(t *testing.T) {
+	mock1 := &mockSendFunc{}
+	mock2 := &errorSendFunc{err: retryableErr(true)}
+	g := Group{
+		New(Arg{SendFunc: mock1}),
+		New(Arg{SendFunc: mock2}),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		g.Run(ctx)
+		close(done)
+	}()
+
+	g.Enqueue([]*metric.Metric{{Name: "name12345"}})
+	g.Enqueue([]*metric.Metric{{Name: "name12345678"}})
+
+	deadline := time.Now().Add(5 * time.Second)
+	for mock1.len() < 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	// a failing sender does not block others.
+	if n := mock1.len(); n != 2 {
+		t.Errorf("invalid. sent %d values", n)
+	}
+	if g[0].Len() != 0 || g[1].Len() != 2 {
+		t.Error("invalid. queue length")
+	}
+
+	flushCtx, flushCancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer flushCancel()
+	flushed, abandoned := g.Flush(flushCtx)
+	if flushed != 0 || abandoned != 2 {
+		t.Errorf("invalid flushed %d abandoned %d", flushed, abandoned)
+	}
+}
+
+type acceptSendFunc struct {
+	mockSendFunc
+}
+
+func (m *acceptSendFunc) Accept(v *metric.Metric) bool {
+	return v.Kind == metric.KindCounter
+}
+
+func TestEnqueue(t *testing.T) {
+	values := []*metric.Metric{
+		{Name: "name12345", Kind: metric.KindGauge},
+		{Name: "name123456", Kind: metric.KindCounter},
+	}
+
+	t.Run("counters are skipped", func(t *testing.T) {
+		mock := &mockSendFunc{}
+		q := New(Arg{
+			SendFunc: mock,
+		})
+		q.Enqueue(values)
+		q.Enqueue(values[1:])
+		q.send(context.TODO())
+
+		if diff := cmp.Diff(mock.values, values[:1]); diff != "" {
+			t.Errorf("value is mismatch (-actual +expected):%s", diff)
+		}
+		if q.Len() != 0 {
+			t.Error("invalid. empty values are enqueued")
+		}
+	})
+
+	t.Run("accepted by sender", func(t *testing.T) {
+		mock := &acceptSendFunc{}
+		q := New(Arg{
+			SendFunc: mock,
+		})
+		q.Enqueue(values)
+		q.send(context.TODO())
+
+		if diff := cmp.Diff(mock.values, values[1:]); diff != "" {
+			t.Errorf("value is mismatch (-actual +expected):%s", diff)
+		}
+	})
+}
+
+func TestStats(t *testing.T) {
+	mock := &errorSendFunc{err: retryableErr(true)}
+	q := New(Arg{
+		Name:     "test",
+		SendFunc: mock,
+	})
+	now := time.Unix(1700000000, 0)
+	q.now = func() time.Time { return now }
+
+	q.Enqueue([]*metric.Metric{{Name: "a"}, {Name: "b"}})
+	q.Enqueue([]*metric.Metric{{Name: "c"}})
+	q.send(context.TODO())
+
+	expected := Stats{
+		Name:      "test",
+		Batches:   2,
+		Values:    3,
+		LastSend:  now,
+		LastError: mock.err.Error(),
+	}
+	if diff := cmp.Diff(q.Stats(), expected); diff != "" {
+		t.Errorf("value is mismatch (-actual +expected):%s", diff)
+	}
+
+	now = now.Add(maxBackoff)
+	mock.err = nil
+	q.send(context.TODO())
+
+	expected = Stats{
+		Name:        "test",
+		Batches:     1,
+		Values:      1,
+		LastSend:    now,
+		LastSuccess: now,
+	}
+	if diff := cmp.Diff(Group{q}.Stats(), []Stats{expected}); diff != "" {
+		t.Errorf("value is mismatch (-actual +expected):%s", diff)
+	}
+}
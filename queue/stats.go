@@ -0,0 +1,71 @@
+package queue
+
+import (
+	"time"
+
+	"github.com/yseto/switch-traffic-to-mackerel/metric"
+)
+
+// Stats is the state of a queue, for monitoring.
+type Stats struct {
+	Name string `json:"name"`
+	// pending batches and values.
+	Batches int `json:"batches"`
+	Values  int `json:"values"`
+
+	LastSend         time.Time     `json:"lastSend"`
+	LastSendDuration time.Duration `json:"lastSendDuration"`
+	LastError        string        `json:"lastError,omitempty"`
+	LastSuccess      time.Time     `json:"lastSuccess"`
+	// Dropped is the number of values rejected or abandoned, since start.
+	Dropped int `json:"dropped"`
+}
+
+// sendResult is the result of the last send, guarded by mu.
+type sendResult struct {
+	at       time.Time
+	duration time.Duration
+	err      error
+	success  time.Time
+	dropped  int
+}
+
+func (q *Queue) recordSend(at time.Time, duration time.Duration, err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.result.at = at
+	q.result.duration = duration
+	q.result.err = err
+	if err == nil {
+		q.result.success = at
+	}
+}
+
+func (q *Queue) Stats() Stats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	s := Stats{
+		Name:             q.name,
+		Batches:          q.buffers.Len(),
+		LastSend:         q.result.at,
+		LastSendDuration: q.result.duration,
+		LastSuccess:      q.result.success,
+		Dropped:          q.result.dropped,
+	}
+	for e := q.buffers.Front(); e != nil; e = e.Next() {
+		s.Values += len(e.Value.([]*metric.Metric))
+	}
+	if q.result.err != nil {
+		s.LastError = q.result.err.Error()
+	}
+	return s
+}
+
+func (g Group) Stats() []Stats {
+	stats := make([]Stats, 0, len(g))
+	for _, q := range g {
+		stats = append(stats, q.Stats())
+	}
+	return stats
+}
@@ -0,0 +1,21 @@
+package sink
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// StatusError is returned when the server responds with an error status.
+type StatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("send failed: status %d: %s", e.StatusCode, e.Body)
+}
+
+// Retryable reports true for 429 and 5xx responses.
+func (e *StatusError) Retryable() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+}
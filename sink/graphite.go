@@ -0,0 +1,66 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yseto/switch-traffic-to-mackerel/metric"
+)
+
+// Graphite writes values in plaintext protocol over TCP.
+type Graphite struct {
+	dialer  *net.Dialer
+	address string
+	prefix  string
+}
+
+func NewGraphite(address, prefix string) *Graphite {
+	return &Graphite{
+		dialer:  &net.Dialer{Timeout: 10 * time.Second},
+		address: address,
+		prefix:  prefix,
+	}
+}
+
+func (s *Graphite) Send(ctx context.Context, value []*metric.Metric) error {
+	var body bytes.Buffer
+	for _, m := range value {
+		body.WriteString(s.path(m))
+		body.WriteByte(' ')
+		body.WriteString(strconv.FormatFloat(m.Value, 'g', -1, 64))
+		body.WriteByte(' ')
+		body.WriteString(strconv.FormatInt(m.Time.Unix(), 10))
+		body.WriteByte('\n')
+	}
+
+	conn, err := s.dialer.DialContext(ctx, "tcp", s.address)
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetWriteDeadline(deadline) // nolint
+	}
+	if _, err = conn.Write(body.Bytes()); err != nil {
+		conn.Close()
+		return err
+	}
+	return conn.Close()
+}
+
+var graphiteNodeEscaper = strings.NewReplacer(".", "_", " ", "_", "/", "-")
+
+// path returns prefix.target.path, target is escaped into one node.
+func (s *Graphite) path(m *metric.Metric) string {
+	var nodes []string
+	if s.prefix != "" {
+		nodes = append(nodes, s.prefix)
+	}
+	if target := m.Labels["target"]; target != "" {
+		nodes = append(nodes, graphiteNodeEscaper.Replace(target))
+	}
+	return strings.Join(append(nodes, m.Path()), ".")
+}
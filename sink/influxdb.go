@@ -0,0 +1,95 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/exp/maps"
+
+	"github.com/yseto/switch-traffic-to-mackerel/metric"
+)
+
+// InfluxDB writes values in line protocol over HTTP.
+type InfluxDB struct {
+	client *http.Client
+	url    string
+	token  string
+}
+
+func NewInfluxDB(url, token string) *InfluxDB {
+	return &InfluxDB{
+		client: &http.Client{Timeout: 30 * time.Second},
+		url:    url,
+		token:  token,
+	}
+}
+
+func (s *InfluxDB) Send(ctx context.Context, value []*metric.Metric) error {
+	var body bytes.Buffer
+	for _, m := range value {
+		writeLine(&body, m)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if s.token != "" {
+		req.Header.Set("Authorization", "Token "+s.token)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return &StatusError{StatusCode: resp.StatusCode, Body: string(b)}
+	}
+	io.Copy(io.Discard, resp.Body) // nolint
+	return nil
+}
+
+var (
+	measurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `)
+	tagEscaper         = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+)
+
+// writeLine writes measurement,tags value=... timestamp(ns). kind is written as a tag,
+// and empty tags are omitted.
+func writeLine(w *bytes.Buffer, m *metric.Metric) {
+	w.WriteString(measurementEscaper.Replace(m.BaseName()))
+
+	tags := maps.Clone(m.Labels)
+	if tags == nil {
+		tags = make(map[string]string)
+	}
+	tags["kind"] = string(m.Kind)
+
+	keys := maps.Keys(tags)
+	slices.Sort(keys)
+	for _, k := range keys {
+		if tags[k] == "" {
+			continue
+		}
+		w.WriteByte(',')
+		w.WriteString(tagEscaper.Replace(k))
+		w.WriteByte('=')
+		w.WriteString(tagEscaper.Replace(tags[k]))
+	}
+
+	w.WriteString(" value=")
+	w.WriteString(strconv.FormatFloat(m.Value, 'g', -1, 64))
+	w.WriteByte(' ')
+	w.WriteString(strconv.FormatInt(m.Time.UnixNano(), 10))
+	w.WriteByte('\n')
+}
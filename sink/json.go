@@ -0,0 +1,45 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+
+	"github.com/yseto/switch-traffic-to-mackerel/metric"
+)
+
+// JSON writes values as newline-delimited JSON to the file, or stdout.
+type JSON struct {
+	path string
+}
+
+// NewJSON returns the sink writing to path. stdout when path is empty or "-".
+func NewJSON(path string) *JSON {
+	return &JSON{path: path}
+}
+
+func (s *JSON) Send(_ context.Context, value []*metric.Metric) error {
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body)
+	for _, m := range value {
+		if err := enc.Encode(m); err != nil {
+			return err
+		}
+	}
+
+	if s.path == "" || s.path == "-" {
+		_, err := os.Stdout.Write(body.Bytes())
+		return err
+	}
+
+	f, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(body.Bytes()); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,445 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/exp/maps"
+
+	"github.com/yseto/switch-traffic-to-mackerel/metric"
+)
+
+const (
+	OTLPEncodingProtobuf = "protobuf"
+	OTLPEncodingJSON     = "json"
+
+	otlpScopeName = "github.com/yseto/switch-traffic-to-mackerel"
+
+	// AGGREGATION_TEMPORALITY_CUMULATIVE
+	aggregationTemporalityCumulative = 2
+)
+
+type otlpCounter struct {
+	name      string
+	unit      string
+	direction string
+	// 64 bit counter is preferred over 32 bit one.
+	highCapacity bool
+}
+
+// counters of IF-MIB mapped to OpenTelemetry semantic conventions.
+var otlpCounters = map[string]otlpCounter{
+	"ifInOctets":    {name: "system.network.io", unit: "By", direction: "receive"},
+	"ifOutOctets":   {name: "system.network.io", unit: "By", direction: "transmit"},
+	"ifHCInOctets":  {name: "system.network.io", unit: "By", direction: "receive", highCapacity: true},
+	"ifHCOutOctets": {name: "system.network.io", unit: "By", direction: "transmit", highCapacity: true},
+	"ifInDiscards":  {name: "system.network.dropped", unit: "{packet}", direction: "receive"},
+	"ifOutDiscards": {name: "system.network.dropped", unit: "{packet}", direction: "transmit"},
+	"ifInErrors":    {name: "system.network.errors", unit: "{error}", direction: "receive"},
+	"ifOutErrors":   {name: "system.network.errors", unit: "{error}", direction: "transmit"},
+}
+
+// OTLP exports values by OTLP/HTTP. interface counters are cumulative sums,
+// and custom MIBs are gauges.
+type OTLP struct {
+	client   *http.Client
+	url      string
+	encoding string
+	headers  map[string]string
+	start    time.Time
+
+	mu sync.Mutex
+	// target:attributes
+	resources map[string]map[string]string
+}
+
+func NewOTLP(url, encoding string, headers map[string]string) *OTLP {
+	if encoding == "" {
+		encoding = OTLPEncodingProtobuf
+	}
+	return &OTLP{
+		client:    &http.Client{Timeout: 30 * time.Second},
+		url:       url,
+		encoding:  encoding,
+		headers:   headers,
+		start:     time.Now(),
+		resources: make(map[string]map[string]string),
+	}
+}
+
+// SetResources sets device metadata of targets as resource attributes, replacing all of them such as on reload.
+func (s *OTLP) SetResources(resources map[string]map[string]string) {
+	s.mu.Lock()
+	s.resources = resources
+	s.mu.Unlock()
+}
+
+func (s *OTLP) resource(target string) map[string]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if attributes, ok := s.resources[target]; ok {
+		return attributes
+	}
+	return map[string]string{"host.name": target}
+}
+
+// Accept receives interface counters and custom MIBs.
+func (s *OTLP) Accept(m *metric.Metric) bool {
+	switch m.Kind {
+	case metric.KindCounter:
+		_, ok := otlpCounters[counterMIB(m)]
+		return ok
+	case metric.KindGauge:
+		_, ok := m.Labels[metric.InstanceLabel]
+		return !ok
+	}
+	return false
+}
+
+func counterMIB(m *metric.Metric) string {
+	return strings.TrimPrefix(m.Name, "interface.*.")
+}
+
+func (s *OTLP) Send(ctx context.Context, value []*metric.Metric) error {
+	var body []byte
+	var contentType string
+	resourceMetrics := s.build(value)
+	switch s.encoding {
+	case OTLPEncodingJSON:
+		b, err := json.Marshal(otlpJSONRequest(resourceMetrics))
+		if err != nil {
+			return err
+		}
+		body, contentType = b, "application/json"
+	default:
+		body, contentType = otlpProtobufRequest(resourceMetrics), "application/x-protobuf"
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	for k, v := range s.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return &StatusError{StatusCode: resp.StatusCode, Body: string(b)}
+	}
+	io.Copy(io.Discard, resp.Body) // nolint
+	return nil
+}
+
+type otlpResourceMetrics struct {
+	attributes map[string]string
+	metrics    []*otlpMetric
+}
+
+type otlpMetric struct {
+	name   string
+	unit   string
+	sum    bool
+	points []*otlpPoint
+}
+
+type otlpPoint struct {
+	attributes map[string]string
+	start      time.Time
+	time       time.Time
+	isInt      bool
+	asInt      int64
+	asDouble   float64
+}
+
+type otlpSeries struct {
+	target    string
+	name      string
+	ifName    string
+	direction string
+}
+
+// build groups values by target, and maps them to OpenTelemetry metrics.
+func (s *OTLP) build(value []*metric.Metric) []*otlpResourceMetrics {
+	var targets []string
+	metrics := make(map[string][]*otlpMetric)
+	index := make(map[string]map[string]*otlpMetric)
+	counters := make(map[otlpSeries]*metric.Metric)
+
+	find := func(target, name, unit string, sum bool) *otlpMetric {
+		if _, ok := index[target]; !ok {
+			targets = append(targets, target)
+			index[target] = make(map[string]*otlpMetric)
+		}
+		if m, ok := index[target][name]; ok {
+			return m
+		}
+		m := &otlpMetric{name: name, unit: unit, sum: sum}
+		index[target][name] = m
+		metrics[target] = append(metrics[target], m)
+		return m
+	}
+
+	for _, v := range value {
+		target := v.Labels["target"]
+		switch v.Kind {
+		case metric.KindCounter:
+			c, ok := otlpCounters[counterMIB(v)]
+			if !ok {
+				continue
+			}
+			series := otlpSeries{target: target, name: c.name, ifName: v.Labels[metric.InstanceLabel], direction: c.direction}
+			if prev, exists := counters[series]; exists && otlpCounters[counterMIB(prev)].highCapacity {
+				continue
+			}
+			counters[series] = v
+			find(target, c.name, c.unit, true)
+		case metric.KindGauge:
+			m := find(target, v.Name, "", false)
+			m.points = append(m.points, &otlpPoint{
+				attributes: gaugeAttributes(v),
+				time:       v.Time,
+				asDouble:   v.Value,
+			})
+		}
+	}
+
+	keys := maps.Keys(counters)
+	slices.SortFunc(keys, func(a, b otlpSeries) int {
+		return strings.Compare(a.ifName+"\x00"+a.direction, b.ifName+"\x00"+b.direction)
+	})
+	for _, series := range keys {
+		v := counters[series]
+		m := index[series.target][series.name]
+		m.points = append(m.points, &otlpPoint{
+			attributes: map[string]string{
+				"network.interface.name": series.ifName,
+				"network.io.direction":   series.direction,
+			},
+			start: s.start,
+			time:  v.Time,
+			isInt: true,
+			asInt: int64(v.Value),
+		})
+	}
+
+	var resourceMetrics []*otlpResourceMetrics
+	for _, target := range targets {
+		resourceMetrics = append(resourceMetrics, &otlpResourceMetrics{
+			attributes: s.resource(target),
+			metrics:    metrics[target],
+		})
+	}
+	return resourceMetrics
+}
+
+// gaugeAttributes returns labels of the value, such as mib of custom MIBs and queue of self metrics.
+// the target is the resource.
+func gaugeAttributes(v *metric.Metric) map[string]string {
+	attributes := make(map[string]string, len(v.Labels))
+	for k, label := range v.Labels {
+		if k != "target" {
+			attributes[k] = label
+		}
+	}
+	return attributes
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := maps.Keys(m)
+	slices.Sort(keys)
+	return keys
+}
+
+func unixNano(t time.Time) uint64 {
+	if t.IsZero() {
+		return 0
+	}
+	return uint64(t.UnixNano())
+}
+
+// https://github.com/open-telemetry/opentelemetry-proto/blob/main/opentelemetry/proto/collector/metrics/v1/metrics_service.proto
+func otlpProtobufRequest(resourceMetrics []*otlpResourceMetrics) []byte {
+	attributes := func(e *protoEncoder, field int, kv map[string]string) {
+		for _, k := range sortedKeys(kv) {
+			e.message(field, func(e *protoEncoder) {
+				e.string(1, k)
+				e.message(2, func(e *protoEncoder) {
+					e.string(1, kv[k])
+				})
+			})
+		}
+	}
+	points := func(e *protoEncoder, field int, points []*otlpPoint) {
+		for _, p := range points {
+			e.message(field, func(e *protoEncoder) {
+				if start := unixNano(p.start); start != 0 {
+					e.fixed64(2, start)
+				}
+				e.fixed64(3, unixNano(p.time))
+				if p.isInt {
+					e.fixed64(6, uint64(p.asInt))
+				} else {
+					e.double(4, p.asDouble)
+				}
+				attributes(e, 7, p.attributes)
+			})
+		}
+	}
+
+	var e protoEncoder
+	for _, rm := range resourceMetrics {
+		e.message(1, func(e *protoEncoder) {
+			e.message(1, func(e *protoEncoder) {
+				attributes(e, 1, rm.attributes)
+			})
+			e.message(2, func(e *protoEncoder) {
+				e.message(1, func(e *protoEncoder) {
+					e.string(1, otlpScopeName)
+				})
+				for _, m := range rm.metrics {
+					e.message(2, func(e *protoEncoder) {
+						e.string(1, m.name)
+						e.string(3, m.unit)
+						if m.sum {
+							e.message(7, func(e *protoEncoder) {
+								points(e, 1, m.points)
+								e.enum(2, aggregationTemporalityCumulative)
+								e.bool(3, true)
+							})
+						} else {
+							e.message(5, func(e *protoEncoder) {
+								points(e, 1, m.points)
+							})
+						}
+					})
+				}
+			})
+		})
+	}
+	return e.buf
+}
+
+type otlpJSONKeyValue struct {
+	Key   string           `json:"key"`
+	Value otlpJSONAnyValue `json:"value"`
+}
+
+type otlpJSONAnyValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type otlpJSONPoint struct {
+	Attributes        []otlpJSONKeyValue `json:"attributes,omitempty"`
+	StartTimeUnixNano string             `json:"startTimeUnixNano,omitempty"`
+	TimeUnixNano      string             `json:"timeUnixNano"`
+	AsInt             string             `json:"asInt,omitempty"`
+	AsDouble          *float64           `json:"asDouble,omitempty"`
+}
+
+type otlpJSONSum struct {
+	DataPoints             []otlpJSONPoint `json:"dataPoints"`
+	AggregationTemporality int             `json:"aggregationTemporality"`
+	IsMonotonic            bool            `json:"isMonotonic"`
+}
+
+type otlpJSONGauge struct {
+	DataPoints []otlpJSONPoint `json:"dataPoints"`
+}
+
+type otlpJSONMetric struct {
+	Name  string         `json:"name"`
+	Unit  string         `json:"unit,omitempty"`
+	Sum   *otlpJSONSum   `json:"sum,omitempty"`
+	Gauge *otlpJSONGauge `json:"gauge,omitempty"`
+}
+
+type otlpJSONScope struct {
+	Name string `json:"name"`
+}
+
+type otlpJSONScopeMetrics struct {
+	Scope   otlpJSONScope    `json:"scope"`
+	Metrics []otlpJSONMetric `json:"metrics"`
+}
+
+type otlpJSONResource struct {
+	Attributes []otlpJSONKeyValue `json:"attributes"`
+}
+
+type otlpJSONResourceMetrics struct {
+	Resource     otlpJSONResource       `json:"resource"`
+	ScopeMetrics []otlpJSONScopeMetrics `json:"scopeMetrics"`
+}
+
+type otlpJSONExportRequest struct {
+	ResourceMetrics []otlpJSONResourceMetrics `json:"resourceMetrics"`
+}
+
+// OTLP/JSON, 64 bit integers are encoded as strings.
+func otlpJSONRequest(resourceMetrics []*otlpResourceMetrics) *otlpJSONExportRequest {
+	attributes := func(kv map[string]string) []otlpJSONKeyValue {
+		var result []otlpJSONKeyValue
+		for _, k := range sortedKeys(kv) {
+			result = append(result, otlpJSONKeyValue{Key: k, Value: otlpJSONAnyValue{StringValue: kv[k]}})
+		}
+		return result
+	}
+	points := func(points []*otlpPoint) []otlpJSONPoint {
+		var result []otlpJSONPoint
+		for _, p := range points {
+			point := otlpJSONPoint{
+				Attributes:   attributes(p.attributes),
+				TimeUnixNano: strconv.FormatUint(unixNano(p.time), 10),
+			}
+			if start := unixNano(p.start); start != 0 {
+				point.StartTimeUnixNano = strconv.FormatUint(start, 10)
+			}
+			if p.isInt {
+				point.AsInt = strconv.FormatInt(p.asInt, 10)
+			} else {
+				point.AsDouble = &p.asDouble
+			}
+			result = append(result, point)
+		}
+		return result
+	}
+
+	request := &otlpJSONExportRequest{}
+	for _, rm := range resourceMetrics {
+		scopeMetrics := otlpJSONScopeMetrics{Scope: otlpJSONScope{Name: otlpScopeName}}
+		for _, m := range rm.metrics {
+			jm := otlpJSONMetric{Name: m.name, Unit: m.unit}
+			if m.sum {
+				jm.Sum = &otlpJSONSum{
+					DataPoints:             points(m.points),
+					AggregationTemporality: aggregationTemporalityCumulative,
+					IsMonotonic:            true,
+				}
+			} else {
+				jm.Gauge = &otlpJSONGauge{DataPoints: points(m.points)}
+			}
+			scopeMetrics.Metrics = append(scopeMetrics.Metrics, jm)
+		}
+		request.ResourceMetrics = append(request.ResourceMetrics, otlpJSONResourceMetrics{
+			Resource:     otlpJSONResource{Attributes: attributes(rm.attributes)},
+			ScopeMetrics: []otlpJSONScopeMetrics{scopeMetrics},
+		})
+	}
+	return request
+}
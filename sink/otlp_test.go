@@ -0,0 +1,241 @@
+package sink
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/yseto/switch-traffic-to-mackerel/metric"
+)
+
+var otlpTestMetrics = []*metric.Metric{
+	{
+		Name:   "interface.*.ifInOctets",
+		Labels: map[string]string{"target": "192.0.2.1", "ifIndex": "1", "ifName": "eth0"},
+		Value:  5,
+		Time:   time.Unix(1700000000, 0),
+		Kind:   metric.KindCounter,
+	},
+	{
+		Name:   "interface.*.ifHCInOctets",
+		Labels: map[string]string{"target": "192.0.2.1", "ifIndex": "1", "ifName": "eth0"},
+		Value:  12345,
+		Time:   time.Unix(1700000000, 0),
+		Kind:   metric.KindCounter,
+	},
+	{
+		Name:   "interface.*.ifHCOutOctets",
+		Labels: map[string]string{"target": "192.0.2.1", "ifIndex": "1", "ifName": "eth0"},
+		Value:  67890,
+		Time:   time.Unix(1700000000, 0),
+		Kind:   metric.KindCounter,
+	},
+	{
+		Name:   "custom.custommibs.d41d8cd98f00b204e9800998ecf8427e.foo.bar",
+		Labels: map[string]string{"target": "192.0.2.1", "mib": "1.2.3.4"},
+		Value:  1.5,
+		Time:   time.Unix(1700000000, 0),
+		Kind:   metric.KindGauge,
+	},
+}
+
+func TestOTLPAccept(t *testing.T) {
+	s := NewOTLP("", "", nil)
+	for _, m := range otlpTestMetrics {
+		if !s.Accept(m) {
+			t.Errorf("invalid. not accepted %s", m.Name)
+		}
+	}
+	if s.Accept(&metric.Metric{
+		Name:   "interface.*.rxBytes.delta",
+		Labels: map[string]string{"ifName": "eth0"},
+		Kind:   metric.KindGauge,
+	}) {
+		t.Error("invalid. accepted rate")
+	}
+}
+
+type otlpReceiver struct {
+	contentType string
+	body        []byte
+}
+
+func (r *otlpReceiver) server() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		r.contentType = req.Header.Get("Content-Type")
+		r.body, _ = io.ReadAll(req.Body)
+	}))
+}
+
+func TestOTLPJSON(t *testing.T) {
+	r := &otlpReceiver{}
+	ts := r.server()
+	defer ts.Close()
+
+	s := NewOTLP(ts.URL+"/v1/metrics", OTLPEncodingJSON, nil)
+	s.start = time.Unix(1600000000, 0)
+	s.SetResources(map[string]map[string]string{
+		"192.0.2.1": {"host.name": "sw1", "sysName": "sw1", "sysObjectID": "1.3.6.1.4.1.9.1.1"},
+	})
+
+	if err := s.Send(context.Background(), otlpTestMetrics); err != nil {
+		t.Fatal(err)
+	}
+	if r.contentType != "application/json" {
+		t.Errorf("invalid content-type %s", r.contentType)
+	}
+
+	var actual, expected any
+	if err := json.Unmarshal(r.body, &actual); err != nil {
+		t.Fatal(err)
+	}
+	json.Unmarshal([]byte(`{"resourceMetrics":[{
+		"resource":{"attributes":[
+			{"key":"host.name","value":{"stringValue":"sw1"}},
+			{"key":"sysName","value":{"stringValue":"sw1"}},
+			{"key":"sysObjectID","value":{"stringValue":"1.3.6.1.4.1.9.1.1"}}
+		]},
+		"scopeMetrics":[{
+			"scope":{"name":"github.com/yseto/switch-traffic-to-mackerel"},
+			"metrics":[
+				{"name":"system.network.io","unit":"By","sum":{"aggregationTemporality":2,"isMonotonic":true,"dataPoints":[
+					{"attributes":[
+						{"key":"network.interface.name","value":{"stringValue":"eth0"}},
+						{"key":"network.io.direction","value":{"stringValue":"receive"}}
+					],"startTimeUnixNano":"1600000000000000000","timeUnixNano":"1700000000000000000","asInt":"12345"},
+					{"attributes":[
+						{"key":"network.interface.name","value":{"stringValue":"eth0"}},
+						{"key":"network.io.direction","value":{"stringValue":"transmit"}}
+					],"startTimeUnixNano":"1600000000000000000","timeUnixNano":"1700000000000000000","asInt":"67890"}
+				]}},
+				{"name":"custom.custommibs.d41d8cd98f00b204e9800998ecf8427e.foo.bar","gauge":{"dataPoints":[
+					{"attributes":[{"key":"mib","value":{"stringValue":"1.2.3.4"}}],"timeUnixNano":"1700000000000000000","asDouble":1.5}
+				]}}
+			]
+		}]
+	}]}`), &expected) // nolint
+
+	if diff := cmp.Diff(actual, expected); diff != "" {
+		t.Errorf("value is mismatch (-actual +expected):%s", diff)
+	}
+}
+
+// protoMessage decodes wire format to field number:values, enough for tests.
+func protoMessage(t *testing.T, b []byte) map[int][]any {
+	t.Helper()
+	fields := make(map[int][]any)
+	for len(b) > 0 {
+		tag, n := binary.Uvarint(b)
+		b = b[n:]
+		field, wireType := int(tag>>3), int(tag&7)
+		switch wireType {
+		case wireVarint:
+			v, n := binary.Uvarint(b)
+			b = b[n:]
+			fields[field] = append(fields[field], v)
+		case wireFixed64:
+			fields[field] = append(fields[field], binary.LittleEndian.Uint64(b))
+			b = b[8:]
+		case wireBytes:
+			l, n := binary.Uvarint(b)
+			b = b[n:]
+			fields[field] = append(fields[field], b[:l])
+			b = b[l:]
+		default:
+			t.Fatalf("invalid wire type %d", wireType)
+		}
+	}
+	return fields
+}
+
+func TestOTLPGaugeAttributes(t *testing.T) {
+	s := NewOTLP("", "", nil)
+	value := []*metric.Metric{
+		{
+			Name:   "custom.stm.snmp_rtt.average",
+			Labels: map[string]string{"target": "192.0.2.1"},
+			Kind:   metric.KindGauge,
+		},
+		{
+			Name:   "custom.stm.queue_length.json",
+			Labels: map[string]string{"target": "192.0.2.1", "queue": "json"},
+			Kind:   metric.KindGauge,
+		},
+	}
+	for _, m := range value {
+		if !s.Accept(m) {
+			t.Errorf("invalid. not accepted %s", m.Name)
+		}
+	}
+
+	var actual []map[string]string
+	for _, m := range s.build(value)[0].metrics {
+		actual = append(actual, m.points[0].attributes)
+	}
+	expected := []map[string]string{{}, {"queue": "json"}}
+	if diff := cmp.Diff(actual, expected); diff != "" {
+		t.Errorf("value is mismatch (-actual +expected):%s", diff)
+	}
+}
+
+func TestOTLPProtobuf(t *testing.T) {
+	r := &otlpReceiver{}
+	ts := r.server()
+	defer ts.Close()
+
+	s := NewOTLP(ts.URL+"/v1/metrics", "", map[string]string{"Authorization": "Bearer secret"})
+	if err := s.Send(context.Background(), otlpTestMetrics); err != nil {
+		t.Fatal(err)
+	}
+	if r.contentType != "application/x-protobuf" {
+		t.Errorf("invalid content-type %s", r.contentType)
+	}
+
+	request := protoMessage(t, r.body)
+	resourceMetrics := protoMessage(t, request[1][0].([]byte))
+
+	resource := protoMessage(t, resourceMetrics[1][0].([]byte))
+	attribute := protoMessage(t, resource[1][0].([]byte))
+	if string(attribute[1][0].([]byte)) != "host.name" {
+		t.Error("invalid resource attribute")
+	}
+	if v := protoMessage(t, attribute[2][0].([]byte)); string(v[1][0].([]byte)) != "192.0.2.1" {
+		t.Error("invalid resource attribute value")
+	}
+
+	scopeMetrics := protoMessage(t, resourceMetrics[2][0].([]byte))
+	if len(scopeMetrics[2]) != 2 {
+		t.Fatalf("invalid metrics %d", len(scopeMetrics[2]))
+	}
+
+	sumMetric := protoMessage(t, scopeMetrics[2][0].([]byte))
+	if string(sumMetric[1][0].([]byte)) != "system.network.io" || string(sumMetric[3][0].([]byte)) != "By" {
+		t.Error("invalid sum metric")
+	}
+	sum := protoMessage(t, sumMetric[7][0].([]byte))
+	if sum[2][0].(uint64) != aggregationTemporalityCumulative || sum[3][0].(uint64) != 1 {
+		t.Error("invalid sum")
+	}
+	if len(sum[1]) != 2 {
+		t.Fatalf("invalid data points %d", len(sum[1]))
+	}
+	point := protoMessage(t, sum[1][0].([]byte))
+	if point[3][0].(uint64) != uint64(time.Unix(1700000000, 0).UnixNano()) || point[6][0].(uint64) != 12345 {
+		t.Error("invalid sum data point")
+	}
+
+	gaugeMetric := protoMessage(t, scopeMetrics[2][1].([]byte))
+	gauge := protoMessage(t, gaugeMetric[5][0].([]byte))
+	point = protoMessage(t, gauge[1][0].([]byte))
+	if math.Float64frombits(point[4][0].(uint64)) != 1.5 {
+		t.Error("invalid gauge data point")
+	}
+}
@@ -0,0 +1,67 @@
+package sink
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+)
+
+// protoEncoder writes protocol buffers wire format, enough for OTLP.
+type protoEncoder struct {
+	buf []byte
+}
+
+func (e *protoEncoder) tag(field, wireType int) {
+	e.varint(uint64(field<<3 | wireType))
+}
+
+func (e *protoEncoder) varint(v uint64) {
+	e.buf = binary.AppendUvarint(e.buf, v)
+}
+
+func (e *protoEncoder) string(field int, s string) {
+	if s == "" {
+		return
+	}
+	e.tag(field, wireBytes)
+	e.varint(uint64(len(s)))
+	e.buf = append(e.buf, s...)
+}
+
+func (e *protoEncoder) bool(field int, v bool) {
+	if !v {
+		return
+	}
+	e.tag(field, wireVarint)
+	e.varint(1)
+}
+
+func (e *protoEncoder) enum(field int, v int) {
+	if v == 0 {
+		return
+	}
+	e.tag(field, wireVarint)
+	e.varint(uint64(v))
+}
+
+func (e *protoEncoder) fixed64(field int, v uint64) {
+	e.tag(field, wireFixed64)
+	e.buf = binary.LittleEndian.AppendUint64(e.buf, v)
+}
+
+func (e *protoEncoder) double(field int, v float64) {
+	e.fixed64(field, math.Float64bits(v))
+}
+
+func (e *protoEncoder) message(field int, fn func(*protoEncoder)) {
+	var sub protoEncoder
+	fn(&sub)
+	e.tag(field, wireBytes)
+	e.varint(uint64(len(sub.buf)))
+	e.buf = append(e.buf, sub.buf...)
+}
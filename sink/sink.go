@@ -0,0 +1,27 @@
+package sink
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/yseto/switch-traffic-to-mackerel/config"
+	"github.com/yseto/switch-traffic-to-mackerel/metric"
+)
+
+type Sink interface {
+	Send(context.Context, []*metric.Metric) error
+}
+
+func New(c *config.Sink) (Sink, error) {
+	switch c.Type {
+	case config.SinkInfluxDB:
+		return NewInfluxDB(c.URL, c.Token), nil
+	case config.SinkGraphite:
+		return NewGraphite(c.Address, c.Prefix), nil
+	case config.SinkJSON:
+		return NewJSON(c.Path), nil
+	case config.SinkOTLP:
+		return NewOTLP(c.URL, c.Encoding, c.Headers), nil
+	}
+	return nil, fmt.Errorf("sink %s is not supported", c.Type)
+}
@@ -0,0 +1,164 @@
+package sink
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/yseto/switch-traffic-to-mackerel/config"
+	"github.com/yseto/switch-traffic-to-mackerel/metric"
+)
+
+var testMetrics = []*metric.Metric{
+	{
+		Name: "interface.*.rxBytes.delta",
+		Labels: map[string]string{
+			"target":  "192.0.2.1",
+			"ifIndex": "1",
+			"ifName":  "ge-0/0/1",
+			"ifAlias": "to core, 1",
+		},
+		Value: 1.5,
+		Time:  time.Unix(1700000000, 0),
+		Kind:  metric.KindGauge,
+	},
+	{
+		Name:   "custom.custommibs.d41d8cd98f00b204e9800998ecf8427e.foo.bar",
+		Labels: map[string]string{"target": "192.0.2.1", "mib": "1.2.3.4"},
+		Value:  10,
+		Time:   time.Unix(1700000000, 0),
+		Kind:   metric.KindGauge,
+	},
+}
+
+func TestNew(t *testing.T) {
+	for _, typ := range []string{config.SinkInfluxDB, config.SinkGraphite, config.SinkJSON, config.SinkOTLP} {
+		if _, err := New(&config.Sink{Type: typ}); err != nil {
+			t.Error(err)
+		}
+	}
+	if _, err := New(&config.Sink{Type: "unknown"}); err == nil {
+		t.Error("invalid. not raised error")
+	}
+}
+
+func TestInfluxDB(t *testing.T) {
+	var body []byte
+	var header http.Header
+	status := http.StatusNoContent
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		header = r.Header
+		w.WriteHeader(status)
+		io.WriteString(w, `{"message":"error"}`) // nolint
+	}))
+	defer ts.Close()
+
+	s := NewInfluxDB(ts.URL+"/api/v2/write?bucket=switch", "secret")
+	if err := s.Send(context.Background(), testMetrics); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `interface.rxBytes.delta,ifAlias=to\ core\,\ 1,ifIndex=1,ifName=ge-0/0/1,kind=gauge,target=192.0.2.1 value=1.5 1700000000000000000
+custom.custommibs.d41d8cd98f00b204e9800998ecf8427e.foo.bar,kind=gauge,mib=1.2.3.4,target=192.0.2.1 value=10 1700000000000000000
+`
+	if diff := cmp.Diff(string(body), expected); diff != "" {
+		t.Errorf("value is mismatch (-actual +expected):%s", diff)
+	}
+	if header.Get("Authorization") != "Token secret" {
+		t.Error("invalid authorization")
+	}
+
+	for code, retryable := range map[int]bool{400: false, 429: true, 503: true} {
+		status = code
+		var statusErr *StatusError
+		if err := s.Send(context.Background(), testMetrics); !errors.As(err, &statusErr) {
+			t.Fatalf("invalid error %v", err)
+		}
+		if statusErr.Retryable() != retryable {
+			t.Errorf("invalid retryable %d", code)
+		}
+		if statusErr.Body != `{"message":"error"}` {
+			t.Error("invalid body")
+		}
+	}
+}
+
+func TestGraphite(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	received := make(chan []string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		var lines []string
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			lines = append(lines, scanner.Text())
+		}
+		received <- lines
+	}()
+
+	s := NewGraphite(ln.Addr().String(), "switch")
+	if err := s.Send(context.Background(), testMetrics); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"switch.192_0_2_1.interface.ge-0-0-1.rxBytes.delta 1.5 1700000000",
+		"switch.192_0_2_1.custom.custommibs.d41d8cd98f00b204e9800998ecf8427e.foo.bar 10 1700000000",
+	}
+	if diff := cmp.Diff(<-received, expected); diff != "" {
+		t.Errorf("value is mismatch (-actual +expected):%s", diff)
+	}
+}
+
+func TestJSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.jsonl")
+	s := NewJSON(path)
+	for range 2 {
+		if err := s.Send(context.Background(), testMetrics[:1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	dec := json.NewDecoder(f)
+	var count int
+	for dec.More() {
+		var actual metric.Metric
+		if err := dec.Decode(&actual); err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(&actual, testMetrics[0]); diff != "" {
+			t.Errorf("value is mismatch (-actual +expected):%s", diff)
+		}
+		count++
+	}
+	if count != 2 {
+		t.Errorf("invalid lines %d", count)
+	}
+}
@@ -0,0 +1,160 @@
+package snmp
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/gosnmp/gosnmp"
+	"golang.org/x/exp/maps"
+)
+
+const (
+	// maxRepetitions is max-repetitions of GETBULK for a column, same as BulkWalk of gosnmp.
+	maxRepetitions = 50
+	// maxBulkVarbinds limits varbinds in a GETBULK response, shared by the columns walked together.
+	maxBulkVarbinds = 200
+)
+
+var errEmptyResponse = errors.New("empty response")
+
+// BulkWalkColumns walks columns of a table together, a GETBULK request asks rows of all of them.
+// columns the device does not have are empty. oid:index:value
+func (s *SNMP) BulkWalkColumns(oids []string, length uint64) (map[string]map[uint64]uint64, error) {
+	kv := make(map[string]map[uint64]uint64, len(oids))
+	for _, oid := range oids {
+		kv[oid] = make(map[uint64]uint64, length)
+	}
+	columns := maps.Keys(kv)
+	slices.Sort(columns)
+	for start := 0; start < len(columns); start += gosnmp.MaxOids {
+		if err := s.bulkWalkColumns(columns[start:min(start+gosnmp.MaxOids, len(columns))], kv); err != nil {
+			return nil, err
+		}
+	}
+	return kv, nil
+}
+
+func (s *SNMP) bulkWalkColumns(columns []string, kv map[string]map[uint64]uint64) error {
+	// next is the last oid of each column, the request continues from it.
+	next := make(map[string]string, len(columns))
+	last := make(map[string]uint64, len(columns))
+	for _, column := range columns {
+		next[column] = column
+	}
+
+	walking := slices.Clone(columns)
+	for len(walking) > 0 {
+		oids := make([]string, len(walking))
+		for i, column := range walking {
+			oids[i] = next[column]
+		}
+		repetitions := min(max(maxBulkVarbinds/len(walking), 1), maxRepetitions)
+		result, err := s.handler.GetBulk(oids, 0, uint32(repetitions))
+		if err != nil {
+			return err
+		}
+		if result.Error != gosnmp.NoError {
+			return fmt.Errorf("getbulk: %s", result.Error)
+		}
+		if len(result.Variables) == 0 {
+			return errEmptyResponse
+		}
+
+		// variables are rows of the requested columns, in the order of the request.
+		done := make(map[string]bool, len(walking))
+		for i, pdu := range result.Variables {
+			column := walking[i%len(walking)]
+			if done[column] {
+				continue
+			}
+			name := strings.TrimPrefix(pdu.Name, ".")
+			if !strings.HasPrefix(name, column+".") {
+				done[column] = true
+				continue
+			}
+			index, err := captureIfIndex(name)
+			if err != nil {
+				return err
+			}
+			// the agent must return increasing oids, stop the column not to loop.
+			if prev, ok := last[column]; ok && index <= prev {
+				done[column] = true
+				continue
+			}
+			switch pdu.Type {
+			case gosnmp.OctetString:
+				return errParseError
+			case gosnmp.NoSuchObject, gosnmp.NoSuchInstance, gosnmp.EndOfMibView, gosnmp.Null:
+				done[column] = true
+				continue
+			default:
+				kv[column][index] = gosnmp.ToBigInt(pdu.Value).Uint64()
+			}
+			next[column], last[column] = name, index
+		}
+		walking = slices.DeleteFunc(walking, func(column string) bool {
+			return done[column]
+		})
+	}
+	return nil
+}
+
+// GetColumns gets values of the instances, ifIndexes by column, with GET requests of MaxOids instances.
+// the requests are halved while the device answers tooBig.
+// instances the device does not have are omitted. oid:index:value
+func (s *SNMP) GetColumns(instances map[string][]uint64) (map[string]map[uint64]uint64, error) {
+	type instance struct {
+		column string
+		index  uint64
+	}
+	kv := make(map[string]map[uint64]uint64, len(instances))
+	var requests []instance
+	columns := maps.Keys(instances)
+	slices.Sort(columns)
+	for _, column := range columns {
+		kv[column] = make(map[uint64]uint64, len(instances[column]))
+		indexes := slices.Clone(instances[column])
+		slices.Sort(indexes)
+		for _, index := range slices.Compact(indexes) {
+			requests = append(requests, instance{column: column, index: index})
+		}
+	}
+
+	size := gosnmp.MaxOids
+	for start := 0; start < len(requests); {
+		batch := requests[start:min(start+size, len(requests))]
+		oids := make([]string, len(batch))
+		for i, r := range batch {
+			oids[i] = fmt.Sprintf("%s.%d", r.column, r.index)
+		}
+		result, err := s.handler.Get(oids)
+		if err != nil {
+			return nil, err
+		}
+		// the response exceeds the max message size of the device, the batch is sent again.
+		if result.Error == gosnmp.TooBig && size > 1 {
+			size /= 2
+			continue
+		}
+		if result.Error != gosnmp.NoError {
+			return nil, fmt.Errorf("get: %s", result.Error)
+		}
+		for i, pdu := range result.Variables {
+			if i >= len(batch) {
+				break
+			}
+			switch pdu.Type {
+			case gosnmp.OctetString:
+				return nil, errParseError
+			case gosnmp.NoSuchObject, gosnmp.NoSuchInstance, gosnmp.EndOfMibView, gosnmp.Null:
+				continue
+			default:
+				kv[batch[i].column][batch[i].index] = gosnmp.ToBigInt(pdu.Value).Uint64()
+			}
+		}
+		start += len(batch)
+	}
+	return kv, nil
+}
@@ -0,0 +1,173 @@
+package snmp
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/gosnmp/gosnmp"
+)
+
+// agentHandler answers GET and GETBULK from the variables, as an agent does.
+type agentHandler struct {
+	mockHandler
+	// variables are sorted by oid.
+	variables []gosnmp.SnmpPDU
+	requests  int
+	// maxOids answers tooBig to more oids in a GET, as a small max message size.
+	maxOids int
+}
+
+func (a *agentHandler) Get(oids []string) (*gosnmp.SnmpPacket, error) {
+	a.requests++
+	result := &gosnmp.SnmpPacket{}
+	if a.maxOids > 0 && len(oids) > a.maxOids {
+		result.Error = gosnmp.TooBig
+		return result, nil
+	}
+	for _, oid := range oids {
+		i := slices.IndexFunc(a.variables, func(pdu gosnmp.SnmpPDU) bool {
+			return pdu.Name == "."+oid
+		})
+		if i < 0 {
+			result.Variables = append(result.Variables, gosnmp.SnmpPDU{Name: "." + oid, Type: gosnmp.NoSuchInstance})
+			continue
+		}
+		result.Variables = append(result.Variables, a.variables[i])
+	}
+	return result, nil
+}
+
+func (a *agentHandler) GetBulk(oids []string, nonRepeaters uint8, maxRepetitions uint32) (*gosnmp.SnmpPacket, error) {
+	a.requests++
+	result := &gosnmp.SnmpPacket{}
+	next := slices.Clone(oids)
+	for range maxRepetitions {
+		for i, oid := range next {
+			j := slices.IndexFunc(a.variables, func(pdu gosnmp.SnmpPDU) bool {
+				return compareOID(pdu.Name, oid) > 0
+			})
+			if j < 0 {
+				result.Variables = append(result.Variables, gosnmp.SnmpPDU{Name: "." + oid, Type: gosnmp.EndOfMibView})
+				continue
+			}
+			result.Variables = append(result.Variables, a.variables[j])
+			next[i] = a.variables[j].Name
+		}
+	}
+	return result, nil
+}
+
+func compareOID(a, b string) int {
+	parse := func(oid string) []uint64 {
+		var sub []uint64
+		for _, s := range strings.Split(strings.TrimPrefix(oid, "."), ".") {
+			n, _ := strconv.ParseUint(s, 10, 64)
+			sub = append(sub, n)
+		}
+		return sub
+	}
+	return slices.Compare(parse(a), parse(b))
+}
+
+func counters(column string, rows uint64) []gosnmp.SnmpPDU {
+	var pdus []gosnmp.SnmpPDU
+	for i := uint64(1); i <= rows; i++ {
+		pdus = append(pdus, gosnmp.SnmpPDU{Name: fmt.Sprintf(".%s.%d", column, i), Type: gosnmp.Counter64, Value: i * 10})
+	}
+	return pdus
+}
+
+const (
+	hcInOctets  = "1.3.6.1.2.1.31.1.1.1.6"
+	hcOutOctets = "1.3.6.1.2.1.31.1.1.1.10"
+)
+
+func TestBulkWalkColumns(t *testing.T) {
+	var variables []gosnmp.SnmpPDU
+	variables = append(variables, counters(hcInOctets, 120)...)
+	variables = append(variables, counters(hcOutOctets, 120)...)
+	variables = append(variables, gosnmp.SnmpPDU{Name: "." + MIBifAlias + ".1", Type: gosnmp.OctetString, Value: []byte("uplink")})
+	a := &agentHandler{variables: variables}
+	s := &SNMP{handler: a}
+
+	actual, err := s.BulkWalkColumns([]string{hcInOctets, hcOutOctets, MIBifHighSpeed}, 120)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]map[uint64]uint64{
+		hcInOctets:     {},
+		hcOutOctets:    {},
+		MIBifHighSpeed: {},
+	}
+	for i := uint64(1); i <= 120; i++ {
+		expected[hcInOctets][i] = i * 10
+		expected[hcOutOctets][i] = i * 10
+	}
+	if diff := cmp.Diff(actual, expected); diff != "" {
+		t.Errorf("value is mismatch (-actual +expected):%s", diff)
+	}
+	// 50 rows of the columns in a request.
+	if a.requests != 3 {
+		t.Errorf("invalid result %d", a.requests)
+	}
+}
+
+func TestGetColumns(t *testing.T) {
+	a := &agentHandler{variables: counters(hcInOctets, 120)}
+	s := &SNMP{handler: a}
+
+	var indexes []uint64
+	for i := uint64(120); i > 20; i-- {
+		indexes = append(indexes, i)
+	}
+	actual, err := s.GetColumns(map[string][]uint64{
+		hcInOctets:  append(indexes, 200, 120),
+		hcOutOctets: {1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]map[uint64]uint64{
+		hcInOctets:  {},
+		hcOutOctets: {},
+	}
+	for _, i := range indexes {
+		expected[hcInOctets][i] = i * 10
+	}
+	if diff := cmp.Diff(actual, expected); diff != "" {
+		t.Errorf("value is mismatch (-actual +expected):%s", diff)
+	}
+	// 102 instances, by 60.
+	if a.requests != 2 {
+		t.Errorf("invalid result %d", a.requests)
+	}
+}
+
+func TestGetColumnsTooBig(t *testing.T) {
+	a := &agentHandler{variables: counters(hcInOctets, 120), maxOids: 20}
+	s := &SNMP{handler: a}
+
+	var indexes []uint64
+	for i := uint64(1); i <= 100; i++ {
+		indexes = append(indexes, i)
+	}
+	actual, err := s.GetColumns(map[string][]uint64{hcInOctets: indexes})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]map[uint64]uint64{hcInOctets: {}}
+	for _, i := range indexes {
+		expected[hcInOctets][i] = i * 10
+	}
+	if diff := cmp.Diff(actual, expected); diff != "" {
+		t.Errorf("value is mismatch (-actual +expected):%s", diff)
+	}
+	// tooBig by 60 and 30, then 100 instances by 15.
+	if a.requests != 9 {
+		t.Errorf("invalid result %d", a.requests)
+	}
+}
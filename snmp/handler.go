@@ -1,6 +1,7 @@
 package snmp
 
 import (
+	"cmp"
 	"context"
 	"time"
 
@@ -10,6 +11,7 @@ import (
 type Handler interface {
 	Get(oids []string) (result *gosnmp.SnmpPacket, err error)
 	BulkWalk(rootOid string, walkFn gosnmp.WalkFunc) error
+	GetBulk(oids []string, nonRepeaters uint8, maxRepetitions uint32) (result *gosnmp.SnmpPacket, err error)
 
 	Connect() error
 	Close() error
@@ -17,23 +19,75 @@ type Handler interface {
 
 type snmpHandler struct {
 	gosnmp.GoSNMP
+	stats *Stats
 }
 
-func NewHandler(ctx context.Context, target, community string) Handler {
-	return &snmpHandler{
-		gosnmp.GoSNMP{
+// Arg is the agent to connect. Host is resolved on Connect.
+type Arg struct {
+	Host      string
+	Port      uint16
+	Transport string
+	Community string
+}
+
+func NewHandler(ctx context.Context, a *Arg) Handler {
+	h := &snmpHandler{
+		GoSNMP: gosnmp.GoSNMP{
 			Context:            ctx,
-			Target:             target,
-			Port:               161,
-			Transport:          "udp",
-			Community:          community,
+			Target:             a.Host,
+			Port:               cmp.Or(a.Port, 161),
+			Transport:          cmp.Or(a.Transport, "udp"),
+			Community:          a.Community,
 			Version:            gosnmp.Version2c,
 			Timeout:            time.Duration(10) * time.Second,
 			Retries:            3,
 			ExponentialTimeout: true,
 			MaxOids:            gosnmp.MaxOids,
 		},
+		stats: statsFrom(ctx),
+	}
+	if h.stats != nil {
+		h.PreSend = func(*gosnmp.GoSNMP) { h.stats.presend() }
+		h.OnRecv = func(*gosnmp.GoSNMP) { h.stats.received() }
+		h.OnRetry = func(*gosnmp.GoSNMP) { h.stats.retried() }
+	}
+	return h
+}
+
+func (x *snmpHandler) Get(oids []string) (*gosnmp.SnmpPacket, error) {
+	result, err := x.GoSNMP.Get(oids)
+	if x.stats != nil {
+		var varbinds int
+		if result != nil {
+			varbinds = len(result.Variables)
+		}
+		x.stats.finished(varbinds, err)
+	}
+	return result, err
+}
+
+func (x *snmpHandler) GetBulk(oids []string, nonRepeaters uint8, maxRepetitions uint32) (*gosnmp.SnmpPacket, error) {
+	result, err := x.GoSNMP.GetBulk(oids, nonRepeaters, maxRepetitions)
+	if x.stats != nil {
+		var varbinds int
+		if result != nil {
+			varbinds = len(result.Variables)
+		}
+		x.stats.finished(varbinds, err)
+	}
+	return result, err
+}
+
+func (x *snmpHandler) BulkWalk(rootOid string, walkFn gosnmp.WalkFunc) error {
+	var varbinds int
+	err := x.GoSNMP.BulkWalk(rootOid, func(pdu gosnmp.SnmpPDU) error {
+		varbinds++
+		return walkFn(pdu)
+	})
+	if x.stats != nil {
+		x.stats.finished(varbinds, err)
 	}
+	return err
 }
 
 func (x *snmpHandler) Close() error {
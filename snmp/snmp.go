@@ -12,19 +12,39 @@ import (
 )
 
 const (
+	MIBsysDescr       = "1.3.6.1.2.1.1.1.0"
+	MIBsysObjectID    = "1.3.6.1.2.1.1.2.0"
+	MIBsysUpTime      = "1.3.6.1.2.1.1.3.0"
+	MIBsysContact     = "1.3.6.1.2.1.1.4.0"
+	MIBsysName        = "1.3.6.1.2.1.1.5.0"
+	MIBsysLocation    = "1.3.6.1.2.1.1.6.0"
 	MIBifNumber       = "1.3.6.1.2.1.2.1.0"
 	MIBifDescr        = "1.3.6.1.2.1.2.2.1.2"
+	MIBifType         = "1.3.6.1.2.1.2.2.1.3"
 	MIBifPhysAddress  = "1.3.6.1.2.1.2.2.1.6"
+	MIBifAdminStatus  = "1.3.6.1.2.1.2.2.1.7"
 	MIBifOperStatus   = "1.3.6.1.2.1.2.2.1.8"
+	MIBifName         = "1.3.6.1.2.1.31.1.1.1.1"
+	MIBifHighSpeed    = "1.3.6.1.2.1.31.1.1.1.15"
+	MIBifAlias        = "1.3.6.1.2.1.31.1.1.1.18"
 	MIBipAdEntIfIndex = "1.3.6.1.2.1.4.20.1.2"
+	// IP-MIB ipAddressIfIndex, RFC 4293
+	MIBipAddressIfIndex = "1.3.6.1.2.1.4.34.1.3"
+
+	// ENTITY-MIB entPhysicalTable
+	MIBentPhysicalClass       = "1.3.6.1.2.1.47.1.1.1.1.5"
+	MIBentPhysicalFirmwareRev = "1.3.6.1.2.1.47.1.1.1.1.9"
+	MIBentPhysicalSoftwareRev = "1.3.6.1.2.1.47.1.1.1.1.10"
+	MIBentPhysicalSerialNum   = "1.3.6.1.2.1.47.1.1.1.1.11"
+	MIBentPhysicalModelName   = "1.3.6.1.2.1.47.1.1.1.1.13"
 )
 
 type SNMP struct {
 	handler Handler
 }
 
-func Init(ctx context.Context, target, community string) (*SNMP, error) {
-	g := NewHandler(ctx, target, community)
+func Init(ctx context.Context, a *Arg) (*SNMP, error) {
+	g := NewHandler(ctx, a)
 	err := g.Connect()
 	if err != nil {
 		return nil, err
@@ -39,6 +59,7 @@ func (s *SNMP) Close() error {
 var (
 	errGetInterfaceNumber       = errors.New("cant get interface number")
 	errParseInterfaceName       = errors.New("cant parse interface name")
+	errParseInterfaceAlias      = errors.New("cant parse interface alias")
 	errParseInterfacePhyAddress = errors.New("cant parse phy address")
 	errParseError               = errors.New("cant parse value")
 )
@@ -78,6 +99,27 @@ func (s *SNMP) BulkWalkGetInterfaceName(length uint64) (map[uint64]string, error
 	return kv, nil
 }
 
+func (s *SNMP) BulkWalkGetInterfaceAlias(length uint64) (map[uint64]string, error) {
+	kv := make(map[uint64]string, length)
+	err := s.handler.BulkWalk(MIBifAlias, func(pdu gosnmp.SnmpPDU) error {
+		index, err := captureIfIndex(pdu.Name)
+		if err != nil {
+			return err
+		}
+		switch pdu.Type {
+		case gosnmp.OctetString:
+			kv[index] = string(pdu.Value.([]byte))
+		default:
+			return errParseInterfaceAlias
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return kv, nil
+}
+
 func (s *SNMP) BulkWalkGetInterfaceState(length uint64) (map[uint64]bool, error) {
 	kv := make(map[uint64]bool, length)
 	err := s.handler.BulkWalk(MIBifOperStatus, func(pdu gosnmp.SnmpPDU) error {
@@ -130,12 +172,135 @@ func (s *SNMP) BulkWalk(oid string, length uint64) (map[uint64]uint64, error) {
 	return kv, nil
 }
 
+// BulkWalkGetStrings returns string values of the column. index:value
+func (s *SNMP) BulkWalkGetStrings(oid string) (map[uint64]string, error) {
+	kv := make(map[uint64]string)
+	err := s.handler.BulkWalk(oid, func(pdu gosnmp.SnmpPDU) error {
+		index, err := captureIfIndex(pdu.Name)
+		if err != nil {
+			return err
+		}
+		switch pdu.Type {
+		case gosnmp.OctetString:
+			kv[index] = string(pdu.Value.([]byte))
+		default:
+			return errParseError
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return kv, nil
+}
+
 func captureIfIndex(name string) (uint64, error) {
 	sl := strings.Split(name, ".")
 	return strconv.ParseUint(sl[len(sl)-1], 10, 64)
 }
 
+// BulkWalkGetInterfaceIPAddress returns IPv4 and IPv6 addresses. ifIndex:addresses
 func (s *SNMP) BulkWalkGetInterfaceIPAddress() (map[uint64][]string, error) {
+	kv, err := s.bulkWalkIPAddressIfIndex()
+	if err != nil || len(kv) == 0 {
+		// fallback for devices without ipAddressTable.
+		return s.bulkWalkIPAdEntIfIndex()
+	}
+	if hasIPv4(kv) {
+		return kv, nil
+	}
+
+	// some devices have only ipv6 in ipAddressTable, and ipv4 in ipAddrTable.
+	legacy, err := s.bulkWalkIPAdEntIfIndex()
+	if err != nil {
+		return kv, nil
+	}
+	for ifIndex, ips := range legacy {
+		kv[ifIndex] = append(ips, kv[ifIndex]...)
+	}
+	return kv, nil
+}
+
+func hasIPv4(kv map[uint64][]string) bool {
+	for _, ips := range kv {
+		for _, ip := range ips {
+			if net.ParseIP(ip).To4() != nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (s *SNMP) bulkWalkIPAddressIfIndex() (map[uint64][]string, error) {
+	kv := make(map[uint64][]string)
+	err := s.handler.BulkWalk(MIBipAddressIfIndex, func(pdu gosnmp.SnmpPDU) error {
+		index := strings.TrimPrefix(strings.TrimPrefix(pdu.Name, "."), MIBipAddressIfIndex+".")
+		ip := decodeInetAddress(index)
+		if ip == nil {
+			return nil
+		}
+		if ip.IsLoopback() || ip.IsLinkLocalUnicast() {
+			return nil
+		}
+
+		switch pdu.Type {
+		case gosnmp.OctetString:
+			return errParseError
+		default:
+			ifIndex := gosnmp.ToBigInt(pdu.Value).Uint64()
+			kv[ifIndex] = append(kv[ifIndex], ip.String())
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return kv, nil
+}
+
+// decodeInetAddress decodes the index of InetAddressType and InetAddress.
+// zoned addresses, ipv4z(3) and ipv6z(4), are not decoded.
+func decodeInetAddress(index string) net.IP {
+	var sub []uint64
+	for _, v := range strings.Split(index, ".") {
+		n, err := strconv.ParseUint(v, 10, 8)
+		if err != nil {
+			return nil
+		}
+		sub = append(sub, n)
+	}
+	if len(sub) < 2 {
+		return nil
+	}
+
+	var size int
+	switch sub[0] {
+	case 1: // ipv4
+		size = net.IPv4len
+	case 2: // ipv6
+		size = net.IPv6len
+	default:
+		return nil
+	}
+
+	octets := sub[1:]
+	// InetAddress is prefixed by the length, but some devices omit it.
+	if len(octets) == size+1 && octets[0] == uint64(size) {
+		octets = octets[1:]
+	}
+	if len(octets) != size {
+		return nil
+	}
+
+	ip := make(net.IP, size)
+	for i := range octets {
+		ip[i] = byte(octets[i])
+	}
+	return ip
+}
+
+func (s *SNMP) bulkWalkIPAdEntIfIndex() (map[uint64][]string, error) {
 	kv := make(map[uint64][]string)
 	err := s.handler.BulkWalk(MIBipAdEntIfIndex, func(pdu gosnmp.SnmpPDU) error {
 		ipAddress := strings.Replace(pdu.Name, MIBipAdEntIfIndex, "", 1)
@@ -219,3 +384,51 @@ func (s *SNMP) GetValues(mibs []string) ([]float64, error) {
 	}
 	return values, nil
 }
+
+// GetStrings returns values as string. empty when the device has no such object.
+func (s *SNMP) GetStrings(mibs []string) ([]string, error) {
+	result, err := s.handler.Get(mibs)
+	if err != nil {
+		return nil, err
+	}
+	var values []string
+	for _, variable := range result.Variables {
+		switch variable.Type {
+		case gosnmp.OctetString:
+			value, ok := variable.Value.([]byte)
+			if !ok {
+				return nil, fmt.Errorf("value cant parse : %v", variable.Value)
+			}
+			values = append(values, string(value))
+		case gosnmp.ObjectIdentifier:
+			value, ok := variable.Value.(string)
+			if !ok {
+				return nil, fmt.Errorf("value cant parse : %v", variable.Value)
+			}
+			values = append(values, strings.TrimPrefix(value, "."))
+		case gosnmp.NoSuchObject, gosnmp.NoSuchInstance, gosnmp.Null:
+			values = append(values, "")
+		default:
+			values = append(values, gosnmp.ToBigInt(variable.Value).String())
+		}
+	}
+	return values, nil
+}
+
+// Exists reports whether the device has values of the instances.
+func (s *SNMP) Exists(oids []string) ([]bool, error) {
+	result, err := s.handler.Get(oids)
+	if err != nil {
+		return nil, err
+	}
+	var exists []bool
+	for _, variable := range result.Variables {
+		switch variable.Type {
+		case gosnmp.NoSuchObject, gosnmp.NoSuchInstance, gosnmp.EndOfMibView, gosnmp.Null:
+			exists = append(exists, false)
+		default:
+			exists = append(exists, true)
+		}
+	}
+	return exists, nil
+}
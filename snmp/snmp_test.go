@@ -13,6 +13,8 @@ type mockHandler struct {
 	rootOid string
 	result  *gosnmp.SnmpPacket
 	pdus    []gosnmp.SnmpPDU
+	// pdus by root oid, used instead of pdus when set.
+	tables map[string][]gosnmp.SnmpPDU
 }
 
 func (m *mockHandler) Get(oids []string) (result *gosnmp.SnmpPacket, err error) {
@@ -22,14 +24,23 @@ func (m *mockHandler) Get(oids []string) (result *gosnmp.SnmpPacket, err error)
 
 func (m *mockHandler) BulkWalk(rootOid string, walkFn gosnmp.WalkFunc) error {
 	m.rootOid = rootOid
-	for i := range m.pdus {
-		if err := walkFn(m.pdus[i]); err != nil {
+	pdus := m.pdus
+	if m.tables != nil {
+		pdus = m.tables[rootOid]
+	}
+	for i := range pdus {
+		if err := walkFn(pdus[i]); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
+func (m *mockHandler) GetBulk(oids []string, nonRepeaters uint8, maxRepetitions uint32) (result *gosnmp.SnmpPacket, err error) {
+	m.oids = oids
+	return m.result, nil
+}
+
 func (m *mockHandler) Connect() error {
 	return nil
 }
@@ -95,6 +106,72 @@ func TestBulkWalkGetInterfaceName(t *testing.T) {
 	}
 }
 
+func TestBulkWalkGetInterfaceAlias(t *testing.T) {
+	m := mockHandler{
+		pdus: []gosnmp.SnmpPDU{
+			{
+				Name:  "1.3.6.1.2.1.31.1.1.1.18.1",
+				Value: []byte(""),
+				Type:  gosnmp.OctetString,
+			},
+			{
+				Name:  "1.3.6.1.2.1.31.1.1.1.18.2",
+				Value: []byte("uplink"),
+				Type:  gosnmp.OctetString,
+			},
+		},
+	}
+	s := &SNMP{handler: &m}
+
+	actual, err := s.BulkWalkGetInterfaceAlias(2)
+	expected := map[uint64]string{
+		1: "",
+		2: "uplink",
+	}
+	if err != nil {
+		t.Error("failed raised error")
+	}
+	if d := cmp.Diff(actual, expected); d != "" {
+		t.Error("invalid result")
+	}
+	if !reflect.DeepEqual(m.rootOid, MIBifAlias) {
+		t.Error("invalid argument")
+	}
+}
+
+func TestBulkWalkGetStrings(t *testing.T) {
+	m := mockHandler{
+		pdus: []gosnmp.SnmpPDU{
+			{
+				Name:  "1.3.6.1.2.1.47.1.1.1.1.11.1",
+				Value: []byte("FOC1234X0AB"),
+				Type:  gosnmp.OctetString,
+			},
+			{
+				Name:  "1.3.6.1.2.1.47.1.1.1.1.11.1001",
+				Value: []byte(""),
+				Type:  gosnmp.OctetString,
+			},
+		},
+	}
+	s := &SNMP{handler: &m}
+
+	actual, err := s.BulkWalkGetStrings(MIBentPhysicalSerialNum)
+	expected := map[uint64]string{
+		1:    "FOC1234X0AB",
+		1001: "",
+	}
+	if err != nil {
+		t.Error("failed raised error")
+	}
+	if d := cmp.Diff(actual, expected); d != "" {
+		t.Error("invalid result")
+	}
+	if !reflect.DeepEqual(m.rootOid, MIBentPhysicalSerialNum) {
+		t.Error("invalid argument")
+	}
+}
+
 func TestBulkWalkGetInterfaceState(t *testing.T) {
 	m := mockHandler{
 		pdus: []gosnmp.SnmpPDU{
@@ -198,6 +275,118 @@ func TestBulkWalkGetInterfaceIPAddress(t *testing.T) {
 	}
 }
 
+func TestBulkWalkGetInterfaceIPAddressIPv6(t *testing.T) {
+	m := mockHandler{
+		tables: map[string][]gosnmp.SnmpPDU{
+			MIBipAddressIfIndex: {
+				{
+					Name:  ".1.3.6.1.2.1.4.34.1.3.1.4.192.0.2.1",
+					Value: 1,
+				},
+				// 2001:db8::1
+				{
+					Name:  ".1.3.6.1.2.1.4.34.1.3.2.16.32.1.13.184.0.0.0.0.0.0.0.0.0.0.0.1",
+					Value: 1,
+				},
+				// without length
+				{
+					Name:  ".1.3.6.1.2.1.4.34.1.3.1.198.51.100.1",
+					Value: 3,
+				},
+				// fe80::1, link local
+				{
+					Name:  ".1.3.6.1.2.1.4.34.1.3.2.16.254.128.0.0.0.0.0.0.0.0.0.0.0.0.0.1",
+					Value: 3,
+				},
+				// ipv4z
+				{
+					Name:  ".1.3.6.1.2.1.4.34.1.3.3.8.192.0.2.2.0.0.0.1",
+					Value: 3,
+				},
+				{
+					Name:  ".1.3.6.1.2.1.4.34.1.3.1.4.127.0.0.1",
+					Value: 4,
+				},
+			},
+		},
+	}
+	s := &SNMP{handler: &m}
+
+	actual, err := s.BulkWalkGetInterfaceIPAddress()
+	expected := map[uint64][]string{
+		1: {"192.0.2.1", "2001:db8::1"},
+		3: {"198.51.100.1"},
+	}
+	if err != nil {
+		t.Error("failed raised error")
+	}
+	if d := cmp.Diff(actual, expected); d != "" {
+		t.Errorf("invalid result %s", d)
+	}
+}
+
+func TestBulkWalkGetInterfaceIPAddressFallback(t *testing.T) {
+	m := mockHandler{
+		tables: map[string][]gosnmp.SnmpPDU{
+			MIBipAdEntIfIndex: {
+				{
+					Name:  ".1.3.6.1.2.1.4.20.1.2.192.0.2.1",
+					Value: 1,
+				},
+			},
+		},
+	}
+	s := &SNMP{handler: &m}
+
+	actual, err := s.BulkWalkGetInterfaceIPAddress()
+	expected := map[uint64][]string{
+		1: {"192.0.2.1"},
+	}
+	if err != nil {
+		t.Error("failed raised error")
+	}
+	if d := cmp.Diff(actual, expected); d != "" {
+		t.Errorf("invalid result %s", d)
+	}
+}
+
+func TestBulkWalkGetInterfaceIPAddressIPv6Only(t *testing.T) {
+	m := mockHandler{
+		tables: map[string][]gosnmp.SnmpPDU{
+			MIBipAddressIfIndex: {
+				// 2001:db8::1
+				{
+					Name:  ".1.3.6.1.2.1.4.34.1.3.2.16.32.1.13.184.0.0.0.0.0.0.0.0.0.0.0.1",
+					Value: 1,
+				},
+			},
+			MIBipAdEntIfIndex: {
+				{
+					Name:  ".1.3.6.1.2.1.4.20.1.2.192.0.2.1",
+					Value: 1,
+				},
+				{
+					Name:  ".1.3.6.1.2.1.4.20.1.2.198.51.100.1",
+					Value: 3,
+				},
+			},
+		},
+	}
+	s := &SNMP{handler: &m}
+
+	actual, err := s.BulkWalkGetInterfaceIPAddress()
+	expected := map[uint64][]string{
+		1: {"192.0.2.1", "2001:db8::1"},
+		3: {"198.51.100.1"},
+	}
+	if err != nil {
+		t.Error("failed raised error")
+	}
+	if d := cmp.Diff(actual, expected); d != "" {
+		t.Errorf("invalid result %s", d)
+	}
+}
+
 func TestBulkWalkGetInterfacePhysAddress(t *testing.T) {
 	m := mockHandler{
 		pdus: []gosnmp.SnmpPDU{
@@ -264,3 +453,72 @@ func TestGetValues(t *testing.T) {
 		t.Error("invalid argument")
 	}
 }
+
+func TestGetStrings(t *testing.T) {
+	m := mockHandler{
+		result: &gosnmp.SnmpPacket{
+			Variables: []gosnmp.SnmpPDU{
+				{
+					Type:  gosnmp.OctetString,
+					Value: []byte("sw1"),
+				},
+				{
+					Type:  gosnmp.ObjectIdentifier,
+					Value: ".1.3.6.1.4.1.9.1.1",
+				},
+				{
+					Type: gosnmp.NoSuchObject,
+				},
+				{
+					Type:  gosnmp.TimeTicks,
+					Value: uint32(12345),
+				},
+			},
+		},
+	}
+	s := &SNMP{handler: &m}
+
+	mibs := []string{MIBsysName, MIBsysObjectID, "1.2.3.4.5.678", "1.3.6.1.2.1.1.3.0"}
+
+	actual, err := s.GetStrings(mibs)
+	if err != nil {
+		t.Error("failed raised error")
+	}
+
+	expected := []string{"sw1", "1.3.6.1.4.1.9.1.1", "", "12345"}
+
+	if d := cmp.Diff(actual, expected); d != "" {
+		t.Errorf("invalid result %s", d)
+	}
+	if !reflect.DeepEqual(m.oids, mibs) {
+		t.Error("invalid argument")
+	}
+}
+
+func TestExists(t *testing.T) {
+	m := mockHandler{
+		result: &gosnmp.SnmpPacket{
+			Variables: []gosnmp.SnmpPDU{
+				{
+					Type:  gosnmp.Gauge32,
+					Value: uint(42),
+				},
+				{
+					Type: gosnmp.NoSuchObject,
+				},
+				{
+					Type: gosnmp.NoSuchInstance,
+				},
+			},
+		},
+	}
+	s := &SNMP{handler: &m}
+
+	actual, err := s.Exists([]string{"1.2.3.4.5.678", "1.2.3.4.5.679", "1.2.3.4.5.680"})
+	if err != nil {
+		t.Error("failed raised error")
+	}
+	if d := cmp.Diff(actual, []bool{true, false, false}); d != "" {
+		t.Errorf("invalid result %s", d)
+	}
+}
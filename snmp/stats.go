@@ -0,0 +1,77 @@
+package snmp
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"time"
+)
+
+// Stats counts requests of handlers created with the context of WithStats.
+// it is not safe for concurrent use, handlers sharing it must be used in turn.
+type Stats struct {
+	// Responses is the number of received PDUs.
+	Responses int
+	Varbinds  int
+	Retries   int
+	Timeouts  int
+	// RTT is the total of round-trip times.
+	RTT time.Duration
+
+	sentAt time.Time
+}
+
+// AverageRTT returns the mean round-trip time.
+func (s *Stats) AverageRTT() time.Duration {
+	if s.Responses == 0 {
+		return 0
+	}
+	return s.RTT / time.Duration(s.Responses)
+}
+
+func (s *Stats) presend() {
+	s.sentAt = time.Now()
+}
+
+func (s *Stats) received() {
+	s.Responses++
+	s.RTT += time.Since(s.sentAt)
+}
+
+func (s *Stats) retried() {
+	s.Retries++
+}
+
+func (s *Stats) finished(varbinds int, err error) {
+	s.Varbinds += varbinds
+	if isTimeout(err) {
+		s.Timeouts++
+	}
+}
+
+// isTimeout reports whether the request got no response.
+// gosnmp returns a plain error, "request timeout (after n retries)", when retries are exhausted,
+// so its message is matched after typed errors of deadlines.
+func isTimeout(err error) bool {
+	if err == nil {
+		return false
+	}
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return strings.HasPrefix(err.Error(), "request timeout")
+}
+
+type statsKey struct{}
+
+// WithStats returns the context to count requests into s.
+func WithStats(ctx context.Context, s *Stats) context.Context {
+	return context.WithValue(ctx, statsKey{}, s)
+}
+
+func statsFrom(ctx context.Context) *Stats {
+	s, _ := ctx.Value(statsKey{}).(*Stats)
+	return s
+}
@@ -0,0 +1,46 @@
+package snmp
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestStats(t *testing.T) {
+	s := &Stats{}
+	ctx := WithStats(context.Background(), s)
+	h := NewHandler(ctx, &Arg{Host: "192.0.2.1"}).(*snmpHandler)
+	if h.stats != s {
+		t.Fatal("stats is not set")
+	}
+
+	h.PreSend(&h.GoSNMP)
+	h.OnRecv(&h.GoSNMP)
+	h.OnRetry(&h.GoSNMP)
+	h.PreSend(&h.GoSNMP)
+	h.OnRecv(&h.GoSNMP)
+	s.finished(10, nil)
+	s.finished(0, errors.New("request timeout (after 3 retries)"))
+	s.finished(0, context.DeadlineExceeded)
+	s.finished(0, &net.OpError{Op: "read", Err: os.ErrDeadlineExceeded})
+	s.finished(0, errors.New("invalid timeout value in the response"))
+
+	if s.Responses != 2 || s.Retries != 1 || s.Varbinds != 10 || s.Timeouts != 3 {
+		t.Errorf("invalid result %+v", s)
+	}
+	if s.AverageRTT() != s.RTT/2 {
+		t.Errorf("invalid average %s", s.AverageRTT())
+	}
+
+	// without stats
+	h = NewHandler(context.Background(), &Arg{Host: "192.0.2.1"}).(*snmpHandler)
+	if h.stats != nil || h.PreSend != nil {
+		t.Error("stats is set")
+	}
+	if (&Stats{}).AverageRTT() != time.Duration(0) {
+		t.Error("invalid average")
+	}
+}
@@ -0,0 +1,87 @@
+package snmp
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gosnmp/gosnmp"
+)
+
+// Variable is a value formatted to print.
+type Variable struct {
+	OID   string
+	Type  string
+	Value string
+}
+
+// Walk calls walkFn for each value in the subtree of oid.
+// the value of oid itself is returned when oid is an instance, such as sysDescr.0.
+func (s *SNMP) Walk(oid string, walkFn func(Variable) error) error {
+	var walked bool
+	err := s.handler.BulkWalk(oid, func(pdu gosnmp.SnmpPDU) error {
+		walked = true
+		return walkFn(format(pdu))
+	})
+	if err != nil || walked {
+		return err
+	}
+
+	result, err := s.handler.Get([]string{oid})
+	if err != nil {
+		return err
+	}
+	for _, pdu := range result.Variables {
+		switch pdu.Type {
+		case gosnmp.NoSuchObject, gosnmp.NoSuchInstance, gosnmp.EndOfMibView:
+			continue
+		}
+		if err := walkFn(format(pdu)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func format(pdu gosnmp.SnmpPDU) Variable {
+	v := Variable{
+		OID:  strings.TrimPrefix(pdu.Name, "."),
+		Type: pdu.Type.String(),
+	}
+	switch pdu.Type {
+	case gosnmp.OctetString:
+		b, _ := pdu.Value.([]byte)
+		v.Value = formatOctets(b)
+	case gosnmp.ObjectIdentifier:
+		s, _ := pdu.Value.(string)
+		v.Value = strings.TrimPrefix(s, ".")
+	case gosnmp.IPAddress:
+		s, _ := pdu.Value.(string)
+		v.Value = s
+	case gosnmp.OpaqueFloat, gosnmp.OpaqueDouble:
+		v.Value = fmt.Sprint(pdu.Value)
+	case gosnmp.Null, gosnmp.NoSuchObject, gosnmp.NoSuchInstance, gosnmp.EndOfMibView:
+	default:
+		v.Value = gosnmp.ToBigInt(pdu.Value).String()
+	}
+	return v
+}
+
+// formatOctets returns printable strings as is, others as hex such as MAC addresses.
+func formatOctets(b []byte) string {
+	printable := utf8.Valid(b)
+	for _, r := range string(b) {
+		if r < 0x20 && r != '\t' && r != '\n' && r != '\r' {
+			printable = false
+			break
+		}
+	}
+	if printable {
+		return string(b)
+	}
+	parts := make([]string, len(b))
+	for i := range b {
+		parts[i] = fmt.Sprintf("%02x", b[i])
+	}
+	return strings.Join(parts, ":")
+}
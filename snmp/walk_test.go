@@ -0,0 +1,71 @@
+package snmp
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/gosnmp/gosnmp"
+)
+
+func TestWalk(t *testing.T) {
+	t.Run("subtree", func(t *testing.T) {
+		m := &mockHandler{
+			pdus: []gosnmp.SnmpPDU{
+				{Name: ".1.3.6.1.2.1.1.1.0", Type: gosnmp.OctetString, Value: []byte("Cisco IOS Software")},
+				{Name: ".1.3.6.1.2.1.1.2.0", Type: gosnmp.ObjectIdentifier, Value: ".1.3.6.1.4.1.9.1.1"},
+				{Name: ".1.3.6.1.2.1.1.3.0", Type: gosnmp.TimeTicks, Value: uint32(12345)},
+				{Name: ".1.3.6.1.2.1.2.2.1.6.2", Type: gosnmp.OctetString, Value: []byte{0x00, 0x00, 0x87, 0x12, 0x34, 0x56}},
+				{Name: ".1.3.6.1.2.1.4.20.1.1.192.0.2.1", Type: gosnmp.IPAddress, Value: "192.0.2.1"},
+				{Name: ".1.3.6.1.2.1.31.1.1.1.6.1", Type: gosnmp.Counter64, Value: uint64(1 << 40)},
+			},
+		}
+		s := &SNMP{handler: m}
+		var actual []Variable
+		err := s.Walk("1.3.6.1.2.1", func(v Variable) error {
+			actual = append(actual, v)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := []Variable{
+			{OID: "1.3.6.1.2.1.1.1.0", Type: "OctetString", Value: "Cisco IOS Software"},
+			{OID: "1.3.6.1.2.1.1.2.0", Type: "ObjectIdentifier", Value: "1.3.6.1.4.1.9.1.1"},
+			{OID: "1.3.6.1.2.1.1.3.0", Type: "TimeTicks", Value: "12345"},
+			{OID: "1.3.6.1.2.1.2.2.1.6.2", Type: "OctetString", Value: "00:00:87:12:34:56"},
+			{OID: "1.3.6.1.2.1.4.20.1.1.192.0.2.1", Type: "IPAddress", Value: "192.0.2.1"},
+			{OID: "1.3.6.1.2.1.31.1.1.1.6.1", Type: "Counter64", Value: "1099511627776"},
+		}
+		if d := cmp.Diff(actual, expected); d != "" {
+			t.Errorf("value is mismatch (-actual +expected):%s", d)
+		}
+	})
+
+	t.Run("instance", func(t *testing.T) {
+		m := &mockHandler{
+			result: &gosnmp.SnmpPacket{
+				Variables: []gosnmp.SnmpPDU{
+					{Name: ".1.3.6.1.2.1.1.5.0", Type: gosnmp.OctetString, Value: []byte("sw1")},
+				},
+			},
+		}
+		s := &SNMP{handler: m}
+		var actual []Variable
+		err := s.Walk("1.3.6.1.2.1.1.5.0", func(v Variable) error {
+			actual = append(actual, v)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := []Variable{
+			{OID: "1.3.6.1.2.1.1.5.0", Type: "OctetString", Value: "sw1"},
+		}
+		if d := cmp.Diff(actual, expected); d != "" {
+			t.Errorf("value is mismatch (-actual +expected):%s", d)
+		}
+		if d := cmp.Diff(m.oids, []string{"1.3.6.1.2.1.1.5.0"}); d != "" {
+			t.Errorf("value is mismatch (-actual +expected):%s", d)
+		}
+	})
+}
@@ -0,0 +1,177 @@
+package status
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yseto/switch-traffic-to-mackerel/queue"
+)
+
+// Target is the result of the last collection of a target.
+type Target struct {
+	Target         string        `json:"target"`
+	LastCollection time.Time     `json:"lastCollection"`
+	Duration       time.Duration `json:"duration"`
+	Error          string        `json:"error,omitempty"`
+	Interfaces     int           `json:"interfaces"`
+	LastSuccess    time.Time     `json:"lastSuccess"`
+}
+
+type statsProvider interface {
+	Stats() []queue.Stats
+}
+
+// Status tracks collections and sends, and serves them over HTTP.
+// methods of nil *Status do nothing.
+type Status struct {
+	mu      sync.RWMutex
+	targets []*Target
+
+	queues  statsProvider
+	started time.Time
+	// unhealthy when nothing succeeded for this period.
+	threshold time.Duration
+
+	now func() time.Time
+}
+
+func New(targets []string, queues statsProvider, interval time.Duration, intervals int) *Status {
+	s := &Status{
+		queues:    queues,
+		started:   time.Now(),
+		threshold: interval * time.Duration(intervals),
+		now:       time.Now,
+	}
+	for _, t := range targets {
+		s.targets = append(s.targets, &Target{Target: t})
+	}
+	return s
+}
+
+// SetTargets replaces targets, results of kept targets are kept.
+func (s *Status) SetTargets(targets []string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	prev := make(map[string]*Target, len(s.targets))
+	for _, t := range s.targets {
+		prev[t.Target] = t
+	}
+	s.targets = nil
+	for _, t := range targets {
+		if p, ok := prev[t]; ok {
+			s.targets = append(s.targets, p)
+			continue
+		}
+		s.targets = append(s.targets, &Target{Target: t})
+	}
+}
+
+// Collected records the result of a collection started at start.
+func (s *Status) Collected(target string, start time.Time, interfaces int, err error) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, t := range s.targets {
+		if t.Target != target {
+			continue
+		}
+		t.LastCollection = start
+		t.Duration = s.now().Sub(start)
+		t.Interfaces = interfaces
+		t.Error = ""
+		if err != nil {
+			t.Error = err.Error()
+		} else {
+			t.LastSuccess = start
+		}
+	}
+}
+
+type response struct {
+	Started time.Time     `json:"started"`
+	Targets []Target      `json:"targets"`
+	Queues  []queue.Stats `json:"queues"`
+}
+
+func (s *Status) snapshot() *response {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	r := &response{
+		Started: s.started,
+		Targets: make([]Target, 0, len(s.targets)),
+		Queues:  s.queues.Stats(),
+	}
+	for _, t := range s.targets {
+		r.Targets = append(r.Targets, *t)
+	}
+	return r
+}
+
+// problems returns why the process is unhealthy.
+func (s *Status) problems() []string {
+	r := s.snapshot()
+	now := s.now()
+
+	var problems []string
+	for _, t := range r.Targets {
+		last := t.LastSuccess
+		if last.IsZero() {
+			last = r.Started
+		}
+		if now.Sub(last) > s.threshold {
+			problems = append(problems, fmt.Sprintf("%s: no successful collection since %s", t.Target, last.UTC().Format(time.RFC3339)))
+		}
+	}
+	for _, q := range r.Queues {
+		// an empty queue has nothing to send.
+		if q.Values == 0 {
+			continue
+		}
+		last := q.LastSuccess
+		if last.IsZero() {
+			last = r.Started
+		}
+		if now.Sub(last) > s.threshold {
+			problems = append(problems, fmt.Sprintf("%s: no successful send since %s", q.Name, last.UTC().Format(time.RFC3339)))
+		}
+	}
+	return problems
+}
+
+func (s *Status) serveHealthz(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if problems := s.problems(); len(problems) > 0 {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintln(w, strings.Join(problems, "\n")) // nolint
+		return
+	}
+	fmt.Fprintln(w, "ok") // nolint
+}
+
+func (s *Status) serveStatus(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(s.snapshot()) // nolint
+}
+
+// Register adds /healthz, /status and /debug/pprof/ to mux.
+func (s *Status) Register(mux *http.ServeMux) {
+	mux.HandleFunc("/healthz", s.serveHealthz)
+	mux.HandleFunc("/status", s.serveStatus)
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+}
@@ -0,0 +1,115 @@
+package status
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/yseto/switch-traffic-to-mackerel/queue"
+)
+
+type mockQueues []queue.Stats
+
+func (m mockQueues) Stats() []queue.Stats {
+	return m
+}
+
+func TestCollected(t *testing.T) {
+	s := New([]string{"192.0.2.1", "192.0.2.2"}, mockQueues{}, time.Minute, 3)
+	start := time.Unix(1700000000, 0)
+	s.now = func() time.Time { return start.Add(2 * time.Second) }
+
+	s.Collected("192.0.2.1", start, 24, nil)
+	s.Collected("192.0.2.2", start, 0, errors.New("request timeout"))
+	// unknown target is ignored.
+	s.Collected("192.0.2.3", start, 1, nil)
+
+	expected := []Target{
+		{Target: "192.0.2.1", LastCollection: start, Duration: 2 * time.Second, Interfaces: 24, LastSuccess: start},
+		{Target: "192.0.2.2", LastCollection: start, Duration: 2 * time.Second, Error: "request timeout"},
+	}
+	if diff := cmp.Diff(s.snapshot().Targets, expected); diff != "" {
+		t.Errorf("value is mismatch (-actual +expected):%s", diff)
+	}
+
+	// nil is no-op.
+	var n *Status
+	n.Collected("192.0.2.1", start, 1, nil)
+}
+
+func TestSetTargets(t *testing.T) {
+	s := New([]string{"192.0.2.1", "192.0.2.2"}, mockQueues{}, time.Minute, 3)
+	start := time.Unix(1700000000, 0)
+	s.now = func() time.Time { return start }
+	s.Collected("192.0.2.1", start, 24, nil)
+
+	s.SetTargets([]string{"192.0.2.3", "192.0.2.1"})
+
+	expected := []Target{
+		{Target: "192.0.2.3"},
+		{Target: "192.0.2.1", LastCollection: start, Interfaces: 24, LastSuccess: start},
+	}
+	if diff := cmp.Diff(s.snapshot().Targets, expected); diff != "" {
+		t.Errorf("value is mismatch (-actual +expected):%s", diff)
+	}
+}
+
+func TestHealthz(t *testing.T) {
+	started := time.Unix(1700000000, 0)
+	queues := mockQueues{{Name: "mackerel"}}
+	s := New([]string{"192.0.2.1"}, queues, time.Minute, 3)
+	s.started = started
+	now := started.Add(time.Minute)
+	s.now = func() time.Time { return now }
+
+	mux := http.NewServeMux()
+	s.Register(mux)
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w
+	}
+
+	if w := get("/healthz"); w.Code != http.StatusOK {
+		t.Errorf("invalid status %d", w.Code)
+	}
+
+	// no collection for 3 intervals.
+	now = started.Add(4 * time.Minute)
+	if w := get("/healthz"); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("invalid status %d", w.Code)
+	}
+
+	s.Collected("192.0.2.1", now, 1, nil)
+	if w := get("/healthz"); w.Code != http.StatusOK {
+		t.Errorf("invalid status %d", w.Code)
+	}
+
+	// values are pending, and never sent.
+	queues[0].Values = 10
+	w := get("/healthz")
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("invalid status %d", w.Code)
+	}
+	if expected := "mackerel: no successful send since 2023-11-14T22:13:20Z\n"; w.Body.String() != expected {
+		t.Errorf("invalid body %s", w.Body.String())
+	}
+
+	w = get("/status")
+	var actual response
+	if err := json.Unmarshal(w.Body.Bytes(), &actual); err != nil {
+		t.Fatal(err)
+	}
+	if len(actual.Targets) != 1 || len(actual.Queues) != 1 || actual.Queues[0].Values != 10 {
+		t.Errorf("invalid status %s", w.Body.String())
+	}
+
+	if w := get("/debug/pprof/"); w.Code != http.StatusOK {
+		t.Errorf("invalid status %d", w.Code)
+	}
+}